@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/MobRulesGames/haunts/game"
+)
+
+// What haunts was asked to do on the command line. With a script it goes
+// straight into that scenario, skipping the menus, so that given the same
+// seed and side a game starts out exactly the same every time:
+//
+//	haunts -script Lvl01.lua -house Lvl_01_Haunted_House -side Intruders -seed 1234
+//
+// The old forms, 'haunts lvl1' and 'haunts replay <file>', still work.
+type commandLine struct {
+	datadir string
+
+	// Which scripts get run in a sandbox, see game.LuaSandbox.
+	sandbox game.LuaSandbox
+
+	// Set to play a scenario straight away.
+	scenario game.Scenario
+
+	// Set to watch a replay straight away.
+	replay string
+}
+
+func parseCommandLine(argv []string, errs io.Writer) (commandLine, error) {
+	var cl commandLine
+	name := "haunts"
+	if len(argv) > 0 {
+		name = argv[0]
+		argv = argv[1:]
+	}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(errs)
+	flags.StringVar(&cl.datadir, "data", "data", "game data directory")
+	flags.StringVar(&cl.scenario.Script, "script", "", "level script to start, under data/scripts")
+	flags.StringVar(&cl.scenario.HouseOverride, "house", "", "name of a house, under data/houses, to load instead of the script's")
+	flags.StringVar(&cl.scenario.Side, "side", "", "side to play the script as: Denizens, Intruders or Humans")
+	flags.Int64Var(&cl.scenario.Seed, "seed", 0, "seed for the game's random numbers, 0 for the usual one")
+	flags.StringVar(&cl.replay, "replay", "", "replay to watch")
+	flags.Func("sandbox", "which Lua scripts to sandbox: data (only those from outside the data directory), on or off", func(name string) error {
+		var err error
+		cl.sandbox, err = game.ParseLuaSandbox(name)
+		return err
+	})
+	err := flags.Parse(argv)
+	if err != nil {
+		return commandLine{}, err
+	}
+
+	switch args := flags.Args(); {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "lvl1":
+		if cl.scenario.Script == "" {
+			cl.scenario.Script = "Lvl01.lua"
+			cl.scenario.HouseName = "Lvl_01_Haunted_House"
+		}
+	case len(args) == 2 && args[0] == "replay":
+		cl.replay = args[1]
+	default:
+		return commandLine{}, fmt.Errorf("unexpected arguments %q", args)
+	}
+
+	switch cl.scenario.Side {
+	case "", "Denizens", "Intruders", "Humans":
+	default:
+		return commandLine{}, fmt.Errorf("-side has to be Denizens, Intruders or Humans, not %q", cl.scenario.Side)
+	}
+	if cl.scenario.Script == "" && (cl.scenario.HouseOverride != "" || cl.scenario.Side != "" || cl.scenario.Seed != 0) {
+		return commandLine{}, errors.New("-house, -side and -seed only make sense with -script")
+	}
+	if cl.scenario.Script != "" && cl.replay != "" {
+		return commandLine{}, errors.New("can't both start a script and watch a replay")
+	}
+	return cl, nil
+}
+
+// The command line that starts the same scenario again.
+func (cl commandLine) String() string {
+	parts := []string{"haunts"}
+	if cl.datadir != "data" {
+		parts = append(parts, "-data", cl.datadir)
+	}
+	if cl.scenario.Script != "" {
+		parts = append(parts, "-script", cl.scenario.Script)
+	}
+	if cl.scenario.HouseOverride != "" {
+		parts = append(parts, "-house", cl.scenario.HouseOverride)
+	}
+	if cl.scenario.Side != "" {
+		parts = append(parts, "-side", cl.scenario.Side)
+	}
+	if cl.scenario.Seed != 0 {
+		parts = append(parts, "-seed", fmt.Sprint(cl.scenario.Seed))
+	}
+	if cl.replay != "" {
+		parts = append(parts, "-replay", cl.replay)
+	}
+	if cl.sandbox != game.LuaSandboxOutsideData {
+		parts = append(parts, "-sandbox", cl.sandbox.String())
+	}
+	for i := range parts {
+		if strings.ContainsAny(parts[i], " \t'\"") {
+			parts[i] = fmt.Sprintf("%q", parts[i])
+		}
+	}
+	return strings.Join(parts, " ")
+}
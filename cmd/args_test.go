@@ -0,0 +1,85 @@
+package cmd_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/cmd"
+	"github.com/MobRulesGames/haunts/game"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	Convey("Parsing the command line", t, func() {
+		parse := func(args string) (cmd.CommandLine, error) {
+			return cmd.ParseCommandLine(append([]string{"haunts"}, strings.Fields(args)...), io.Discard)
+		}
+
+		Convey("accepts", func() {
+			for _, tc := range []struct {
+				args     string
+				datadir  string
+				sandbox  game.LuaSandbox
+				scenario game.Scenario
+				replay   string
+			}{
+				{args: "", datadir: "data"},
+				{args: "-data elsewhere", datadir: "elsewhere"},
+				{args: "-sandbox on", datadir: "data", sandbox: game.LuaSandboxAlways},
+				{args: "-sandbox off", datadir: "data", sandbox: game.LuaSandboxNever},
+				{
+					args:     "-script Lvl02.lua -house Lvl_01_Haunted_House -side Intruders -seed 1234",
+					datadir:  "data",
+					scenario: game.Scenario{Script: "Lvl02.lua", HouseOverride: "Lvl_01_Haunted_House", Side: "Intruders", Seed: 1234},
+				},
+				{args: "-script Lvl01.lua -side Humans", datadir: "data", scenario: game.Scenario{Script: "Lvl01.lua", Side: "Humans"}},
+				{args: "lvl1", datadir: "data", scenario: game.Scenario{Script: "Lvl01.lua", HouseName: "Lvl_01_Haunted_House"}},
+				{args: "-script Lvl03.lua lvl1", datadir: "data", scenario: game.Scenario{Script: "Lvl03.lua"}},
+				{args: "replay some.replay", datadir: "data", replay: "some.replay"},
+				{args: "-replay some.replay", datadir: "data", replay: "some.replay"},
+			} {
+				cl, err := parse(tc.args)
+				So(err, ShouldBeNil)
+				So(cl.Datadir(), ShouldEqual, tc.datadir)
+				So(cl.Sandbox(), ShouldEqual, tc.sandbox)
+				So(cl.Scenario(), ShouldResemble, tc.scenario)
+				So(cl.Replay(), ShouldEqual, tc.replay)
+			}
+		})
+
+		Convey("rejects", func() {
+			for _, args := range []string{
+				"-nonsense",
+				"-seed lots",
+				"-sandbox maybe",
+				"-script Lvl01.lua -side Ghosts",
+				"-house Lvl_01_Haunted_House",
+				"-side Intruders",
+				"-seed 1234",
+				"-script Lvl01.lua -replay some.replay",
+				"lvl2",
+				"replay",
+				"replay one two",
+			} {
+				_, err := parse(args)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("prints what starts the same scenario again", func() {
+			for _, args := range []string{
+				"-script Lvl02.lua -house Lvl_01_Haunted_House -side Intruders -seed 1234",
+				"-data elsewhere -replay some.replay -sandbox on",
+			} {
+				cl, err := parse(args)
+				So(err, ShouldBeNil)
+				So(cl.String(), ShouldEqual, "haunts "+args)
+
+				again, err := parse(strings.TrimPrefix(cl.String(), "haunts "))
+				So(err, ShouldBeNil)
+				So(again, ShouldResemble, cl)
+			}
+		})
+	})
+}
@@ -0,0 +1,12 @@
+package cmd
+
+import "github.com/MobRulesGames/haunts/game"
+
+type CommandLine = commandLine
+
+var ParseCommandLine = parseCommandLine
+
+func (cl commandLine) Datadir() string          { return cl.datadir }
+func (cl commandLine) Sandbox() game.LuaSandbox { return cl.sandbox }
+func (cl commandLine) Scenario() game.Scenario  { return cl.scenario }
+func (cl commandLine) Replay() string           { return cl.replay }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
@@ -105,14 +107,19 @@ func WatchForSlowJobs() *render.JobTimingListener {
 	}
 }
 
-func initializeDependencies() (system.System, io.Reader, func()) {
+func initializeDependencies(cl commandLine) (system.System, io.Reader, func()) {
 	gin.In().SetLogger(logging.InfoLogger())
 
 	logging.SetLoggingLevel(slog.LevelInfo)
 	sysret := system.Make(gos.NewSystemInterface(), gin.In())
 
-	rand.Seed(100)
-	base.SetDatadir("data")
+	if cl.scenario.Seed != 0 {
+		rand.Seed(cl.scenario.Seed)
+	} else {
+		rand.Seed(100)
+	}
+	base.SetDatadir(cl.datadir)
+	game.SetLuaSandbox(cl.sandbox)
 	var err error
 	logFile, err := openLogFile(base.GetDataDir())
 	if err != nil {
@@ -131,6 +138,15 @@ func initializeDependencies() (system.System, io.Reader, func()) {
 		panic(err.Error())
 	}
 
+	// The server uses this to make sure everyone in a game runs the same build.
+	mrgnet.SetBuild(gen.Version())
+
+	// Lets us point the client at a different game server without rebuilding.
+	if serverUrl := os.Getenv("HAUNTS_SERVER_URL"); serverUrl != "" {
+		logging.Info("using game server", "url", serverUrl)
+		mrgnet.SetTransport(&mrgnet.HTTPTransport{URL: serverUrl})
+	}
+
 	actions.Init()
 	ai.Init()
 
@@ -140,17 +156,30 @@ func initializeDependencies() (system.System, io.Reader, func()) {
 }
 
 func Main(argv []string) {
-	sys, logReader, cleanup := initializeDependencies()
+	cl, err := parseCommandLine(argv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	sys, logReader, cleanup := initializeDependencies(cl)
 	defer cleanup()
+	logging.Info("started", "command line", cl.String())
 
 	var key_binds base.KeyBinds
-	err := base.LoadJson(filepath.Join(base.GetDataDir(), "key_binds.json"), &key_binds)
+	err = base.LoadJson(filepath.Join(base.GetDataDir(), "key_binds.json"), &key_binds)
 	if err != nil {
 		panic(fmt.Errorf("couldn't load key binds: %w", err))
 	}
 	key_map = key_binds.MakeKeyMap()
 	base.SetDefaultKeyMap(key_map)
 
+	// Only the first menu after a crash offers to restore the last autosave.
+	crashed := game.MarkRunning()
+
 	defer func() {
 		if r := recover(); r != nil {
 			onHauntsPanic(r)
@@ -223,21 +252,31 @@ func Main(argv []string) {
 			Dx: 1024,
 			Dy: 768,
 		})}
-		if len(argv) > 1 && argv[1] == "lvl1" {
-			lvl1scenario := game.Scenario{
-				Script:    "Lvl01.lua",
-				HouseName: "Lvl_01_Haunted_House",
-			}
+		if cl.scenario.Script != "" {
 			var player *game.Player // nil for now
 			nodata := map[string]string{}
 			nogamekey := mrgnet.GameKey("")
-			game_box.AddChild(game.MakeGamePanel(lvl1scenario, player, nodata, nogamekey))
+			game_box.AddChild(game.MakeGamePanel(cl.scenario, player, nodata, nogamekey))
+		} else if cl.replay != "" {
+			err := game.InsertReplayPanel(game_box, cl.replay)
+			if err != nil {
+				panic(fmt.Errorf("couldn't play replay: %w", err))
+			}
 		} else {
 			layout, err := game.LoadStartLayoutFromDatadir(base.GetDataDir())
 			if err != nil {
 				panic(fmt.Errorf("loading start layout failed: %w", err))
 			}
-			err = game.InsertStartMenu(game_box, *layout)
+			insertStartMenu := func(parent gui.WidgetParent) error {
+				return game.InsertStartMenu(parent, *layout)
+			}
+			if autosave := game.LastAutosave(); crashed && autosave != nil {
+				logging.Info("last run ended abnormally, offering autosave", "path", autosave.Path())
+				err = game.InsertRestoreMenu(game_box, autosave, insertStartMenu)
+			} else {
+				err = insertStartMenu(game_box)
+			}
+			crashed = false
 			if err != nil {
 				panic(fmt.Errorf("couldn't insert start menu: %w", err))
 			}
@@ -258,6 +297,7 @@ func Main(argv []string) {
 	queue.Purge()
 
 	runGameLoop(queue, ui, sys)
+	game.MarkStopped()
 }
 
 // TODO(tmckee): move everything below this to a game/game_loop.go file.
@@ -1,3 +1,9 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+	spawns = {"Chest", "Mirror"},
+}
+
 function setLosModeToRoomsWithSpawnsMatching(side, pattern)
 	sp = Script.GetSpawnPointsMatching(pattern)
 	rooms = {}
@@ -355,14 +361,14 @@ function checkExec(exec, is_playback)
 			Script.DialogBox("ui/dialog/Lvl01/Victory_Intruders.json")
 			store.tension = 0.7
 			Script.SetMusicParam("tension_level", 0.7)
-			Script.EndGame()
+			Script.EndGame("intruders")
 		end
 	end
 
 	if not AnyIntrudersAlive() then
 		Script.Sleep(2)
 		Script.DialogBox("ui/dialog/Lvl01/Victory_Denizens.json")
-		Script.EndGame()
+		Script.EndGame("denizens")
 	end
 
 	-- --after any action, if this ent's Ap is 0, we can select the next ent for them
@@ -1,3 +1,10 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  spawns = {"Angry Shade"},
+  damage = {25},
+}
+
 function setLosModeToRoomsWithSpawnsMatching(side, pattern)
   sp = Script.GetSpawnPointsMatching(pattern)
   rooms = {}
@@ -188,7 +195,7 @@ function OnAction(intruders, round, exec)
       --master is dead.  Intruders win.
       Script.Sleep(2)
       Script.DialogBox("ui/dialog/Lvl02/Lvl_02_Victory_Intruders.json")
-      Script.EndGame()
+      Script.EndGame("intruders")
     end
   end
 
@@ -213,7 +220,7 @@ function OnAction(intruders, round, exec)
     --game over, the denizens win.
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl02/Lvl_02_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end
 
   --after any action, if this ent's Ap is 0, we can select the next ent for them
@@ -1,3 +1,10 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  spawns = {"Collector", "Reporter", "Detective", "Infected"},
+  despawns = true,
+}
+
 function setLosModeToRoomsWithSpawnsMatching(side, pattern)
   sp = Script.GetSpawnPointsMatching(pattern)
   rooms = {}
@@ -366,7 +373,7 @@ function checkExec(exec, is_playback)
           --The intruders got to the exit with the Antidote.  Game over.
           Script.Sleep(2)
           Script.DialogBox("ui/dialog/Lvl03/Lvl_03_Victory_Intruders.json")    
-          Script.EndGame()
+          Script.EndGame("intruders")
         end
       end
     end
@@ -385,7 +392,7 @@ function checkExec(exec, is_playback)
   if not AnyIntrudersAlive() then
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl03/Lvl_03_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end 
 
   --if the deni master used Signal Shift Change, permit spawning and end the turn.
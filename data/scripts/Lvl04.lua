@@ -1,3 +1,9 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  spawns = {"Duchess Orlac"},
+}
+
 function setLosModeToRoomsWithSpawnsMatching(side, pattern)
   sp = Script.GetSpawnPointsMatching(pattern)
   rooms = {}
@@ -273,7 +279,7 @@ function checkExec(exec, is_playback)
       --Intruders win
       Script.Sleep(2)
       Script.DialogBox("ui/dialog/Lvl04/Lvl_04_Victory_Intruders.json")
-      Script.EndGame()
+      Script.EndGame("intruders")
     end 
   end
 
@@ -281,7 +287,7 @@ function checkExec(exec, is_playback)
   if not AnyIntrudersAlive() then
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl04/Lvl_04_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end 
 
 
@@ -1,3 +1,10 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  spawns = {"Ancient One", "Corpse"},
+  despawns = true,
+}
+
 function setLosModeToRoomsWithSpawnsMatching(side, pattern)
   sp = Script.GetSpawnPointsMatching(pattern)
   rooms = {}
@@ -288,7 +295,7 @@ function OnAction(intruders, round, exec)
       if exec.Target.HpCur <= 0 then
         Script.Sleep(2)
         Script.DialogBox("ui/dialog/Lvl05/Lvl_05_Victory_Intruders.json")
-        Script.EndGame()
+        Script.EndGame("intruders")
       end
     end
   end
@@ -296,7 +303,7 @@ function OnAction(intruders, round, exec)
   if not AnyIntrudersAlive() then
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl05/Lvl_05_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end
 
   --after any action, if this ent's Ap is 0, we can select the next ent for them
@@ -351,7 +358,7 @@ function RoundEnd(intruders, round)
       Script.DialogBox("ui/dialog/Lvl05/pass_to_denizens.json")
       if store.nTurnsRemaining == 0 and store.bSummoning then
         Script.DialogBox("ui/dialog/Lvl05/Lvl_05_Victory_Denizens.json")
-        Script.EndGame()
+        Script.EndGame("denizens")
       end
       if store.bMasterAttacked then
         next_store.bMasterAttacked = false --keep us from showing this more than once.
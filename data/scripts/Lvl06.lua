@@ -1,3 +1,14 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  spawns = {
+    "Professor Keith Evans", "Sir Wilhem Bohn",
+    "Codename: Bosch", "Codename: Orlac", "Codename: Ancient", "Codename: Chosen",
+    "Subject Bosch", "Subject Orlac", "Subject Ancient", "Subject Chosen",
+  },
+  despawns = true,
+}
+
 
 --****TUTORIAL SECTION****--
 function IsStoryMode()
@@ -177,12 +188,12 @@ function OnAction(intruders, round, exec)
         if store.ScoreCounter >= 20 then
           Script.Sleep(2)
           Script.DialogBox("ui/dialog/Lvl06/Lvl_06_Victory_Intruders.json")
-          Script.EndGame()
+          Script.EndGame("intruders")
         end
         if store.ScoreCounter <= 0 then
           Script.Sleep(2)
           Script.DialogBox("ui/dialog/Lvl06/Lvl_06_Victory_Denizens.json")
-          Script.EndGame()
+          Script.EndGame("denizens")
         end
       end
     end
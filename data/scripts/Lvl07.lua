@@ -1,3 +1,10 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  spawns = {"Collector", "Mimic"},
+  despawns = true,
+}
+
 function setLosModeToRoomsWithSpawnsMatching(side, pattern)
   sp = Script.GetSpawnPointsMatching(pattern)
   rooms = {}
@@ -224,7 +231,7 @@ function OnAction(intruders, round, exec)
         --The intruders got to the exit.  Game over.
         Script.Sleep(2)
         Script.DialogBox("ui/dialog/Lvl07/Lvl_07_Victory_Intruders.json")    
-        Script.EndGame()
+        Script.EndGame("intruders")
       end
     end
   end  
@@ -233,7 +240,7 @@ function OnAction(intruders, round, exec)
   if not AnyIntrudersAlive() then
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl07/Lvl_07_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end 
 
   --after any action, if this ent's Ap is 0, we can select the next ent for them
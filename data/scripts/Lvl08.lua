@@ -1,3 +1,11 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  spawns = {"Care Provider", "Tutor", "Foster Father", "Toy", "Maelstrom"},
+  damage = {4},
+  despawns = true,
+}
+
 function IsStoryMode()
   return true
 end
@@ -179,7 +187,7 @@ function OnAction(intruders, round, exec)
         --they did it.
         Script.Sleep(2)
         Script.DialogBox("ui/dialog/Lvl08/Lvl_08_Victory_Intruders.json")   
-        Script.EndGame()
+        Script.EndGame("intruders")
       end
     end
   end
@@ -199,7 +207,7 @@ function OnAction(intruders, round, exec)
     --game over, the denizens win.
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl08/Lvl_08_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end
 
   --after any action, if this ent's Ap is 0, we can select the next ent for them
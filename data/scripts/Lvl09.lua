@@ -1,3 +1,10 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  damage = {50, 4},
+  despawns = true,
+}
+
 function IsStoryMode()
   return true
 end
@@ -143,7 +150,7 @@ function OnAction(intruders, round, exec)
     --game over, the denizens win.
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl09/Lvl_09_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end
 
   --so does killing all the denizens
@@ -151,7 +158,7 @@ function OnAction(intruders, round, exec)
     --game over, the denizens win.
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl09/Lvl_09_Victory_Intruders.json")
-    Script.EndGame()
+    Script.EndGame("intruders")
   end  
 
   --if they just summoned, we need to find the thing they summoned, bind it's ai and kill it's ap.
@@ -1,3 +1,10 @@
+-- What this script's own execs can do, which servers check the turns of
+-- online games against.
+ScriptedExecs = {
+  damage = {50, 4},
+  despawns = true,
+}
+
 function setLosModeToRoomsWithSpawnsMatching(side, pattern)
   sp = Script.GetSpawnPointsMatching(pattern)
   rooms = {}
@@ -160,14 +167,14 @@ function OnAction(intruders, round, exec)
   if not AnyIntrudersAlive() and store.bIntruderIntroDone then
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl10/Lvl_10_Victory_Denizens.json")
-    Script.EndGame()
+    Script.EndGame("denizens")
   end
 
   --so does killing all the denizens
   if not AnyDenizensAlive() then
     Script.Sleep(2)
     Script.DialogBox("ui/dialog/Lvl10/Lvl_10_Victory_Intruders.json")
-    Script.EndGame()
+    Script.EndGame("intruders")
   end  
 
 
@@ -233,7 +240,7 @@ function RoundEnd(intruders, round)
       next_store.OpCurrent = next_store.OpCurrent + next_store.occupiedPoints
       if next_store.OpCurrent >= next_store.OpGoal then
         Script.DialogBox("ui/dialog/Lvl10/Lvl_10_Victory_Intruders.json")
-        Script.EndGame()
+        Script.EndGame("intruders")
       else 
         Script.DialogBox("ui/dialog/Lvl10/Lvl_10_Score_Intruders.json", {points=next_store.occupiedPoints, countdown=(next_store.OpGoal - next_store.OpCurrent)})
       end
@@ -122,7 +122,9 @@ type ActionExec interface {
 func encodeActionExec(ae ActionExec) []byte {
 	b := bytes.NewBuffer(nil)
 	enc := gob.NewEncoder(b)
-	err := enc.Encode(ae)
+	// Encoded through a pointer so that it goes as an interface, otherwise
+	// decodeActionExec wouldn't know what to make of it.
+	err := enc.Encode(&ae)
 	if err != nil {
 		base.DeprecatedLog().Error("Failed to gob an ActionExec", "err", err)
 		return nil
@@ -186,6 +188,10 @@ type Action interface {
 	// interrupted.
 	Maintain(dt int64, g *Game, exec ActionExec) MaintenanceStatus
 
+	// Whether 'exec' is one that this kind of action makes. Only those can be
+	// passed to Maintain.
+	IsExec(exec ActionExec) bool
+
 	// This will be called if the action has been readied at this is a logical
 	// point for an interrupt to happen.  Should return true if the action
 	// should take place.
@@ -342,6 +342,11 @@ func (a *AoeAttack) getTargetsAt(g *game.Game, tx, ty house.BoardSpaceUnit) []*g
 	return targets
 }
 
+func (a *AoeAttack) IsExec(exec game.ActionExec) bool {
+	_, ok := exec.(*aoeExec)
+	return ok
+}
+
 func (a *AoeAttack) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.MaintenanceStatus {
 	if ae != nil {
 		a.exec = ae.(*aoeExec)
@@ -290,6 +290,11 @@ func (a *BasicAttack) Cancel() {
 	a.basicAttackTempData = basicAttackTempData{}
 }
 
+func (a *BasicAttack) IsExec(exec game.ActionExec) bool {
+	_, ok := exec.(*basicAttackExec)
+	return ok
+}
+
 func (a *BasicAttack) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.MaintenanceStatus {
 	if ae != nil {
 		a.exec = ae.(*basicAttackExec)
@@ -417,6 +417,11 @@ func (a *Interact) Cancel() {
 	a.interactInst = interactInst{}
 }
 
+func (a *Interact) IsExec(exec game.ActionExec) bool {
+	_, ok := exec.(*interactExec)
+	return ok
+}
+
 func (a *Interact) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.MaintenanceStatus {
 	if ae != nil {
 		exec := ae.(*interactExec)
@@ -328,6 +328,11 @@ func (a *Move) Cancel() {
 	a.calculated = false
 }
 
+func (a *Move) IsExec(exec game.ActionExec) bool {
+	_, ok := exec.(*moveExec)
+	return ok
+}
+
 func (a *Move) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.MaintenanceStatus {
 	if ae != nil {
 		exec := ae.(*moveExec)
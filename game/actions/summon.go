@@ -208,6 +208,11 @@ func (a *SummonAction) Cancel() {
 	a.summonActionTempData = summonActionTempData{}
 }
 
+func (a *SummonAction) IsExec(exec game.ActionExec) bool {
+	_, ok := exec.(*summonExec)
+	return ok
+}
+
 func (a *SummonAction) Maintain(dt int64, g *game.Game, ae game.ActionExec) game.MaintenanceStatus {
 	if ae != nil {
 		exec := ae.(*summonExec)
@@ -53,6 +53,14 @@ type Ai struct {
 	pause chan struct{}
 	execs chan game.ActionExec
 
+	// Set while Think() is running if Ais are being traced, see
+	// game.AiTrace. Only touched by the goroutine running Think().
+	tracer *game.AiTracer
+
+	// Set while Think() is running, see watchdog. Only touched by the
+	// goroutine running Think().
+	watchdog *watchdog
+
 	// This exists so that we can gob this without error.  Gob doesn't like
 	// gobbing things that don't have any exported fields, and since we might
 	// want exported fields later we'll just have this here for now so we can
@@ -66,6 +74,15 @@ func init() {
 }
 
 func makeAi(path string, g *game.Game, ent *game.Entity, dst_iface *game.Ai, kind game.AiKind) {
+	if name, ok := goAiName(path); ok {
+		make_go_ai, ok := goAis[name]
+		if !ok {
+			base.DeprecatedError().Printf("Unable to make ai: there's no Go ai named '%s'", name)
+			return
+		}
+		*dst_iface = make_go_ai(g, ent, kind)
+		return
+	}
 	ai_struct := new(Ai)
 	ai_struct.path = path
 	var err error
@@ -108,7 +125,7 @@ func (a *Ai) setupLuaState() error {
 	a.Prog = string(prog)
 	a.watcher.Add(a.path)
 	a.L = lua.NewState()
-	a.L.OpenLibs()
+	game.LuaOpenLibs(a.L, game.LuaSandboxed(a.path))
 	switch a.kind {
 	case game.EntityAi:
 		a.addEntityContext()
@@ -136,7 +153,7 @@ func (a *Ai) setupLuaState() error {
 		panic("Unknown ai kind")
 	}
 	// Add this to all contexts
-	a.L.Register("print", func(L *lua.State) int {
+	a.L.Register("print", a.traced("print", func(L *lua.State) int {
 		var res string
 		n := L.GetTop()
 		for i := -n; i < 0; i++ {
@@ -144,8 +161,8 @@ func (a *Ai) setupLuaState() error {
 		}
 		base.DeprecatedLog().Printf("Ai(%p): %s", a, res)
 		return 0
-	})
-	a.L.Register("randN", func(L *lua.State) int {
+	}))
+	a.L.Register("randN", a.traced("randN", func(L *lua.State) int {
 		n := L.GetTop()
 		if n == 0 || !L.IsNumber(-1) {
 			L.PushInteger(0)
@@ -158,7 +175,7 @@ func (a *Ai) setupLuaState() error {
 		}
 		L.PushInteger(int64(rand.Intn(val)) + 1)
 		return 1
-	})
+	}))
 	a.L.DoString(a.Prog)
 	return nil
 }
@@ -231,13 +248,23 @@ func (a *Ai) masterRoutine() {
 						base.DeprecatedLog().Printf("Eval ent: %p", a.ent)
 					}
 					base.DeprecatedLog().Printf("Evaluating lua script: %s", a.Prog)
-					// Reset the execution limit in case it was set to 0 due to a
-					// previous error
-					a.L.SetExecutionLimit(2500000)
+					a.tracer = a.game.StartAiTrace(a.ent, a.kind, a.path)
+					// This also resets the execution limit in case it was set to 0 due
+					// to a previous error
+					a.watchdog = startWatchdog(a.L, aiInstructionBudget, aiTimeBudget)
 
 					// DoString will panic, and we can catch that, calling it manually
 					// will exit() if it fails, which we cannot catch
-					a.L.DoString("Think()")
+					err := a.L.DoString("Think()")
+					over_budget, err := a.watchdog.stop(err)
+					a.watchdog = nil
+					a.tracer.Finish(err)
+					a.tracer = nil
+					if over_budget {
+						// Nothing of the script's can be trusted to carry on from where
+						// it was cut off, so it gets no more out of this turn.
+						a.game.ReportAiError(a.ent, a.kind, err)
+					}
 					if a.ent == nil {
 						base.DeprecatedLog().Printf("Completed master")
 					} else {
@@ -8,10 +8,10 @@ import (
 )
 
 func (a *Ai) addDenizensContext() {
-	a.L.Register("IsActive", isActiveDenizen(a))
-	a.L.Register("ExecDenizen", execDenizen(a))
-	a.L.Register("SetEntityMasterInfo", setDenizenMasterInfo(a))
-	a.L.Register("AllDenizens", allDenizens(a))
+	a.L.Register("IsActive", a.traced("IsActive", isActiveDenizen(a)))
+	a.L.Register("ExecDenizen", a.traced("ExecDenizen", execDenizen(a)))
+	a.L.Register("SetEntityMasterInfo", a.traced("SetEntityMasterInfo", setDenizenMasterInfo(a)))
+	a.L.Register("AllDenizens", a.traced("AllDenizens", allDenizens(a)))
 }
 
 func isActiveDenizen(a *Ai) lua.LuaGoFunction {
@@ -96,11 +96,17 @@ func execDenizen(a *Ai) lua.LuaGoFunction {
 			game.LuaDoError(L, fmt.Sprintf("Tried to ExecDenizen '%s', who is not active.", ent.Name))
 			return 0
 		}
+		// Waiting on another Ai doesn't count against this one's budget.
+		a.watchdog.pause()
 		exec := <-ent.Ai.ActionExecs()
+		a.watchdog.resume()
 		if exec != nil {
-			a.execs <- exec
+			a.doExec(exec)
+		} else {
+			a.watchdog.pause()
+			<-a.pause
+			a.watchdog.resume()
 		}
-		<-a.pause
 		return 0
 	}
 }
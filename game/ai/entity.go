@@ -20,43 +20,43 @@ func (a *Ai) addEntityContext() {
 	a.L.SetGlobal("Me")
 
 	a.L.NewTable()
-	game.LuaPushSmartFunctionTable(a.L, game.FunctionTable{
-		"BasicAttack":        func() { a.L.PushGoFunction(DoBasicAttackFunc(a)) },
-		"AoeAttack":          func() { a.L.PushGoFunction(DoAoeAttackFunc(a)) },
-		"Move":               func() { a.L.PushGoFunction(DoMoveFunc(a)) },
-		"DoorToggle":         func() { a.L.PushGoFunction(DoDoorToggleFunc(a)) },
-		"InteractWithObject": func() { a.L.PushGoFunction(DoInteractWithObjectFunc(a)) },
-	})
+	game.LuaPushSmartFunctionTable(a.L, a.tracedFunctionTable("Do", map[string]func() lua.LuaGoFunction{
+		"BasicAttack":        func() lua.LuaGoFunction { return DoBasicAttackFunc(a) },
+		"AoeAttack":          func() lua.LuaGoFunction { return DoAoeAttackFunc(a) },
+		"Move":               func() lua.LuaGoFunction { return DoMoveFunc(a) },
+		"DoorToggle":         func() lua.LuaGoFunction { return DoDoorToggleFunc(a) },
+		"InteractWithObject": func() lua.LuaGoFunction { return DoInteractWithObjectFunc(a) },
+	}))
 	a.L.SetMetaTable(-2)
 	a.L.SetGlobal("Do")
 
 	a.L.NewTable()
-	game.LuaPushSmartFunctionTable(a.L, game.FunctionTable{
-		"AllPathablePoints":          func() { a.L.PushGoFunction(AllPathablePointsFunc(a)) },
-		"RangedDistBetweenPositions": func() { a.L.PushGoFunction(RangedDistBetweenPositionsFunc(a)) },
-		"RangedDistBetweenEntities":  func() { a.L.PushGoFunction(RangedDistBetweenEntitiesFunc(a)) },
-		"NearestNEntities":           func() { a.L.PushGoFunction(NearestNEntitiesFunc(a.ent)) },
-		"Waypoints":                  func() { a.L.PushGoFunction(WaypointsFunc(a.ent)) },
-		"Exists":                     func() { a.L.PushGoFunction(ExistsFunc(a)) },
-		"BestAoeAttackPos":           func() { a.L.PushGoFunction(BestAoeAttackPosFunc(a)) },
-		"NearbyUnexploredRooms":      func() { a.L.PushGoFunction(NearbyUnexploredRoomsFunc(a)) },
-		"RoomPath":                   func() { a.L.PushGoFunction(RoomPathFunc(a)) },
-		"RoomContaining":             func() { a.L.PushGoFunction(RoomContainingFunc(a)) },
-		"RoomsAreEqual":              func() { a.L.PushGoFunction(RoomAreEqualFunc(a)) },
-		"AllDoorsBetween":            func() { a.L.PushGoFunction(AllDoorsBetween(a)) },
-		"AllDoorsOn":                 func() { a.L.PushGoFunction(AllDoorsOn(a)) },
-		"DoorPositions":              func() { a.L.PushGoFunction(DoorPositionsFunc(a)) },
-		"DoorIsOpen":                 func() { a.L.PushGoFunction(DoorIsOpenFunc(a)) },
-		"RoomPositions":              func() { a.L.PushGoFunction(RoomPositionsFunc(a)) },
-		"Rand":                       func() { a.L.PushGoFunction(randFunc(a)) },
-	})
+	game.LuaPushSmartFunctionTable(a.L, a.tracedFunctionTable("Utils", map[string]func() lua.LuaGoFunction{
+		"AllPathablePoints":          func() lua.LuaGoFunction { return AllPathablePointsFunc(a) },
+		"RangedDistBetweenPositions": func() lua.LuaGoFunction { return RangedDistBetweenPositionsFunc(a) },
+		"RangedDistBetweenEntities":  func() lua.LuaGoFunction { return RangedDistBetweenEntitiesFunc(a) },
+		"NearestNEntities":           func() lua.LuaGoFunction { return NearestNEntitiesFunc(a.ent) },
+		"Waypoints":                  func() lua.LuaGoFunction { return WaypointsFunc(a.ent) },
+		"Exists":                     func() lua.LuaGoFunction { return ExistsFunc(a) },
+		"BestAoeAttackPos":           func() lua.LuaGoFunction { return BestAoeAttackPosFunc(a) },
+		"NearbyUnexploredRooms":      func() lua.LuaGoFunction { return NearbyUnexploredRoomsFunc(a) },
+		"RoomPath":                   func() lua.LuaGoFunction { return RoomPathFunc(a) },
+		"RoomContaining":             func() lua.LuaGoFunction { return RoomContainingFunc(a) },
+		"RoomsAreEqual":              func() lua.LuaGoFunction { return RoomAreEqualFunc(a) },
+		"AllDoorsBetween":            func() lua.LuaGoFunction { return AllDoorsBetween(a) },
+		"AllDoorsOn":                 func() lua.LuaGoFunction { return AllDoorsOn(a) },
+		"DoorPositions":              func() lua.LuaGoFunction { return DoorPositionsFunc(a) },
+		"DoorIsOpen":                 func() lua.LuaGoFunction { return DoorIsOpenFunc(a) },
+		"RoomPositions":              func() lua.LuaGoFunction { return RoomPositionsFunc(a) },
+		"Rand":                       func() lua.LuaGoFunction { return randFunc(a) },
+	}))
 	a.L.SetMetaTable(-2)
 	a.L.SetGlobal("Utils")
 
 	a.L.NewTable()
-	game.LuaPushSmartFunctionTable(a.L, game.FunctionTable{
-		"GetEntsByName": func() { a.L.PushGoFunction(GetEntsByName(a)) },
-	})
+	game.LuaPushSmartFunctionTable(a.L, a.tracedFunctionTable("Cheat", map[string]func() lua.LuaGoFunction{
+		"GetEntsByName": func() lua.LuaGoFunction { return GetEntsByName(a) },
+	}))
 	a.L.SetMetaTable(-2)
 	a.L.SetGlobal("Cheat")
 }
@@ -126,36 +126,8 @@ func AllPathablePointsFunc(a *Ai) lua.LuaGoFunction {
 		x1, y1 := house.BoardSpaceUnitPair(game.LuaToPoint(L, -4))
 		x2, y2 := house.BoardSpaceUnitPair(game.LuaToPoint(L, -3))
 
-		a.ent.Game().DetermineLos(x2, y2, max, grid)
-		var dst []int
-		for x := x2 - max; x <= x2+max; x++ {
-			for y := y2 - max; y <= y2+max; y++ {
-				if x > x2-min && x < x2+min && y > y2-min && y < y2+min {
-					continue
-				}
-				if x < 0 || y < 0 || int(x) >= len(grid) || int(y) >= len(grid[0]) {
-					continue
-				}
-				if !grid[x][y] {
-					continue
-				}
-				dst = append(dst, a.ent.Game().ToVertex(x, y))
-			}
-		}
-		vis := 0
-		for i := range grid {
-			for j := range grid[i] {
-				if grid[i][j] {
-					vis++
-				}
-			}
-		}
-		base.DeprecatedLog().Printf("Visible: %d", vis)
-		graph := a.ent.Game().Graph(a.ent.Side(), true, nil)
-		src := []int{a.ent.Game().ToVertex(x1, y1)}
-		reachable := algorithm.ReachableDestinations(graph, src, dst)
+		reachable := allPathablePoints(a.ent, x1, y1, x2, y2, min, max)
 		L.NewTable()
-		base.DeprecatedLog().Printf("%d/%d reachable from (%d, %d) -> (%d, %d)", len(reachable), len(dst), x1, y1, x2, y2)
 		for i, v := range reachable {
 			_, bsux, bsuy := a.ent.Game().FromVertex(v)
 			x, y := int(bsux), int(bsuy)
@@ -167,6 +139,43 @@ func AllPathablePointsFunc(a *Ai) lua.LuaGoFunction {
 	}
 }
 
+// Returns the vertices that 'ent' could walk to from (x1, y1) that are
+// visible from (x2, y2) and between min and max from it, see
+// AllPathablePointsFunc.
+func allPathablePoints(ent *game.Entity, x1, y1, x2, y2, min, max house.BoardSpaceUnit) []int {
+	g := ent.Game()
+	g.DetermineLos(x2, y2, max, grid)
+	var dst []int
+	for x := x2 - max; x <= x2+max; x++ {
+		for y := y2 - max; y <= y2+max; y++ {
+			if x > x2-min && x < x2+min && y > y2-min && y < y2+min {
+				continue
+			}
+			if x < 0 || y < 0 || int(x) >= len(grid) || int(y) >= len(grid[0]) {
+				continue
+			}
+			if !grid[x][y] {
+				continue
+			}
+			dst = append(dst, g.ToVertex(x, y))
+		}
+	}
+	vis := 0
+	for i := range grid {
+		for j := range grid[i] {
+			if grid[i][j] {
+				vis++
+			}
+		}
+	}
+	base.DeprecatedLog().Printf("Visible: %d", vis)
+	graph := g.Graph(ent.Side(), true, nil)
+	src := []int{g.ToVertex(x1, y1)}
+	reachable := algorithm.ReachableDestinations(graph, src, dst)
+	base.DeprecatedLog().Printf("%d/%d reachable from (%d, %d) -> (%d, %d)", len(reachable), len(dst), x1, y1, x2, y2)
+	return reachable
+}
+
 // Performs a basic attack against the specifed target.
 //
 //	Format:
@@ -204,8 +213,7 @@ func DoBasicAttackFunc(a *Ai) lua.LuaGoFunction {
 		}
 		exec := attack.AiAttackTarget(me, target)
 		if exec != nil {
-			a.execs <- exec
-			<-a.pause
+			a.doExec(exec)
 			result := actions.GetBasicAttackResult(exec)
 			if result == nil {
 				L.PushNil()
@@ -253,8 +261,7 @@ func DoAoeAttackFunc(a *Ai) lua.LuaGoFunction {
 		tx, ty := house.BoardSpaceUnitPair(game.LuaToPoint(L, -1))
 		exec := attack.AiAttackPosition(me, tx, ty)
 		if exec != nil {
-			a.execs <- exec
-			<-a.pause
+			a.doExec(exec)
 			L.PushBoolean(true)
 		} else {
 			L.PushNil()
@@ -372,8 +379,7 @@ func DoMoveFunc(a *Ai) lua.LuaGoFunction {
 		}
 		exec := move.AiMoveToPos(me, dsts, max_ap)
 		if exec != nil {
-			a.execs <- exec
-			<-a.pause
+			a.doExec(exec)
 			// TODO: Need to get a resolution
 			x, y := me.FloorPos()
 			v := me.Game().ToVertex(x, y)
@@ -525,7 +531,6 @@ func NearestNEntitiesFunc(me *game.Entity) lua.LuaGoFunction {
 		if !game.LuaCheckParamsOk(L, "NearestNEntities", game.LuaInteger, game.LuaString) {
 			return 0
 		}
-		g := me.Game()
 		max := L.ToInteger(-2)
 		kind := L.ToString(-1)
 		if !valid_kinds[kind] {
@@ -536,66 +541,76 @@ func NearestNEntitiesFunc(me *game.Entity) lua.LuaGoFunction {
 			// L.Error()
 			panic(errors.New(err_str))
 		}
-		var eds entityDistSlice
-		for _, ent := range g.Ents {
-			if ent.Stats != nil && ent.Stats.HpCur() <= 0 {
-				continue
-			}
-			switch kind {
-			case "intruder":
-				if ent.Side() != game.SideExplorers {
-					continue
-				}
-			case "denizen":
-				if ent.Side() != game.SideHaunt {
-					continue
-				}
-			case "minion":
-				if ent.HauntEnt == nil || ent.HauntEnt.Level != game.LevelMinion {
-					continue
-				}
-			case "servitor":
-				if ent.HauntEnt == nil || ent.HauntEnt.Level != game.LevelServitor {
-					continue
-				}
-			case "master":
-				if ent.HauntEnt == nil || ent.HauntEnt.Level != game.LevelMaster {
-					continue
-				}
-			case "object":
-				if ent.ObjectEnt == nil {
-					continue
-				}
-			}
-			x, y := ent.FloorPos()
-			dx, dy := ent.Dims()
-			if !me.HasTeamLos(x, y, dx, dy) {
-				continue
-			}
-			eds = append(eds, entityDist{rangedDistBetween(me, ent), ent})
-		}
-		// TODO: ONLY GUYS THAT EXIST
-		sort.Sort(eds)
-		if max > len(eds) {
-			max = len(eds)
-		}
-		if max < 0 {
-			max = 0
-		}
-		eds = eds[0:max]
+		ents := nearestNEntities(me, max, kind)
 
-		// eds contains the results, in order.  Now we make a lua table and
+		// ents contains the results, in order.  Now we make a lua table and
 		// populate it with the entity ids of the results.
 		L.NewTable()
-		for i := range eds {
+		for i := range ents {
 			L.PushInteger(int64(i) + 1)
-			game.LuaPushEntity(L, eds[i].ent)
+			game.LuaPushEntity(L, ents[i])
 			L.SetTable(-3)
 		}
 		return 1
 	}
 }
 
+// Returns up to 'max' of the living entities of 'kind' that 'me' or its team
+// can see, nearest first, see NearestNEntitiesFunc.
+func nearestNEntities(me *game.Entity, max int, kind string) []*game.Entity {
+	var eds entityDistSlice
+	for _, ent := range me.Game().Ents {
+		if ent.Stats != nil && ent.Stats.HpCur() <= 0 {
+			continue
+		}
+		switch kind {
+		case "intruder":
+			if ent.Side() != game.SideExplorers {
+				continue
+			}
+		case "denizen":
+			if ent.Side() != game.SideHaunt {
+				continue
+			}
+		case "minion":
+			if ent.HauntEnt == nil || ent.HauntEnt.Level != game.LevelMinion {
+				continue
+			}
+		case "servitor":
+			if ent.HauntEnt == nil || ent.HauntEnt.Level != game.LevelServitor {
+				continue
+			}
+		case "master":
+			if ent.HauntEnt == nil || ent.HauntEnt.Level != game.LevelMaster {
+				continue
+			}
+		case "object":
+			if ent.ObjectEnt == nil {
+				continue
+			}
+		}
+		x, y := ent.FloorPos()
+		dx, dy := ent.Dims()
+		if !me.HasTeamLos(x, y, dx, dy) {
+			continue
+		}
+		eds = append(eds, entityDist{rangedDistBetween(me, ent), ent})
+	}
+	// TODO: ONLY GUYS THAT EXIST
+	sort.Sort(eds)
+	if max > len(eds) {
+		max = len(eds)
+	}
+	if max < 0 {
+		max = 0
+	}
+	ents := make([]*game.Entity, max)
+	for i := range ents {
+		ents[i] = eds[i].ent
+	}
+	return ents
+}
+
 func WaypointsFunc(me *game.Entity) lua.LuaGoFunction {
 	return func(L *lua.State) int {
 		if !game.LuaCheckParamsOk(L, "Waypoints") {
@@ -995,8 +1010,7 @@ func DoDoorToggleFunc(a *Ai) lua.LuaGoFunction {
 		}
 		exec := interact.AiToggleDoor(a.ent, door)
 		if exec != nil {
-			a.execs <- exec
-			<-a.pause
+			a.doExec(exec)
 			L.PushBoolean(door.IsOpened())
 		} else {
 			L.PushNil()
@@ -1026,8 +1040,7 @@ func DoInteractWithObjectFunc(a *Ai) lua.LuaGoFunction {
 		}
 		exec := interact.AiInteractWithObject(a.ent, object)
 		if exec != nil {
-			a.execs <- exec
-			<-a.pause
+			a.doExec(exec)
 			L.PushBoolean(true)
 		} else {
 			L.PushNil()
@@ -0,0 +1,7 @@
+package ai
+
+var BestExec = bestExec
+
+var AttackScore = attackScore
+
+var Approach = approach
@@ -8,10 +8,10 @@ import (
 )
 
 func (a *Ai) addIntrudersContext() {
-	a.L.Register("IsActive", isActiveIntruder(a))
-	a.L.Register("ExecIntruder", execIntruder(a))
-	a.L.Register("SetEntityMasterInfo", setIntruderMasterInfo(a))
-	a.L.Register("AllIntruders", allIntruders(a))
+	a.L.Register("IsActive", a.traced("IsActive", isActiveIntruder(a)))
+	a.L.Register("ExecIntruder", a.traced("ExecIntruder", execIntruder(a)))
+	a.L.Register("SetEntityMasterInfo", a.traced("SetEntityMasterInfo", setIntruderMasterInfo(a)))
+	a.L.Register("AllIntruders", a.traced("AllIntruders", allIntruders(a)))
 }
 
 func isActiveIntruder(a *Ai) lua.LuaGoFunction {
@@ -96,11 +96,17 @@ func execIntruder(a *Ai) lua.LuaGoFunction {
 			game.LuaDoError(L, fmt.Sprintf("Tried to ExecIntruder '%s', who is not active.", ent.Name))
 			return 0
 		}
+		// Waiting on another Ai doesn't count against this one's budget.
+		a.watchdog.pause()
 		exec := <-ent.Ai.ActionExecs()
+		a.watchdog.resume()
 		if exec != nil {
-			a.execs <- exec
+			a.doExec(exec)
+		} else {
+			a.watchdog.pause()
+			<-a.pause
+			a.watchdog.resume()
 		}
-		<-a.pause
 		return 0
 	}
 }
@@ -8,10 +8,10 @@ import (
 )
 
 func (a *Ai) addMinionsContext() {
-	a.L.Register("IsActive", isActiveMinion(a))
-	a.L.Register("ExecMinion", execMinion(a))
-	a.L.Register("SetEntityMasterInfo", setMinionMasterInfo(a))
-	a.L.Register("AllMinions", allMinions(a))
+	a.L.Register("IsActive", a.traced("IsActive", isActiveMinion(a)))
+	a.L.Register("ExecMinion", a.traced("ExecMinion", execMinion(a)))
+	a.L.Register("SetEntityMasterInfo", a.traced("SetEntityMasterInfo", setMinionMasterInfo(a)))
+	a.L.Register("AllMinions", a.traced("AllMinions", allMinions(a)))
 }
 
 func isActiveMinion(a *Ai) lua.LuaGoFunction {
@@ -96,11 +96,17 @@ func execMinion(a *Ai) lua.LuaGoFunction {
 			game.LuaDoError(L, fmt.Sprintf("Tried to ExecMinion '%s', who is not active.", ent.Name))
 			return 0
 		}
+		// Waiting on another Ai doesn't count against this one's budget.
+		a.watchdog.pause()
 		exec := <-ent.Ai.ActionExecs()
+		a.watchdog.resume()
 		if exec != nil {
-			a.execs <- exec
+			a.doExec(exec)
+		} else {
+			a.watchdog.pause()
+			<-a.pause
+			a.watchdog.resume()
 		}
-		<-a.pause
 		return 0
 	}
 }
@@ -0,0 +1,130 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/game"
+)
+
+// Wraps 'f', which gets exposed to scripts as 'name', so that calls to it are
+// noted in the trace of whatever evaluation is underway, see game.AiTrace.
+func (a *Ai) traced(name string, f lua.LuaGoFunction) lua.LuaGoFunction {
+	return func(L *lua.State) int {
+		t := a.tracer
+		if t == nil {
+			return f(L)
+		}
+		args := luaTraceValues(L, 1, L.GetTop())
+		at := t.Elapsed()
+		start := time.Now()
+		n := f(L)
+		dur := time.Since(start)
+		top := L.GetTop()
+		t.AddCall(game.AiTraceCall{
+			Func:     name,
+			Args:     args,
+			Results:  luaTraceValues(L, top-n+1, top),
+			At:       at,
+			Duration: dur,
+		})
+		return n
+	}
+}
+
+// Like game.FunctionTable, but every function is traced as
+// '<prefix>.<name>'.
+func (a *Ai) tracedFunctionTable(prefix string, funcs map[string]func() lua.LuaGoFunction) game.FunctionTable {
+	table := make(game.FunctionTable, len(funcs))
+	for name, f := range funcs {
+		table[name] = func() { a.L.PushGoFunction(a.traced(prefix+"."+name, f())) }
+	}
+	return table
+}
+
+// Hands 'exec' to the game and waits until the game is done with it.
+func (a *Ai) doExec(exec game.ActionExec) {
+	at := a.tracer.Elapsed()
+	start := time.Now()
+	a.watchdog.pause()
+	a.execs <- exec
+	<-a.pause
+	a.watchdog.resume()
+	a.tracer.AddExec(exec, at, time.Since(start))
+}
+
+// How deep into nested tables, and how far into each one, values get
+// described in traces.
+const (
+	maxTraceDepth   = 2
+	maxTraceEntries = 8
+)
+
+func luaTraceValues(L *lua.State, first, last int) []string {
+	var vals []string
+	for i := first; i <= last; i++ {
+		if i < 1 {
+			continue
+		}
+		vals = append(vals, luaTraceValue(L, i, 0))
+	}
+	return vals
+}
+
+// Describes the value at 'index', which has to be an absolute index, without
+// changing anything on the stack.
+func luaTraceValue(L *lua.State, index int, depth int) string {
+	switch L.Type(index) {
+	case lua.LUA_TNIL, lua.LUA_TNONE:
+		return "nil"
+	case lua.LUA_TBOOLEAN:
+		return fmt.Sprint(L.ToBoolean(index))
+	case lua.LUA_TNUMBER:
+		return fmt.Sprint(L.ToNumber(index))
+	case lua.LUA_TSTRING:
+		return fmt.Sprintf("%q", L.ToString(index))
+	case lua.LUA_TTABLE:
+	default:
+		return L.Typename(int(L.Type(index)))
+	}
+
+	// Entities, see game.LuaPushEntity, are far more useful by name. Lookups
+	// are raw so that nothing in a metatable gets called.
+	rawField := func(k string) {
+		L.PushString(k)
+		L.RawGet(index)
+	}
+	rawField("type")
+	kind := L.ToString(-1)
+	L.Pop(1)
+	if kind == "Entity" {
+		rawField("Name")
+		name := L.ToString(-1)
+		L.Pop(1)
+		rawField("id")
+		id := L.ToInteger(-1)
+		L.Pop(1)
+		return fmt.Sprintf("Entity(%s #%d)", name, id)
+	}
+	if depth >= maxTraceDepth {
+		return "{...}"
+	}
+
+	var entries []string
+	L.PushNil()
+	for L.Next(index) != 0 {
+		if len(entries) == maxTraceEntries {
+			entries = append(entries, "...")
+			L.Pop(2)
+			break
+		}
+		top := L.GetTop()
+		// Keys get converted by ToString, which would throw Next off, so they
+		// only ever get described through luaTraceValue.
+		entries = append(entries, luaTraceValue(L, top-1, depth+1)+"="+luaTraceValue(L, top, depth+1))
+		L.Pop(1)
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
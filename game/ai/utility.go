@@ -0,0 +1,306 @@
+package ai
+
+import (
+	"encoding/gob"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/actions"
+	"github.com/MobRulesGames/haunts/game/status"
+	"github.com/MobRulesGames/haunts/house"
+)
+
+// Ais written in Go instead of Lua, chosen with an Ai path of "go:<name>",
+// either as an entity's Ai_path or in Script.BindAi, e.g.
+//
+//	Script.BindAi("intruder", "go:utility")
+//	Script.BindAi(ent, "go:utility")
+var goAis = map[string]func(g *game.Game, ent *game.Entity, kind game.AiKind) game.Ai{
+	"utility": makeUtilityAi,
+}
+
+// Returns the name of the Go Ai that 'path' asks for, if it asks for one.
+// Paths have usually had the data directory put in front of them by now, so
+// only the last element counts.
+func goAiName(path string) (string, bool) {
+	return strings.CutPrefix(filepath.Base(path), "go:")
+}
+
+// An entity will try at most this many execs a turn, in case one of them
+// turns out not to cost anything and would otherwise be tried forever.
+const maxUtilityExecs = 25
+
+// A baseline Ai that needs no scripts. Each time it's asked for an exec it
+// scores every attack its entities could make right now, by how much damage
+// it's expected to do for the Ap, and takes the best one. If there's nothing
+// to attack it moves towards the nearest enemy it can see, or its side's
+// waypoint, or failing both the nearest enemy anywhere, keeping back enough
+// Ap to attack when it gets there.
+//
+// As a master Ai, for "denizen", "intruder" or "minions", it plays every
+// entity of its kind itself, whatever Ais those entities have of their own.
+//
+// Unlike the Lua Ais it decides right away, on whichever goroutine asks it,
+// rather than on a goroutine of its own; it's quick enough not to hold up a
+// frame.
+type utilityAi struct {
+	game *game.Game
+
+	// The entity this Ai plays, nil for a master Ai.
+	ent  *game.Entity
+	kind game.AiKind
+
+	mu     sync.Mutex
+	active bool
+	execs  map[game.EntityId]int
+	done   map[game.EntityId]bool
+
+	// So that gob has something to encode, see Ai.
+	Dummy int
+}
+
+func init() {
+	gob.Register(&utilityAi{})
+}
+
+func makeUtilityAi(g *game.Game, ent *game.Entity, kind game.AiKind) game.Ai {
+	return &utilityAi{game: g, ent: ent, kind: kind}
+}
+
+func (u *utilityAi) Terminate() {}
+
+func (u *utilityAi) Activate() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.active = true
+	u.execs = make(map[game.EntityId]int)
+	u.done = make(map[game.EntityId]bool)
+}
+
+func (u *utilityAi) Active() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.active
+}
+
+func (u *utilityAi) ActionExecs() <-chan game.ActionExec {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	execs := make(chan game.ActionExec, 1)
+	var exec game.ActionExec
+	if u.active {
+		exec = u.next()
+	}
+	if exec == nil {
+		u.active = false
+	}
+	execs <- exec
+	return execs
+}
+
+func (u *utilityAi) GobDecode([]byte) error {
+	return nil
+}
+
+func (u *utilityAi) GobEncode() ([]byte, error) {
+	return nil, nil
+}
+
+// The entities this Ai plays.
+func (u *utilityAi) ents() []*game.Entity {
+	if u.ent != nil {
+		return []*game.Entity{u.ent}
+	}
+	var ents []*game.Entity
+	for _, ent := range u.game.Ents {
+		minion := ent.HauntEnt != nil && ent.HauntEnt.Level == game.LevelMinion
+		switch u.kind {
+		case game.MinionsAi:
+			if !minion {
+				continue
+			}
+		case game.DenizensAi:
+			if ent.Side() != game.SideHaunt || minion {
+				continue
+			}
+		case game.IntrudersAi:
+			if ent.Side() != game.SideExplorers {
+				continue
+			}
+		}
+		ents = append(ents, ent)
+	}
+	return ents
+}
+
+func (u *utilityAi) next() game.ActionExec {
+	for _, ent := range u.ents() {
+		if u.done[ent.Id] {
+			continue
+		}
+		if u.execs[ent.Id] < maxUtilityExecs && ent.Stats != nil && ent.Stats.HpCur() > 0 && ent.Stats.ApCur() > 0 {
+			if exec := bestExec(ent); exec != nil {
+				u.execs[ent.Id]++
+				return exec
+			}
+		}
+		u.done[ent.Id] = true
+	}
+	return nil
+}
+
+// Returns the exec that 'me' should do next, or nil if there's nothing worth
+// doing.
+func bestExec(me *game.Entity) game.ActionExec {
+	enemy := "denizen"
+	if me.Side() == game.SideHaunt {
+		enemy = "intruder"
+	}
+	enemies := nearestNEntities(me, 10, enemy)
+
+	var best game.ActionExec
+	best_score := 0.0
+	consider := func(exec game.ActionExec, score float64) {
+		if exec != nil && score > best_score {
+			best, best_score = exec, score
+		}
+	}
+	ap := me.Stats.ApCur()
+	for _, action := range me.Actions {
+		switch a := action.(type) {
+		case *actions.BasicAttack:
+			if a.Ap > ap || a.Current_ammo == 0 || !a.Target_enemies {
+				continue
+			}
+			for _, target := range enemies {
+				score := attackScore(me, target, a.Strength, a.Damage, a.Kind) / float64(max(a.Ap, 1))
+				consider(a.AiAttackTarget(me, target), score)
+			}
+
+		case *actions.AoeAttack:
+			if a.Ap > ap || a.Current_ammo == 0 {
+				continue
+			}
+			x, y, hits := a.AiBestTarget(me, 0, actions.AiAoeHitNoAllies)
+			score := 0.0
+			for _, target := range hits {
+				if target.Side() != me.Side() {
+					score += attackScore(me, target, a.Strength, a.Damage, a.Kind)
+				}
+			}
+			if score > 0 {
+				consider(a.AiAttackPosition(me, x, y), score/float64(max(a.Ap, 1)))
+			}
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return approach(me, enemies)
+}
+
+// How much damage an attack on 'target' can be expected to do, with a bit
+// extra if it might finish them off.
+func attackScore(me, target *game.Entity, strength, damage int, kind status.Kind) float64 {
+	if target.Stats == nil || damage <= 0 {
+		return 0
+	}
+	// Attacks hit on strength + bonus + 1d10 >= defense, see Game.DoAttack.
+	need := target.Stats.DefenseVs(kind) - strength - me.Stats.AttackBonusWith(kind)
+	chance := float64(11-need) / 10
+	chance = min(max(chance, 0), 1)
+	hp := target.Stats.HpCur()
+	score := chance * float64(min(damage, hp))
+	if damage >= hp {
+		score += chance * 5
+	}
+	return score
+}
+
+// Moves 'me' towards somewhere it might get to attack from, see utilityAi.
+func approach(me *game.Entity, enemies []*game.Entity) game.ActionExec {
+	var move *actions.Move
+	reach := house.BoardSpaceUnit(1)
+	reserve := 0
+	for _, action := range me.Actions {
+		switch a := action.(type) {
+		case *actions.Move:
+			move = a
+		case *actions.BasicAttack:
+			if a.Current_ammo != 0 && a.Target_enemies {
+				reach = max(reach, a.Range)
+				if reserve == 0 || a.Ap < reserve {
+					reserve = a.Ap
+				}
+			}
+		case *actions.AoeAttack:
+			if a.Current_ammo != 0 {
+				reach = max(reach, a.Range)
+				if reserve == 0 || a.Ap < reserve {
+					reserve = a.Ap
+				}
+			}
+		}
+	}
+	if move == nil {
+		return nil
+	}
+
+	mx, my := me.FloorPos()
+	var dsts []int
+	if len(enemies) > 0 {
+		tx, ty := enemies[0].FloorPos()
+		dsts = allPathablePoints(me, mx, my, tx, ty, 1, reach)
+	} else if wp := nearestWaypoint(me); wp != nil {
+		dsts = allPathablePoints(me, mx, my, house.BoardSpaceUnit(wp.X), house.BoardSpaceUnit(wp.Y), 0, house.BoardSpaceUnit(wp.Radius))
+	} else if target := nearestEnemyAnywhere(me); target != nil {
+		tx, ty := target.FloorPos()
+		dsts = allPathablePoints(me, mx, my, tx, ty, 1, reach)
+	}
+	if len(dsts) == 0 {
+		return nil
+	}
+	ap := me.Stats.ApCur()
+	if ap > reserve && len(enemies) > 0 {
+		ap -= reserve
+	}
+	return move.AiMoveToPos(me, dsts, ap)
+}
+
+func nearestWaypoint(me *game.Entity) *game.Waypoint {
+	var best *game.Waypoint
+	best_dist := 0.0
+	mx, my := me.FPos()
+	for i, wp := range me.Game().Waypoints {
+		if wp.Side != me.Side() {
+			continue
+		}
+		dist := (wp.X-mx)*(wp.X-mx) + (wp.Y-my)*(wp.Y-my)
+		if best == nil || dist < best_dist {
+			best, best_dist = &me.Game().Waypoints[i], dist
+		}
+	}
+	return best
+}
+
+func nearestEnemyAnywhere(me *game.Entity) *game.Entity {
+	var best *game.Entity
+	for _, ent := range me.Game().Ents {
+		if ent.Side() == me.Side() || (ent.Side() != game.SideHaunt && ent.Side() != game.SideExplorers) {
+			continue
+		}
+		if ent.Stats == nil || ent.Stats.HpCur() <= 0 {
+			continue
+		}
+		if best == nil || rangedDistBetween(me, ent) < rangedDistBetween(me, best) {
+			best = ent
+		}
+	}
+	if best == nil {
+		base.DeprecatedLog().Printf("No enemies left for '%s' to approach", me.Name)
+	}
+	return best
+}
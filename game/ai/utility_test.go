@@ -0,0 +1,187 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/ai"
+	"github.com/MobRulesGames/haunts/game/status"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/house/housetest"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/cache"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	"github.com/caffeine-storm/glop/sprite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func givenASpriteManager() *sprite.Manager {
+	rqi := rendertest.MakeStubbedRenderQueue()
+	bb := cache.MakeRamByteBank()
+
+	return sprite.MakeManager(rqi, func(s string) cache.ByteBank { return bb })
+}
+
+// An entity with nothing but stats, which is all attackScore looks at.
+func givenAnEntityWithStats(b status.Base, hp int) *game.Entity {
+	ent := &game.Entity{EntityDef: &game.EntityDef{Name: "Stats"}}
+	stats := status.MakeInst(b)
+	stats.SetHp(hp)
+	ent.Stats = &stats
+	return ent
+}
+
+// Makes a Teen, on the denizens' side if 'denizen' is set, and puts it at
+// 'x', 'y'.
+func givenATeenAt(g *game.Game, denizen bool, x, y house.BoardSpaceUnit) *game.Entity {
+	ent := game.MakeEntity("Teen", g)
+	if denizen {
+		def := *ent.EntityDef
+		def.ExplorerEnt = nil
+		def.HauntEnt = &game.HauntEnt{Level: game.LevelMinion}
+		ent.EntityDef = &def
+	}
+	So(g.SpawnEntity(ent, x, y), ShouldBeTrue)
+	return ent
+}
+
+// Keeps only the actions of 'ent' with the given names.
+func keepActions(ent *game.Entity, names ...string) {
+	var kept []game.Action
+	for _, action := range ent.Actions {
+		for _, name := range names {
+			if action.String() == name {
+				kept = append(kept, action)
+			}
+		}
+	}
+	ent.Actions = kept
+}
+
+func actionOf(ent *game.Entity, exec game.ActionExec) string {
+	So(exec, ShouldNotBeNil)
+	So(exec.EntityId(), ShouldEqual, ent.Id)
+	return ent.Actions[exec.ActionIndex()].String()
+}
+
+func TestUtilityAi(t *testing.T) {
+	Convey("The utility Ai", t, func() {
+		base.SetDatadir("../../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+		game.LoadAllEntities()
+
+		Convey("scores attacks", func() {
+			target := givenAnEntityWithStats(status.Base{Hp_max: 10, Corpus: 10}, 10)
+			me := givenAnEntityWithStats(status.Base{Hp_max: 10}, 10)
+
+			Convey("by the damage they'll do when they can't miss", func() {
+				So(ai.AttackScore(me, target, 10, 3, status.Kind_HP), ShouldAlmostEqual, 3)
+			})
+
+			Convey("by the chance that they'll hit", func() {
+				So(ai.AttackScore(me, target, 5, 3, status.Kind_HP), ShouldAlmostEqual, 0.6*3)
+				So(ai.AttackScore(me, target, 0, 3, status.Kind_HP), ShouldAlmostEqual, 0.1*3)
+				So(ai.AttackScore(me, target, -5, 3, status.Kind_HP), ShouldEqual, 0)
+			})
+
+			Convey("counting the attacker's bonus", func() {
+				me := givenAnEntityWithStats(status.Base{Hp_max: 10, Attack: 5}, 10)
+				So(ai.AttackScore(me, target, 5, 3, status.Kind_HP), ShouldAlmostEqual, 3)
+			})
+
+			Convey("with extra for finishing the target off", func() {
+				target.Stats.SetHp(2)
+				So(ai.AttackScore(me, target, 10, 3, status.Kind_HP), ShouldAlmostEqual, 2+5)
+				So(ai.AttackScore(me, target, 5, 3, status.Kind_HP), ShouldAlmostEqual, 0.6*(2+5))
+			})
+
+			Convey("as nothing if they can't do any damage", func() {
+				So(ai.AttackScore(me, target, 10, 0, status.Kind_HP), ShouldEqual, 0)
+				So(ai.AttackScore(me, &game.Entity{EntityDef: &game.EntityDef{}}, 10, 3, status.Kind_HP), ShouldEqual, 0)
+			})
+		})
+
+		Convey("on a board", func() {
+			g := game.MakeGame(housetest.GivenAHouseDef(), givenASpriteManager())
+			g.SetLosMode(game.SideExplorers, game.LosModeAll, nil)
+			g.SetLosMode(game.SideHaunt, game.LosModeAll, nil)
+
+			// Four cells in a row, all in the same room.
+			var start *house.SpawnPoint
+			for _, sp := range g.House.Floors[0].Spawns {
+				if sp.Name == "intruders_start" {
+					start = sp
+				}
+			}
+			So(start, ShouldNotBeNil)
+			So(start.Dx, ShouldBeGreaterThanOrEqualTo, 4)
+			x, y := start.FloorPos()
+
+			me := givenATeenAt(g, false, x, y)
+			updateLos := func() {
+				for _, ent := range g.Ents {
+					g.UpdateEntLos(ent, true)
+				}
+			}
+
+			Convey("attacks whatever it can hurt most for the Ap", func() {
+				enemy := givenATeenAt(g, true, x+2, y)
+				updateLos()
+				So(actionOf(me, ai.BestExec(me)), ShouldEqual, "Pistol")
+				So(enemy.Stats.HpCur(), ShouldEqual, 20)
+			})
+
+			Convey("prefers a cheaper attack that finishes the target off", func() {
+				enemy := givenATeenAt(g, true, x+1, y)
+				enemy.Stats.SetHp(2)
+				updateLos()
+				So(actionOf(me, ai.BestExec(me)), ShouldEqual, "Kick")
+			})
+
+			Convey("doesn't attack its own side", func() {
+				givenATeenAt(g, false, x+1, y)
+				updateLos()
+				So(ai.BestExec(me), ShouldBeNil)
+			})
+
+			Convey("doesn't attack with Ap it doesn't have", func() {
+				givenATeenAt(g, true, x+2, y)
+				updateLos()
+				me.Stats.SetAp(2)
+				// It's already close enough to shoot, so there's nowhere better to
+				// go either.
+				So(ai.BestExec(me), ShouldBeNil)
+			})
+
+			Convey("moves towards enemies that are out of reach", func() {
+				enemy := givenATeenAt(g, true, x+3, y)
+				keepActions(me, "Move", "Kick")
+				updateLos()
+				exec := ai.BestExec(me)
+				So(actionOf(me, exec), ShouldEqual, "Move")
+				path := exec.GetPath()
+				So(len(path), ShouldBeGreaterThan, 1)
+				_, px, py := g.FromVertex(path[len(path)-1])
+				ex, ey := enemy.FloorPos()
+				So(max(px-ex, ex-px, py-ey, ey-py), ShouldBeLessThan, 3)
+			})
+
+			Convey("can't approach without a way to move", func() {
+				enemy := givenATeenAt(g, true, x+3, y)
+				keepActions(me, "Kick")
+				updateLos()
+				So(ai.Approach(me, []*game.Entity{enemy}), ShouldBeNil)
+			})
+
+			Convey("stays put once it's in reach", func() {
+				enemy := givenATeenAt(g, true, x+1, y)
+				keepActions(me, "Move", "Kick")
+				updateLos()
+				So(ai.Approach(me, []*game.Entity{enemy}), ShouldBeNil)
+			})
+		})
+	})
+}
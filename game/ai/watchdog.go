@@ -0,0 +1,155 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/game"
+)
+
+// Budgets for a single evaluation of an Ai, from calling Think() until it
+// returns. Time spent waiting for the game to carry out execs, or for other
+// Ais to come up with them, doesn't count; the rest does, including time
+// spent in the functions the script calls.
+//
+// Both are enforced through the same Lua debug hook, see
+// lua.State.SetExecutionLimit: the instruction budget directly, the time
+// budget by a watchdog that cuts the limit short once time is up. Setting a
+// hook is safe while the script is running.
+const (
+	aiInstructionBudget = 2500000
+	aiTimeBudget        = 5 * time.Second
+)
+
+// Lua reports running out of instructions, however it happened, as this.
+const luaQuantumExceeded = "Lua execution quantum exceeded"
+
+// Keeps time for one evaluation and stops the script once it's over budget.
+// Everything is safe to call on a nil *watchdog.
+type watchdog struct {
+	L            *lua.State
+	instructions int
+	budget       time.Duration
+
+	mu sync.Mutex
+
+	// Time used before the current stretch of running.
+	spent time.Duration
+
+	// When the current stretch of running started, zero while paused.
+	since time.Time
+
+	tripped bool
+	stopped bool
+	done    chan struct{}
+}
+
+// Gives the script on L 'instructions' instructions and 'budget' time to
+// finish in, starting now.
+func startWatchdog(L *lua.State, instructions int, budget time.Duration) *watchdog {
+	// Anything left over from before, e.g. from loading the script, isn't
+	// this evaluation's.
+	game.LuaTakeError(L)
+	L.SetExecutionLimit(instructions)
+	w := &watchdog{
+		L:            L,
+		instructions: instructions,
+		budget:       budget,
+		since:        time.Now(),
+		done:         make(chan struct{}),
+	}
+	go w.watch()
+	return w
+}
+
+func (w *watchdog) used() time.Duration {
+	if w.since.IsZero() {
+		return w.spent
+	}
+	return w.spent + time.Since(w.since)
+}
+
+func (w *watchdog) watch() {
+	// While paused there's nothing to do but check back now and then.
+	const idle = 50 * time.Millisecond
+	for {
+		w.mu.Lock()
+		running := !w.since.IsZero()
+		left := w.budget - w.used()
+		if running && left <= 0 {
+			w.tripped = true
+			if !w.stopped {
+				w.L.SetExecutionLimit(1)
+			}
+			w.mu.Unlock()
+			return
+		}
+		w.mu.Unlock()
+
+		wait := idle
+		if running && left < wait {
+			wait = left
+		}
+		select {
+		case <-w.done:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Stops the clock, e.g. while waiting on the game.
+func (w *watchdog) pause() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.since.IsZero() {
+		w.spent += time.Since(w.since)
+		w.since = time.Time{}
+	}
+}
+
+func (w *watchdog) resume() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.since.IsZero() {
+		w.since = time.Now()
+	}
+}
+
+// Stops watching and works out why the script failed with 'err', if it did.
+// Returns whether it was stopped for going over budget, along with the
+// reason it stopped.
+func (w *watchdog) stop(err error) (bool, error) {
+	if w == nil {
+		return false, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	close(w.done)
+	if err == nil {
+		return false, nil
+	}
+	// A LuaDoError stops the script the same way running out of instructions
+	// does, but it's the script's fault rather than the budget's.
+	if msg := game.LuaTakeError(w.L); msg != "" {
+		return false, errors.New(msg)
+	}
+	if !strings.Contains(err.Error(), luaQuantumExceeded) {
+		return false, err
+	}
+	if w.tripped {
+		return true, fmt.Errorf("ran for more than %v", w.budget)
+	}
+	return true, fmt.Errorf("ran more than %d instructions", w.instructions)
+}
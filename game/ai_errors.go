@@ -0,0 +1,85 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/MobRulesGames/haunts/logging"
+)
+
+// An Ai that had to be stopped partway through its turn, e.g. because its
+// script went over budget, see ReportAiError.
+type AiError struct {
+	// The entity whose Ai was stopped, 0 for a master Ai.
+	Ent  EntityId
+	Name string
+
+	Round int
+	Err   string
+}
+
+type aiErrors struct {
+	mu sync.Mutex
+
+	// Reported but not dealt with yet, see handleAiErrors.
+	pending []AiError
+
+	// Everything reported this game.
+	all []AiError
+
+	// The most recent one, shown on the overlay.
+	msg string
+}
+
+// Reports that the Ai playing 'ent', or the master Ai of the given kind if
+// 'ent' is nil, was stopped because of 'err'. Whatever Ap the entity had
+// left is forfeited, so that nothing goes on waiting for it to be used. Safe
+// to call from an Ai's goroutine; the game deals with it the next time it
+// thinks.
+func (g *Game) ReportAiError(ent *Entity, kind AiKind, err error) {
+	ae := AiError{
+		Round: (g.Turn + 1) / 2,
+		Err:   err.Error(),
+	}
+	if ent != nil {
+		ae.Ent = ent.Id
+		ae.Name = ent.Name
+	} else {
+		ae.Name = aiKindName(kind)
+	}
+	g.ai_errors.mu.Lock()
+	defer g.ai_errors.mu.Unlock()
+	g.ai_errors.pending = append(g.ai_errors.pending, ae)
+	g.ai_errors.all = append(g.ai_errors.all, ae)
+}
+
+// Every Ai error reported this game, oldest first.
+func (g *Game) AiErrors() []AiError {
+	g.ai_errors.mu.Lock()
+	defer g.ai_errors.mu.Unlock()
+	return append([]AiError(nil), g.ai_errors.all...)
+}
+
+// Must be called from the game's Think.
+func (g *Game) handleAiErrors() {
+	g.ai_errors.mu.Lock()
+	pending := g.ai_errors.pending
+	g.ai_errors.pending = nil
+	g.ai_errors.mu.Unlock()
+
+	for _, ae := range pending {
+		logging.Error("ai stopped", "ent", ae.Ent, "name", ae.Name, "round", ae.Round, "err", ae.Err)
+		if ent := g.EntityById(ae.Ent); ae.Ent != 0 && ent != nil && ent.Stats != nil {
+			ent.Stats.SetAp(0)
+		}
+		g.ai_errors.mu.Lock()
+		g.ai_errors.msg = fmt.Sprintf("%s: %s", ae.Name, ae.Err)
+		g.ai_errors.mu.Unlock()
+	}
+}
+
+func (g *Game) aiErrorMessage() string {
+	g.ai_errors.mu.Lock()
+	defer g.ai_errors.mu.Unlock()
+	return g.ai_errors.msg
+}
@@ -0,0 +1,293 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MobRulesGames/haunts/base"
+)
+
+// Ai evaluations get traced, in devel builds, so that it's possible to work
+// out why an Ai did what it did. Every function an Ai script calls, like
+// Do.Move or Utils.NearestNEntities, is noted along with what it was passed
+// and what it returned, and so is every exec the Ai comes up with, each with
+// how long it took. The last few evaluations of each Ai are kept on the Game.
+var ai_tracing atomic.Bool
+
+func init() {
+	ai_tracing.Store(base.IsDevel())
+}
+
+// Turns tracing of Ai evaluations on or off. It's on by default in devel
+// builds and off otherwise.
+func SetAiTracing(on bool) {
+	ai_tracing.Store(on)
+}
+
+// How many evaluations are kept for each Ai.
+const maxAiTraces = 10
+
+// How many calls are kept for each evaluation, so that a script stuck in a
+// loop doesn't eat all the memory there is.
+const maxAiTraceCalls = 2000
+
+// One evaluation of an Ai, from calling Think() until it returned. Times are
+// in nanoseconds since Start when exported.
+type AiTrace struct {
+	// The entity that the Ai plays, 0 for a master Ai.
+	Ent EntityId
+
+	// The entity's name, or which side a master Ai plays.
+	Name string
+
+	Path  string
+	Round int
+	Start time.Time
+
+	// How long Think() took, 0 if it hasn't returned yet.
+	Duration time.Duration
+	Done     bool
+
+	// Set if Think() failed.
+	Error string
+
+	Calls []AiTraceCall
+	Execs []AiTraceExec
+
+	// How many calls didn't fit in Calls.
+	Dropped_calls int
+}
+
+// A function that an Ai script called.
+type AiTraceCall struct {
+	Func     string
+	Args     []string
+	Results  []string
+	At       time.Duration
+	Duration time.Duration
+}
+
+// An exec that an Ai came up with. It's done once the game is finished
+// carrying it out, so Duration covers both waiting for the game to get to it
+// and the action itself.
+type AiTraceExec struct {
+	Ent      EntityId
+	Ent_name string
+	Action   string
+	Exec     string
+	At       time.Duration
+	Duration time.Duration
+}
+
+// Records a single AiTrace as an Ai is evaluated. Everything is safe to call
+// on a nil *AiTracer, which is what StartAiTrace returns when tracing is off.
+type AiTracer struct {
+	game *Game
+
+	mu    sync.Mutex
+	trace AiTrace
+}
+
+type aiTraceKey struct {
+	ent  EntityId
+	kind AiKind
+}
+
+type aiTraces struct {
+	mu     sync.Mutex
+	traces map[aiTraceKey][]*AiTracer
+
+	// Set if the trace panel is showing, see Overlay.
+	shown bool
+}
+
+// Starts tracing an evaluation of the Ai at 'path', which plays 'ent' or, if
+// 'ent' is nil, is the master Ai of the given kind. Returns nil if Ais aren't
+// being traced.
+func (g *Game) StartAiTrace(ent *Entity, kind AiKind, path string) *AiTracer {
+	if g == nil || !ai_tracing.Load() {
+		return nil
+	}
+	t := &AiTracer{game: g}
+	t.trace.Path = path
+	t.trace.Round = (g.Turn + 1) / 2
+	t.trace.Start = time.Now()
+	key := aiTraceKey{kind: kind}
+	if ent != nil {
+		key.ent = ent.Id
+		t.trace.Ent = ent.Id
+		t.trace.Name = ent.Name
+	} else {
+		t.trace.Name = aiKindName(kind)
+	}
+
+	g.ai_traces.mu.Lock()
+	defer g.ai_traces.mu.Unlock()
+	if g.ai_traces.traces == nil {
+		g.ai_traces.traces = make(map[aiTraceKey][]*AiTracer)
+	}
+	traces := append(g.ai_traces.traces[key], t)
+	if len(traces) > maxAiTraces {
+		traces = traces[len(traces)-maxAiTraces:]
+	}
+	g.ai_traces.traces[key] = traces
+	return t
+}
+
+func aiKindName(kind AiKind) string {
+	switch kind {
+	case MinionsAi:
+		return "minions"
+	case DenizensAi:
+		return "denizens"
+	case IntrudersAi:
+		return "intruders"
+	}
+	return "entity"
+}
+
+// How long it's been since the evaluation started.
+func (t *AiTracer) Elapsed() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return time.Since(t.trace.Start)
+}
+
+func (t *AiTracer) AddCall(call AiTraceCall) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.trace.Calls) >= maxAiTraceCalls {
+		t.trace.Dropped_calls++
+		return
+	}
+	t.trace.Calls = append(t.trace.Calls, call)
+}
+
+// Notes that the Ai came up with 'exec' at 'at', and that it took 'dur' to
+// carry out.
+func (t *AiTracer) AddExec(exec ActionExec, at, dur time.Duration) {
+	if t == nil || exec == nil {
+		return
+	}
+	te := AiTraceExec{
+		Ent:      exec.EntityId(),
+		Exec:     fmt.Sprintf("%+v", exec),
+		At:       at,
+		Duration: dur,
+	}
+	if ent := t.game.EntityById(exec.EntityId()); ent != nil {
+		te.Ent_name = ent.Name
+		if i := exec.ActionIndex(); i >= 0 && i < len(ent.Actions) {
+			te.Action = ent.Actions[i].String()
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trace.Execs = append(t.trace.Execs, te)
+}
+
+func (t *AiTracer) Finish(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trace.Duration = time.Since(t.trace.Start)
+	t.trace.Done = true
+	if err != nil {
+		t.trace.Error = err.Error()
+	}
+}
+
+// Returns a copy of what's been traced so far.
+func (t *AiTracer) Trace() AiTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	trace := t.trace
+	trace.Calls = append([]AiTraceCall(nil), t.trace.Calls...)
+	trace.Execs = append([]AiTraceExec(nil), t.trace.Execs...)
+	return trace
+}
+
+// The most recent evaluations of the Ai playing 'ent', oldest first. With a
+// nil 'ent' it's the evaluations of every master Ai instead.
+func (g *Game) AiTraces(ent *Entity) []AiTrace {
+	g.ai_traces.mu.Lock()
+	var tracers []*AiTracer
+	for key, ts := range g.ai_traces.traces {
+		if ent == nil && key.kind != EntityAi {
+			tracers = append(tracers, ts...)
+		}
+		if ent != nil && key.kind == EntityAi && key.ent == ent.Id {
+			tracers = append(tracers, ts...)
+		}
+	}
+	g.ai_traces.mu.Unlock()
+
+	traces := make([]AiTrace, 0, len(tracers))
+	for _, t := range tracers {
+		traces = append(traces, t.Trace())
+	}
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].Start.Before(traces[j].Start)
+	})
+	return traces
+}
+
+// How long arguments and results can get before they're cut short in Lines.
+const maxAiTraceValueLen = 40
+
+// Describes the trace a line at a time, calls and execs in the order they
+// happened.
+func (t AiTrace) Lines() []string {
+	status := fmt.Sprintf("running for %v", time.Since(t.Start).Round(time.Millisecond))
+	if t.Done {
+		status = fmt.Sprintf("took %v", t.Duration.Round(time.Microsecond))
+	}
+	lines := []string{fmt.Sprintf("%s: round %d, %d calls, %d execs, %s", t.Name, t.Round, len(t.Calls)+t.Dropped_calls, len(t.Execs), status)}
+	if t.Error != "" {
+		lines = append(lines, "error: "+t.Error)
+	}
+
+	type event struct {
+		at   time.Duration
+		line string
+	}
+	var events []event
+	for _, call := range t.Calls {
+		line := fmt.Sprintf("%s(%s)", call.Func, shortValues(call.Args))
+		if len(call.Results) > 0 {
+			line += " -> " + shortValues(call.Results)
+		}
+		events = append(events, event{call.At, fmt.Sprintf("%8v %s [%v]", call.At.Round(time.Microsecond), line, call.Duration.Round(time.Microsecond))})
+	}
+	for _, exec := range t.Execs {
+		events = append(events, event{exec.At, fmt.Sprintf("%8v exec %s: %s [%v]", exec.At.Round(time.Microsecond), exec.Ent_name, exec.Action, exec.Duration.Round(time.Microsecond))})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].at < events[j].at
+	})
+	for _, e := range events {
+		lines = append(lines, e.line)
+	}
+	if t.Dropped_calls > 0 {
+		lines = append(lines, fmt.Sprintf("... and %d more calls", t.Dropped_calls))
+	}
+	return lines
+}
+
+func shortValues(vals []string) string {
+	s := strings.Join(vals, ", ")
+	if len(s) > maxAiTraceValueLen {
+		s = s[:maxAiTraceValueLen-3] + "..."
+	}
+	return s
+}
@@ -0,0 +1,118 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/globals"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/caffeine-storm/gl"
+	"github.com/caffeine-storm/glop/gui"
+)
+
+// How many lines of the latest trace the panel has room for.
+const aiTracePanelLines = 40
+
+// The entity whose Ai the trace panel is about.
+func (g *Game) aiTraceEnt() *Entity {
+	if g.selected_ent != nil {
+		return g.selected_ent
+	}
+	return g.hovered_ent
+}
+
+// In devel builds the "ai trace" key shows the latest evaluation of the
+// selected entity's Ai, or of the master Ais if nothing is selected, and the
+// "export ai trace" key writes every evaluation that's been kept for it to a
+// JSON file in the data directory.
+func (gp *GamePanel) respondToAiTrace(group gui.EventGroup) bool {
+	if !base.IsDevel() {
+		return false
+	}
+	keys := base.GetDefaultKeyMap()
+	pressed := func(name string) bool {
+		k, ok := keys[name]
+		return ok && group.IsPressed(k.Id())
+	}
+	g := gp.game
+	switch {
+	case pressed("ai trace"):
+		g.ai_traces.mu.Lock()
+		g.ai_traces.shown = !g.ai_traces.shown
+		g.ai_traces.mu.Unlock()
+		return true
+
+	case pressed("export ai trace"):
+		path, err := g.ExportAiTraces(g.aiTraceEnt())
+		if err != nil {
+			logging.Error("couldn't export ai traces", "err", err)
+		} else {
+			logging.Info("exported ai traces", "path", path)
+		}
+		return true
+	}
+	return false
+}
+
+// Writes the evaluations kept for 'ent', or for the master Ais if 'ent' is
+// nil, to a JSON file under the data directory and returns its path.
+func (g *Game) ExportAiTraces(ent *Entity) (string, error) {
+	name := "masters"
+	if ent != nil {
+		name = fmt.Sprintf("%s-%d", strings.ReplaceAll(ent.Name, " ", "_"), ent.Id)
+	}
+	dir := filepath.Join(base.GetDataDir(), "ai_traces")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-turn%d.json", name, g.Turn))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(g.AiTraces(ent))
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (o *Overlay) drawAiTrace(region gui.Region) {
+	g := o.game
+	g.ai_traces.mu.Lock()
+	shown := g.ai_traces.shown
+	g.ai_traces.mu.Unlock()
+	if !shown {
+		return
+	}
+	var lines []string
+	traces := g.AiTraces(g.aiTraceEnt())
+	if len(traces) == 0 {
+		lines = []string{"No Ai traces"}
+	} else {
+		lines = traces[len(traces)-1].Lines()
+	}
+	if len(lines) > aiTracePanelLines {
+		// Keep the summary, the most recent calls are the interesting ones.
+		lines = append(lines[:1], lines[len(lines)-aiTracePanelLines+1:]...)
+	}
+
+	shaderBank := globals.RenderQueueState().Shaders()
+	d := base.GetDictionary(10)
+	gl.Color4ub(0, 255, 0, 255)
+	// Below the messages the rest of the overlay shows, see Overlay.Draw.
+	top := region.Y + region.Dy - 5*int(base.GetDictionary(15).MaxHeight())
+	pos := gui.Point{X: region.X + 10, Y: top}
+	for _, line := range lines {
+		d.RenderString(line, pos, d.MaxHeight(), gui.Left, shaderBank)
+		pos.Y -= int(d.MaxHeight())
+	}
+}
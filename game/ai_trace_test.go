@@ -0,0 +1,72 @@
+package game_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAiTraces(t *testing.T) {
+	Convey("Ai traces", t, func() {
+		game.SetAiTracing(true)
+		defer game.SetAiTracing(base.IsDevel())
+
+		g := &game.Game{}
+		ent := &game.Entity{EntityDef: &game.EntityDef{Name: "Lost Soul"}}
+		ent.Id = 3
+		g.Ents = []*game.Entity{ent}
+
+		Convey("record calls as they happen", func() {
+			tr := g.StartAiTrace(ent, game.EntityAi, "ch01/Lost Soul.lua")
+			So(tr, ShouldNotBeNil)
+			tr.AddCall(game.AiTraceCall{
+				Func:     "Utils.NearestNEntities",
+				Args:     []string{"10", `"intruder"`},
+				Results:  []string{"{1=Entity(Teen #1)}"},
+				At:       time.Millisecond,
+				Duration: time.Microsecond,
+			})
+
+			traces := g.AiTraces(ent)
+			So(len(traces), ShouldEqual, 1)
+			So(traces[0].Ent, ShouldEqual, ent.Id)
+			So(traces[0].Name, ShouldEqual, "Lost Soul")
+			So(traces[0].Done, ShouldBeFalse)
+			So(traces[0].Calls[0].Func, ShouldEqual, "Utils.NearestNEntities")
+
+			tr.Finish(errors.New("oops"))
+			traces = g.AiTraces(ent)
+			So(traces[0].Done, ShouldBeTrue)
+			So(traces[0].Error, ShouldEqual, "oops")
+
+			lines := traces[0].Lines()
+			So(len(lines), ShouldEqual, 3)
+			So(lines[0], ShouldStartWith, "Lost Soul: round 0, 1 calls, 0 execs")
+			So(lines[1], ShouldEqual, "error: oops")
+			So(strings.TrimSpace(lines[2]), ShouldStartWith, `1ms Utils.NearestNEntities(10, "intruder") -> {1=Entity(Teen #1)}`)
+		})
+
+		Convey("only keep the last few evaluations of each Ai", func() {
+			for i := 0; i < 15; i++ {
+				g.StartAiTrace(ent, game.EntityAi, "ch01/Lost Soul.lua").Finish(nil)
+			}
+			g.StartAiTrace(nil, game.DenizensAi, "denizens.lua").Finish(nil)
+			So(len(g.AiTraces(ent)), ShouldEqual, 10)
+
+			masters := g.AiTraces(nil)
+			So(len(masters), ShouldEqual, 1)
+			So(masters[0].Name, ShouldEqual, "denizens")
+		})
+
+		Convey("aren't recorded when tracing is off", func() {
+			game.SetAiTracing(false)
+			So(g.StartAiTrace(ent, game.EntityAi, "ch01/Lost Soul.lua"), ShouldBeNil)
+			So(g.AiTraces(ent), ShouldBeEmpty)
+		})
+	})
+}
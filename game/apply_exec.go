@@ -0,0 +1,78 @@
+package game
+
+import (
+	"fmt"
+)
+
+const (
+	// Game time, in milliseconds, that passes with each step of ApplyExec.
+	applyExecStep = 16
+
+	// Upper bound on the number of steps ApplyExec takes for a single exec so
+	// that a broken action can't spin forever. That's several minutes of game
+	// time, far longer than any action's animations.
+	maxApplyExecSteps = 20000
+)
+
+// Applies 'exec' to the game directly, without the script, the Ais or the
+// render loop getting involved. Time is advanced in fixed steps until the
+// action completes and every entity has settled back into an idle animation,
+// so the game is left in the same state a player would see once the action
+// had played out.
+func (g *Game) ApplyExec(exec ActionExec) error {
+	ent := g.EntityById(exec.EntityId())
+	if ent == nil {
+		return fmt.Errorf("exec for unknown entity %d", exec.EntityId())
+	}
+	index := exec.ActionIndex()
+	if index < 0 || index >= len(ent.Actions) {
+		return fmt.Errorf("exec for action %d of %q, which only has %d actions", index, ent.Name, len(ent.Actions))
+	}
+	action := ent.Actions[index]
+	if !action.IsExec(exec) {
+		return fmt.Errorf("%T isn't an exec for %q's %q", exec, ent.Name, action.String())
+	}
+
+	steps := 0
+	step := func() error {
+		steps++
+		if steps > maxApplyExecSteps {
+			return fmt.Errorf("%q's %q never finished", ent.Name, action.String())
+		}
+		for _, e := range g.Ents {
+			e.Think(applyExecStep)
+		}
+		return nil
+	}
+
+	res := action.Maintain(applyExecStep, g, exec)
+	for res != Complete {
+		if err := step(); err != nil {
+			return err
+		}
+		res = action.Maintain(applyExecStep, g, nil)
+	}
+	action.Cancel()
+
+	for !g.entsSettled() {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Ents {
+		g.UpdateEntLos(e, false)
+	}
+	g.mergeLos(SideHaunt)
+	g.mergeLos(SideExplorers)
+	return nil
+}
+
+func (g *Game) entsSettled() bool {
+	for _, e := range g.Ents {
+		s := e.Sprite()
+		if s != nil && !s.Idle() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package game
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/caffeine-storm/glop/gui"
+)
+
+// Games that aren't being played online are saved at the start of every
+// turn, cycling through a few slots so that the last couple of turns are
+// always there to go back to. Online games don't need it, the server and the
+// turn journal already have everything.
+//
+// While the game is running it keeps a marker file in the data directory and
+// removes it when it shuts down properly. If the marker is still there at
+// startup then the last run crashed and the newest autosave is offered.
+
+const numAutosaves = 3
+
+func autosavePath(player string, turn int) string {
+	return filepath.Join(savesDir(player), fmt.Sprintf("autosave-%d.save", turn%numAutosaves))
+}
+
+// Run by the script's goroutine once RoundStart is done, using the same
+// state Script.SaveGameState would give the script.
+func (gs *gameScript) autosave(gp *GamePanel, player string) {
+	gs.L.SetExecutionLimit(250000)
+	if err := gs.L.DoString("__autosave = Script.SaveGameState()"); err != nil {
+		logging.Warn("couldn't autosave", "err", err)
+		return
+	}
+	gs.L.GetGlobal("__autosave")
+	state := gs.L.ToString(-1)
+	gs.L.Pop(1)
+	gs.L.PushNil()
+	gs.L.SetGlobal("__autosave")
+
+	gs.syncStart()
+	defer gs.syncEnd()
+	info := makeSaveInfo(gp, player, fmt.Sprintf("Autosave, round %d", (gp.game.Turn+1)/2))
+	info.Auto = true
+	info.path = autosavePath(player, gp.game.Turn)
+	if err := writeGameSave(info, state, gp.game); err != nil {
+		logging.Warn("couldn't autosave", "path", info.path, "err", err)
+		return
+	}
+	logging.Debug("autosaved", "path", info.path, "turn", gp.game.Turn)
+}
+
+// Returns the newest autosave of any player, or nil if there aren't any.
+func LastAutosave() *SaveInfo {
+	for _, info := range GetAllSaves() {
+		if info.Auto {
+			return info
+		}
+	}
+	return nil
+}
+
+func runningMarkerPath() string {
+	return filepath.Join(base.GetDataDir(), "running")
+}
+
+// Notes that the game is running. Returns true if the last run never got to
+// call MarkStopped, i.e. it crashed or was killed.
+func MarkRunning() bool {
+	path := runningMarkerPath()
+	_, err := os.Stat(path)
+	crashed := err == nil
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		logging.Warn("couldn't write running marker", "path", path, "err", err)
+	}
+	return crashed
+}
+
+// Notes that the game shut down properly.
+func MarkStopped() {
+	if err := os.Remove(runningMarkerPath()); err != nil && !os.IsNotExist(err) {
+		logging.Warn("couldn't remove running marker", "err", err)
+	}
+}
+
+// Offers to pick the game back up from 'info' after a crash. If the player
+// would rather not then 'replace' is used to put up whatever would have been
+// there otherwise.
+func InsertRestoreMenu(ui gui.WidgetParent, info *SaveInfo, replace func(gui.WidgetParent) error) error {
+	return insertSavesMenu(ui, []*SaveInfo{info}, replace)
+}
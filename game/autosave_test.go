@@ -0,0 +1,53 @@
+package game_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAutosave(t *testing.T) {
+	Convey("Autosaves", t, func() {
+		base.SetDatadir("../data")
+
+		Convey("cycle through a few slots", func() {
+			const player = "autosave-test-player"
+			So(filepath.Dir(game.AutosavePath(player, 1)), ShouldEqual, game.SavesDir(player))
+			So(game.AutosavePath(player, 2), ShouldNotEqual, game.AutosavePath(player, 1))
+			So(game.AutosavePath(player, 3), ShouldNotEqual, game.AutosavePath(player, 1))
+			So(game.AutosavePath(player, 3), ShouldNotEqual, game.AutosavePath(player, 2))
+			So(game.AutosavePath(player, 4), ShouldEqual, game.AutosavePath(player, 1))
+			So(game.AutosavePath(player, 10), ShouldEqual, game.AutosavePath(player, 1))
+			So(game.AutosavePath("someone-else", 1), ShouldNotEqual, game.AutosavePath(player, 1))
+		})
+
+		Convey("notice when the last run didn't shut down properly", func() {
+			marker := filepath.Join(base.GetDataDir(), "running")
+			_, err := os.Stat(marker)
+			if err == nil {
+				// Whatever left this behind isn't this test's business.
+				prev, err := os.ReadFile(marker)
+				So(err, ShouldBeNil)
+				defer os.WriteFile(marker, prev, 0644)
+			}
+			defer game.MarkStopped()
+			game.MarkStopped()
+
+			So(game.MarkRunning(), ShouldBeFalse)
+			_, err = os.Stat(marker)
+			So(err, ShouldBeNil)
+
+			// Never stopped, as though it crashed.
+			So(game.MarkRunning(), ShouldBeTrue)
+
+			game.MarkStopped()
+			_, err = os.Stat(marker)
+			So(os.IsNotExist(err), ShouldBeTrue)
+			So(game.MarkRunning(), ShouldBeFalse)
+		})
+	})
+}
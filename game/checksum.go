@@ -0,0 +1,85 @@
+package game
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/MobRulesGames/haunts/logging"
+)
+
+// Returns a hash of everything in the game that the two clients of an online
+// game have to agree on. It's computed from a canonical listing of the
+// game, rather than its gob, so that it doesn't depend on map ordering or on
+// anything that's only there for drawing.
+func (g *Game) StateChecksum() string {
+	h := sha256.New()
+	g.writeCanonicalState(h)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (g *Game) writeCanonicalState(w io.Writer) {
+	fmt.Fprintf(w, "turn %d side %d\n", g.Turn, g.Side)
+
+	ents := slices.Clone(g.Ents)
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Id < ents[j].Id
+	})
+	for _, ent := range ents {
+		x, y := ent.FloorPos()
+		fmt.Fprintf(w, "ent %d %q side %d pos %d %d\n", ent.Id, ent.Name, ent.Side(), x, y)
+		if ent.Stats != nil {
+			conditions := ent.Stats.ConditionNames()
+			sort.Strings(conditions)
+			fmt.Fprintf(w, "  hp %d/%d ap %d/%d corpus %d ego %d conditions %q\n",
+				ent.Stats.HpCur(), ent.Stats.HpMax(), ent.Stats.ApCur(), ent.Stats.ApMax(),
+				ent.Stats.Corpus(), ent.Stats.Ego(), conditions)
+		}
+	}
+
+	if g.House != nil {
+		for i, floor := range g.House.Floors {
+			for j, room := range floor.Rooms {
+				for _, door := range room.Doors {
+					fmt.Fprintf(w, "door %d %d %d %d %t\n", i, j, door.Facing, door.Pos, door.Opened)
+				}
+			}
+		}
+	}
+
+	for _, wp := range g.Waypoints {
+		fmt.Fprintf(w, "waypoint %q side %d at %v %v radius %v active %t\n", wp.Name, wp.Side, wp.X, wp.Y, wp.Radius, wp.Active)
+	}
+
+	if grs, ok := g.Rand.(*gobbableRandSource); ok {
+		fmt.Fprintf(w, "rand %v\n", grs.Buf)
+	}
+}
+
+// Run once RoundEnd has played back the other side's turn. The game should
+// have ended up exactly where it did for the player who played the turn.
+func (gs *gameScript) checkPlaybackChecksum(g *Game) {
+	gs.syncStart()
+	defer gs.syncEnd()
+	expected := g.net.expected_checksum
+	if expected == "" {
+		return
+	}
+	g.net.expected_checksum = ""
+	got := g.StateChecksum()
+	if got == expected {
+		logging.Debug("playback checksum matches", "key", g.net.key, "turn", g.Turn, "checksum", got)
+		return
+	}
+	logging.Error("online game desynced", "key", g.net.key, "turn", g.Turn, "expected", expected, "got", got)
+	side := "Denizens"
+	if g.Side == SideExplorers {
+		side = "Intruders"
+	}
+	msg := fmt.Sprintf("Round %d of the %s played out differently on each machine.", (g.Turn+1)/2, side)
+	g.net.desync = msg
+	g.net.desync_report = msg
+}
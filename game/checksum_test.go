@@ -0,0 +1,69 @@
+package game_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateChecksum(t *testing.T) {
+	Convey("State checksums", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		Convey("are the same for the same game", func() {
+			a, b := givenTwoGames()
+			So(a.StateChecksum(), ShouldEqual, b.StateChecksum())
+		})
+
+		Convey("don't depend on what order the entities are in", func() {
+			a, b := givenTwoGames()
+			b.Ents[0], b.Ents[1] = b.Ents[1], b.Ents[0]
+			So(a.StateChecksum(), ShouldEqual, b.StateChecksum())
+		})
+
+		Convey("survive a gob round trip", func() {
+			g := givenAGame()
+			g.Turn = 3
+			g.Rand.Int63()
+			buf := bytes.NewBuffer(nil)
+			So(gob.NewEncoder(buf).Encode(g), ShouldBeNil)
+			var decoded game.Game
+			So(gob.NewDecoder(buf).Decode(&decoded), ShouldBeNil)
+			So(decoded.StateChecksum(), ShouldEqual, g.StateChecksum())
+		})
+
+		Convey("change when", func() {
+			a, b := givenTwoGames()
+			for _, g := range []*game.Game{a, b} {
+				door := &house.Door{Facing: house.NearRight, Pos: 2}
+				g.House.Floors[0].Rooms = append(g.House.Floors[0].Rooms, &house.Room{Doors: []*house.Door{door}})
+			}
+			So(a.StateChecksum(), ShouldEqual, b.StateChecksum())
+
+			Convey("someone's hp changes", func() {
+				b.EntityById(2).Stats.SetHp(7)
+				So(a.StateChecksum(), ShouldNotEqual, b.StateChecksum())
+			})
+
+			Convey("a door opens", func() {
+				b.House.Floors[0].Rooms[0].Doors[0].Opened = true
+				So(a.StateChecksum(), ShouldNotEqual, b.StateChecksum())
+			})
+
+			Convey("the PRNG moves on", func() {
+				b.Rand.Int63()
+				So(a.StateChecksum(), ShouldNotEqual, b.StateChecksum())
+			})
+		})
+	})
+}
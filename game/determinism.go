@@ -0,0 +1,126 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MobRulesGames/haunts/base"
+)
+
+// Online games only stay in sync if both clients get exactly the same result
+// from the same execs. A DeterminismChecker applies a list of execs to a
+// state twice and checks that both runs agree after every exec. The first run
+// decodes the state once and applies everything to it. The second run sends
+// the game through a fresh gob round-trip before every exec, which is what
+// the other client effectively does, so anything that doesn't survive being
+// gobbed shows up as well as anything that is just plain random.
+type DeterminismChecker struct {
+	// Used for the entities of every game that gets decoded.
+	Sprites SpriteLoader
+}
+
+// Describes the first point at which two runs of the same execs disagreed.
+type Divergence struct {
+	// Index of the exec after which the runs disagreed, or -1 if they already
+	// disagreed before any execs were applied.
+	Exec int
+
+	// What was different, one line per difference.
+	Diffs []string
+}
+
+func (d *Divergence) Error() string {
+	where := "before any execs were applied"
+	if d.Exec >= 0 {
+		where = fmt.Sprintf("after exec %d", d.Exec+1)
+	}
+	return fmt.Sprintf("runs diverged %s:\n  %s", where, strings.Join(d.Diffs, "\n  "))
+}
+
+// Applies 'execs' to 'state', which is a state made by Script.SaveGameState,
+// in both runs. Returns the first Divergence found, or nil if the runs agree
+// all the way through. An error is only returned if the runs couldn't be
+// made at all.
+func (dc *DeterminismChecker) Check(state []byte, execs []ActionExec) (*Divergence, error) {
+	first, err := decodeGameState(state, dc.Sprites)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the state: %w", err)
+	}
+	second, err := decodeGameState(state, dc.Sprites)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the state: %w", err)
+	}
+
+	for i := -1; i < len(execs); i++ {
+		if i >= 0 {
+			second, err = dc.roundTrip(second)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't round-trip the game before exec %d: %w", i+1, err)
+			}
+			errFirst := first.ApplyExec(execs[i])
+			errSecond := second.ApplyExec(execs[i])
+			if (errFirst == nil) != (errSecond == nil) {
+				return &Divergence{Exec: i, Diffs: []string{
+					fmt.Sprintf("applying it gave %v in the first run but %v in the second", errFirst, errSecond),
+				}}, nil
+			}
+			if errFirst != nil {
+				return nil, fmt.Errorf("couldn't apply exec %d: %w", i+1, errFirst)
+			}
+		}
+		if diffs := diffGames(first, second); len(diffs) > 0 {
+			return &Divergence{Exec: i, Diffs: diffs}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (dc *DeterminismChecker) roundTrip(g *Game) (*Game, error) {
+	state, err := base.ToGobToBase64(totalState{Game: &g})
+	if err != nil {
+		return nil, err
+	}
+	return decodeGameState([]byte(state), dc.Sprites)
+}
+
+// Lists everything about 'a' and 'b' that an exec could have changed and
+// that differs between them.
+func diffGames(a, b *Game) []string {
+	var diffs []string
+	for _, ent := range a.Ents {
+		other := b.EntityById(ent.Id)
+		if other == nil {
+			diffs = append(diffs, fmt.Sprintf("%s (%d) is only in the first run", ent.Name, ent.Id))
+			continue
+		}
+		if oa, ob := outcomeOf(ent), outcomeOf(other); !oa.equal(ob) {
+			diffs = append(diffs, fmt.Sprintf("%s (%d) has %v in the first run but %v in the second", ent.Name, ent.Id, oa, ob))
+		}
+	}
+	for _, ent := range b.Ents {
+		if a.EntityById(ent.Id) == nil {
+			diffs = append(diffs, fmt.Sprintf("%s (%d) is only in the second run", ent.Name, ent.Id))
+		}
+	}
+	if (a.Rand == nil) != (b.Rand == nil) || (a.Rand != nil && !a.Rand.SameState(b.Rand)) {
+		diffs = append(diffs, "the PRNG states differ")
+	}
+	return diffs
+}
+
+// Decodes the execs of a turn as passed to Net.UpdateExecs. Only the
+// ActionExecs are returned, the script's own execs can't be applied without
+// the script.
+func DecodeTurnExecs(execs []byte) ([]ActionExec, error) {
+	turn, err := decodeTurnExecs(execs)
+	if err != nil {
+		return nil, err
+	}
+	var ret []ActionExec
+	for _, exec := range turn {
+		if exec.action != nil {
+			ret = append(ret, exec.action)
+		}
+	}
+	return ret, nil
+}
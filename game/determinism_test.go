@@ -0,0 +1,83 @@
+package game_test
+
+import (
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeterminismChecker(t *testing.T) {
+	Convey("Determinism checks", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		Convey("find nothing wrong with games that agree", func() {
+			a, b := givenTwoGames()
+			So(game.DiffGames(a, b), ShouldBeEmpty)
+
+			exec := &setHpExec{BasicActionExec: game.BasicActionExec{Ent: 2}, Hp: 3}
+			So(a.ApplyExec(exec), ShouldBeNil)
+			So(b.ApplyExec(exec), ShouldBeNil)
+			So(game.DiffGames(a, b), ShouldBeEmpty)
+		})
+
+		Convey("find where an exec made the games diverge", func() {
+			a, b := givenTwoGames()
+			So(a.ApplyExec(&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 2}, Hp: 3}), ShouldBeNil)
+			So(b.ApplyExec(&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 2}, Hp: 4}), ShouldBeNil)
+			diffs := game.DiffGames(a, b)
+			So(len(diffs), ShouldEqual, 1)
+			So(diffs[0], ShouldContainSubstring, "Ghost (2)")
+		})
+
+		Convey("notice entities that are only in one game", func() {
+			a, b := givenTwoGames()
+			givenAnEntityWithHp(a, 3, "Lost Soul", 1)
+			givenAnEntityWithHp(b, 4, "Poltergeist", 1)
+			diffs := game.DiffGames(a, b)
+			So(diffs, ShouldResemble, []string{
+				"Lost Soul (3) is only in the first run",
+				"Poltergeist (4) is only in the second run",
+			})
+		})
+
+		Convey("notice the PRNG moving on in one game", func() {
+			a, b := givenTwoGames()
+			a.Rand.Int63()
+			So(game.DiffGames(a, b), ShouldResemble, []string{"the PRNG states differ"})
+		})
+
+		Convey("agree with themselves on a state that survives gobbing", func() {
+			state, err := game.EncodeGameState(givenAGame())
+			So(err, ShouldBeNil)
+			dc := &game.DeterminismChecker{Sprites: givenASpriteManager()}
+			divergence, err := dc.Check(state, nil)
+			So(err, ShouldBeNil)
+			So(divergence, ShouldBeNil)
+		})
+
+		Convey("report states and execs that can't be used at all", func() {
+			dc := &game.DeterminismChecker{Sprites: givenASpriteManager()}
+			_, err := dc.Check([]byte("not a state"), nil)
+			So(err, ShouldNotBeNil)
+
+			state, err := game.EncodeGameState(givenAGame())
+			So(err, ShouldBeNil)
+			_, err = dc.Check(state, []game.ActionExec{&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 7}}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("describe where the runs diverged", func() {
+			d := &game.Divergence{Exec: 1, Diffs: []string{"the PRNG states differ"}}
+			So(d.Error(), ShouldContainSubstring, "after exec 2")
+			d.Exec = -1
+			So(d.Error(), ShouldContainSubstring, "before any execs")
+		})
+	})
+}
@@ -220,7 +220,7 @@ func (sc *spriteContainer) Sprite() *sprite.Sprite {
 	return sc.sp
 }
 
-func (sc *spriteContainer) Load(path string, spriteManager *sprite.Manager) {
+func (sc *spriteContainer) Load(path string, spriteManager SpriteLoader) {
 	// TODO(tmckee:#30): this seems to be breaking :(
 	sc.sp, sc.err = spriteManager.LoadSprite(path)
 	if sc.err != nil {
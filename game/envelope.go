@@ -0,0 +1,250 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Anything we write to disk and expect a later build to read back is wrapped
+// in a small envelope:
+//
+//	magic    4 bytes, which kind of file this is
+//	version  uvarint, which version of that kind's format the payload is in
+//	checksum 4 bytes, big-endian CRC-32 (IEEE) of the payload
+//	payload  everything else
+//
+// Anything that doesn't start with the expected magic is taken to be from
+// before envelopes existed, which is version 0 of the format. When a payload
+// is older than the current version it's brought up to date by running the
+// migrations registered for each version in between, so old players and
+// saves keep working after the structs in them change.
+//
+// Players and saves get listed far more often than they get loaded, so they
+// also have a small header, e.g. the name of the player, that's checksummed
+// on its own and goes ahead of the payload:
+//
+//	magic    4 bytes
+//	version  uvarint
+//	length   uvarint, how long the header is
+//	checksum 4 bytes, CRC-32 (IEEE) of the header
+//	header   'length' bytes
+//	checksum 4 bytes, CRC-32 (IEEE) of the payload
+//	payload  everything else
+//
+// That way listing them only means reading and checking the header. Before
+// they had headers the header was just the start of the payload.
+type FileFormat string
+
+const (
+	PlayerFormat FileFormat = "HNPL"
+	SaveFormat   FileFormat = "HNSV"
+	GameFormat   FileFormat = "HNGM"
+)
+
+// Turns a payload of one version of a format into a payload of the next.
+type Migration func(payload []byte) ([]byte, error)
+
+// The version of each format that gets written. Bump this and register a
+// migration from the old version whenever a format changes.
+var formatVersions = map[FileFormat]uint32{
+	// 1: Added the envelope, the payload didn't change.
+	// 2: Moved the name, or the SaveInfo, out of the payload into a header.
+	PlayerFormat: 2,
+	SaveFormat:   2,
+	GameFormat:   1,
+}
+
+// The version of each format that its header first showed up in.
+var headerVersions = map[FileFormat]uint32{
+	PlayerFormat: 2,
+	SaveFormat:   2,
+}
+
+// Headers are meant to be small, anything bigger than this is corrupt.
+const maxHeaderLength = 1 << 20
+
+var migrations = map[FileFormat]map[uint32]Migration{}
+
+// Registers 'm' as the way to upgrade a payload of 'format' from version
+// 'from' to version from+1.
+func RegisterMigration(format FileFormat, from uint32, m Migration) {
+	if _, ok := formatVersions[format]; !ok {
+		panic(fmt.Errorf("unknown file format %q", format))
+	}
+	if migrations[format] == nil {
+		migrations[format] = make(map[uint32]Migration)
+	}
+	if _, ok := migrations[format][from]; ok {
+		panic(fmt.Errorf("migration from %q version %d registered twice", format, from))
+	}
+	migrations[format][from] = m
+}
+
+func init() {
+	unchanged := func(payload []byte) ([]byte, error) { return payload, nil }
+	RegisterMigration(PlayerFormat, 0, unchanged)
+	RegisterMigration(SaveFormat, 0, unchanged)
+	RegisterMigration(GameFormat, 0, unchanged)
+	RegisterMigration(PlayerFormat, 1, stripPlayerName)
+	RegisterMigration(SaveFormat, 1, stripSaveInfo)
+}
+
+var (
+	ErrCorruptFile = errors.New("file is corrupt")
+	ErrNewerFormat = errors.New("file was written by a newer version of the game")
+)
+
+func encodeEnvelope(format FileFormat, payload []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(format)+binary.MaxVarintLen32+4+len(payload)))
+	buf.WriteString(string(format))
+	buf.Write(binary.AppendUvarint(nil, uint64(formatVersions[format])))
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// Returns the payload of 'data', migrated to the current version of
+// 'format'.
+func decodeEnvelope(format FileFormat, data []byte) ([]byte, error) {
+	version, payload, err := openEnvelope(format, data)
+	if err != nil {
+		return nil, err
+	}
+	return migrate(format, version, payload)
+}
+
+func checkVersion(format FileFormat, version uint32) error {
+	if current := formatVersions[format]; version > current {
+		return fmt.Errorf("%w: %q version %d, this build only knows up to %d", ErrNewerFormat, format, version, current)
+	}
+	return nil
+}
+
+// Brings 'payload', which is in 'version' of 'format', up to date.
+func migrate(format FileFormat, version uint32, payload []byte) ([]byte, error) {
+	if err := checkVersion(format, version); err != nil {
+		return nil, err
+	}
+	current := formatVersions[format]
+	for ; version < current; version++ {
+		m, ok := migrations[format][version]
+		if !ok {
+			return nil, fmt.Errorf("no way to upgrade %q from version %d", format, version)
+		}
+		var err error
+		payload, err = m(payload)
+		if err != nil {
+			return nil, fmt.Errorf("upgrading %q from version %d: %w", format, version, err)
+		}
+	}
+	return payload, nil
+}
+
+func openEnvelope(format FileFormat, data []byte) (uint32, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(format)) {
+		return 0, data, nil
+	}
+	rest := data[len(format):]
+	version, n := binary.Uvarint(rest)
+	if n <= 0 || version > 1<<32-1 || len(rest) < n+4 {
+		return 0, nil, fmt.Errorf("%w: bad %q header", ErrCorruptFile, format)
+	}
+	rest = rest[n:]
+	sum := binary.BigEndian.Uint32(rest)
+	payload := rest[4:]
+	if crc32.ChecksumIEEE(payload) != sum {
+		return 0, nil, fmt.Errorf("%w: %q checksum doesn't match", ErrCorruptFile, format)
+	}
+	return uint32(version), payload, nil
+}
+
+func encodeHeaderedEnvelope(format FileFormat, header, payload []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(format)+2*binary.MaxVarintLen32+8+len(header)+len(payload)))
+	buf.WriteString(string(format))
+	buf.Write(binary.AppendUvarint(nil, uint64(formatVersions[format])))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(header))))
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(header)))
+	buf.Write(header)
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+type envelopeReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Reads as little of 'r' as it takes to get the header of a file in
+// 'format', along with the version of the file. Files from before headers
+// existed get read in full and their whole payload is returned, which the
+// header is at the start of.
+func readEnvelopeHeader(r envelopeReader, format FileFormat) ([]byte, uint32, error) {
+	magic := make([]byte, len(format))
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, 0, err
+	}
+	if string(magic[:n]) != string(format) {
+		rest, err := io.ReadAll(r)
+		return append(magic[:n], rest...), 0, err
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil || version > 1<<32-1 {
+		return nil, 0, fmt.Errorf("%w: bad %q header", ErrCorruptFile, format)
+	}
+	if err := checkVersion(format, uint32(version)); err != nil {
+		return nil, 0, err
+	}
+	if uint32(version) < headerVersions[format] {
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		data := append(binary.AppendUvarint(magic, version), rest...)
+		_, payload, err := openEnvelope(format, data)
+		return payload, uint32(version), err
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil || length > maxHeaderLength {
+		return nil, 0, fmt.Errorf("%w: bad %q header", ErrCorruptFile, format)
+	}
+	header := make([]byte, 4+length)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, fmt.Errorf("%w: %q header is cut short", ErrCorruptFile, format)
+	}
+	if crc32.ChecksumIEEE(header[4:]) != binary.BigEndian.Uint32(header) {
+		return nil, 0, fmt.Errorf("%w: %q header checksum doesn't match", ErrCorruptFile, format)
+	}
+	return header[4:], uint32(version), nil
+}
+
+// Returns the header and the payload of 'data', the payload migrated to the
+// current version of 'format'.
+func decodeHeaderedEnvelope(format FileFormat, data []byte) ([]byte, []byte, error) {
+	r := bytes.NewReader(data)
+	header, version, err := readEnvelopeHeader(r, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := header
+	if version >= headerVersions[format] {
+		rest := data[len(data)-r.Len():]
+		if len(rest) < 4 {
+			return nil, nil, fmt.Errorf("%w: %q payload is cut short", ErrCorruptFile, format)
+		}
+		payload = rest[4:]
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(rest) {
+			return nil, nil, fmt.Errorf("%w: %q checksum doesn't match", ErrCorruptFile, format)
+		}
+	}
+	payload, err = migrate(format, version, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, payload, nil
+}
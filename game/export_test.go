@@ -0,0 +1,167 @@
+package game
+
+import (
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/mrgnet"
+)
+
+// Internals that the tests in game_test get at.
+var (
+	LuaDecodeValueToGo = luaDecodeValueToGo
+)
+
+// Replays a turn the way TurnValidator does, panics included.
+func CheckTurnReplay(g, claimed *Game, execs []byte, limits *ScriptedExecs) (err error) {
+	defer recoverTurn(&err)
+	return replayTurn(g, claimed, execs, limits)
+}
+
+// What the level script 'script' declares that its execs can do.
+func (ls LevelScripts) ScriptedExecs(script []byte) *ScriptedExecs {
+	return ls.scriptedExecs(script)
+}
+
+// Watches the game with the given key, as 'id', on a panel that hasn't got
+// anything loaded. Returns the panel along with a channel that's closed once
+// it stops watching.
+func SpectateOnBlankPanel(id mrgnet.NetId, key mrgnet.GameKey, revision uint64) (*GamePanel, <-chan struct{}) {
+	gp := &GamePanel{script: &gameScript{sync: make(chan struct{})}}
+	gp.startSpectating(id, key, 0, revision)
+	return gp, gp.spectating.done
+}
+
+// The checksum of the game that the spectator on 'gp' is showing, "" if it
+// hasn't loaded one yet. Anything the spectator is waiting to do in sync with
+// Think gets done first.
+func SpectatedChecksum(gp *GamePanel) string {
+	gp.scriptThinkOnce()
+	if gp.game == nil {
+		return ""
+	}
+	return gp.game.StateChecksum()
+}
+
+// A panel playing 'g' as the online game 'key', with a script that has the
+// Net bindings. Whatever the script needs to sync with Think gets done until
+// 'stop' is called, after which the script's state is closed.
+func GivenAnOnlinePanel(g *Game, key mrgnet.GameKey) (gp *GamePanel, L *lua.State, stop func()) {
+	gp = &GamePanel{game: g}
+	gp.script = &gameScript{sync: make(chan struct{})}
+	gp.script.L = makeNewLuaState(gp, &Player{}, true, true)
+	g.net.key = key
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case gp.script.sync <- struct{}{}:
+				<-gp.script.sync
+			case <-done:
+				return
+			}
+		}
+	}()
+	return gp, gp.script.L, func() {
+		close(done)
+		<-stopped
+		gp.script.L.Close()
+	}
+}
+
+type TurnJournalHeader = turnJournalHeader
+
+var (
+	ErrTurnJournalStale  = errTurnJournalStale
+	ReadTurnJournal      = readTurnJournal
+	ReconcileTurnJournal = reconcileTurnJournal
+	TurnJournalPath      = turnJournalPath
+)
+
+// Journals 'execs' for the turn in 'header' and leaves the journal in place,
+// as though the client went down before the turn was sent.
+func WriteTurnJournal(header TurnJournalHeader, execs []ActionExec) error {
+	j, err := startTurnJournal(header)
+	if err != nil {
+		return err
+	}
+	defer j.close()
+	for _, exec := range execs {
+		err = j.append(exec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var PruneReplays = pruneReplays
+
+var DiffGames = diffGames
+
+// Encodes 'g' the same way Script.SaveGameState does, without a store.
+func EncodeGameState(g *Game) ([]byte, error) {
+	state, err := base.ToGobToBase64(totalState{Game: &g})
+	return []byte(state), err
+}
+
+var (
+	DecodeGameState = decodeGameState
+	SavesDir        = savesDir
+)
+
+// A panel with just enough in it to save 'g': a script whose store holds
+// 'store', a lua expression. Close the returned state once done with it.
+func GivenASaveablePanel(g *Game, scenario Scenario, store string) (*GamePanel, *lua.State, error) {
+	L := lua.NewState()
+	if err := L.DoString("store = " + store); err != nil {
+		L.Close()
+		return nil, nil, err
+	}
+	gp := &GamePanel{game: g, scenario: scenario}
+	gp.script = &gameScript{L: L, sync: make(chan struct{})}
+	return gp, L, nil
+}
+
+var AutosavePath = autosavePath
+
+type UndoSnapshot = undoSnapshot
+
+var SeenBy = (*Game).seenBy
+
+func MakeUndoSnapshot(g *Game) UndoSnapshot {
+	return makeUndoSnapshot(g, "")
+}
+
+func (snap *undoSnapshot) Revealed(g *Game) bool {
+	return snap.revealed(g)
+}
+
+// Lets 'ent' see the given cells, indexed the same way as SeenBy, and
+// nothing else.
+func SetLos(ent *Entity, cells ...int) {
+	ent.los = &losData{grid: make([][]bool, house.LosTextureSize)}
+	for i := range ent.los.grid {
+		ent.los.grid[i] = make([]bool, house.LosTextureSize)
+	}
+	for _, cell := range cells {
+		ent.los.grid[cell/house.LosTextureSize][cell%house.LosTextureSize] = true
+	}
+}
+
+// Counts 'act' in 't' as though it were 'exec', carried out with 'action'.
+func TallyAction(t *Tally, g *Game, exec ActionExec, action Action, act func()) {
+	g.current_exec = exec
+	g.current_action = action
+	t.startAction(g)
+	act()
+	t.completeAction(g)
+	g.current_exec = nil
+	g.current_action = nil
+}
+
+var LevelSandboxed = levelSandboxed
+
+var ReplayKeyPressed = replayKeyPressed
@@ -13,8 +13,6 @@ import (
 	"github.com/MobRulesGames/haunts/base"
 	"github.com/MobRulesGames/haunts/house"
 	"github.com/MobRulesGames/haunts/logging"
-	"github.com/MobRulesGames/haunts/texture"
-	"github.com/caffeine-storm/glop/cache"
 	"github.com/caffeine-storm/glop/sprite"
 	"github.com/caffeine-storm/glop/util/algorithm"
 )
@@ -23,15 +21,40 @@ type Game struct {
 	gameDataTransient
 	gameDataPrivate
 	gameDataGobbable
-	spriteManager *sprite.Manager
+	spriteManager SpriteLoader
 }
 
-func (g *Game) GetSpriteManager() *sprite.Manager {
+func (g *Game) GetSpriteManager() SpriteLoader {
 	return g.spriteManager
 }
 
 func (g *Game) GobDecode(data []byte) error {
 	g.gameDataPrivate = gameDataPrivate{}
+	g.release()
+
+	g.gameDataGobbable = gameDataGobbable{}
+
+	data, err := decodeEnvelope(GameFormat, data)
+	if err != nil {
+		return err
+	}
+	dec := gob.NewDecoder(bytes.NewBuffer(data))
+	if err := dec.Decode(&g.gameDataGobbable); err != nil {
+		return err
+	}
+	var sss []sprite.SpriteState
+	if err := dec.Decode(&sss); err != nil {
+		return err
+	}
+	if len(sss) != len(g.Ents) {
+		return errors.New("SpriteStates were not recorded properly.")
+	}
+	g.finishLoading(sss)
+	return nil
+}
+
+// Stops the Ais of the game and of everything in it.
+func (g *Game) release() {
 	for ent := range g.all_ents_in_memory {
 		ent.Release()
 	}
@@ -44,18 +67,15 @@ func (g *Game) GobDecode(data []byte) error {
 	if g.Ai.denizens != nil {
 		g.Ai.denizens.Terminate()
 	}
+}
 
-	g.gameDataGobbable = gameDataGobbable{}
-
-	dec := gob.NewDecoder(bytes.NewBuffer(data))
-	if err := dec.Decode(&g.gameDataGobbable); err != nil {
-		return err
-	}
-
+// Sets up everything that isn't saved once the saved parts of the game have
+// been filled in. If 'sss' is nil the entities' sprites are left however
+// they start out.
+func (g *Game) finishLoading(sss []sprite.SpriteState) {
 	base.ProcessObject(reflect.ValueOf(g.House), "")
 	g.House.Normalize()
-	g.viewer = house.MakeHouseViewer(g.House, 62)
-	g.viewer.Edit_mode = true
+	g.viewer = makeViewer(g.House, true)
 	for _, ent := range g.Ents {
 		base.GetObject("entities", ent)
 	}
@@ -69,13 +89,6 @@ func (g *Game) GobDecode(data []byte) error {
 	g.mergeLos(SideHaunt)
 	g.mergeLos(SideExplorers)
 
-	var sss []sprite.SpriteState
-	if err := dec.Decode(&sss); err != nil {
-		return err
-	}
-	if len(sss) != len(g.Ents) {
-		return errors.New("SpriteStates were not recorded properly.")
-	}
 	for i := range sss {
 		g.Ents[i].Sprite().SetSpriteState(sss[i])
 	}
@@ -100,8 +113,6 @@ func (g *Game) GobDecode(data []byte) error {
 	if g.Ai.minions == nil {
 		g.Ai.minions = inactiveAi{}
 	}
-
-	return nil
 }
 
 func (g *Game) GobEncode() ([]byte, error) {
@@ -117,7 +128,7 @@ func (g *Game) GobEncode() ([]byte, error) {
 	if err := enc.Encode(sss); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return encodeEnvelope(GameFormat, buf.Bytes()), nil
 }
 
 func (g *Game) EntityById(id EntityId) *Entity {
@@ -194,12 +205,31 @@ func (g *Game) checkWinConditions() {
 	}
 }
 
+// For scripts that don't say who won when they end the game this guesses. A
+// side with nobody left standing has lost, otherwise the side that made the
+// winning move is the one whose turn it is.
+func (g *Game) likelyWinner() Side {
+	standing := map[Side]bool{}
+	for _, ent := range g.Ents {
+		if ent.Stats != nil && ent.Stats.HpCur() > 0 {
+			standing[ent.Side()] = true
+		}
+	}
+	switch {
+	case standing[SideExplorers] && !standing[SideHaunt]:
+		return SideExplorers
+	case standing[SideHaunt] && !standing[SideExplorers]:
+		return SideHaunt
+	}
+	return g.Side
+}
+
 func (g *Game) SetVisibility(side Side) {
 	switch side {
 	case SideHaunt:
-		g.viewer.Los_tex = g.los.denizens.tex
+		g.viewer.SetLosTexture(g.los.denizens.tex)
 	case SideExplorers:
-		g.viewer.Los_tex = g.los.intruders.tex
+		g.viewer.SetLosTexture(g.los.intruders.tex)
 	default:
 		base.DeprecatedError().Printf("Unable to SetVisibility for side == %d.", side)
 		return
@@ -233,7 +263,7 @@ func (g *Game) OnRound(do_scripts bool) {
 			base.DeprecatedLog().Printf("OnRound from %d Denizens to %d Intruders", g.Turn-1, g.Turn)
 			g.Side = SideExplorers
 		}
-		g.viewer.Los_tex.Remap()
+		g.viewer.LosTexture().Remap()
 	}
 
 	for i := range g.Ents {
@@ -428,7 +458,7 @@ func spawnEnts(g *Game, ents []*Entity, spawns []*house.SpawnPoint) {
 	}
 }
 
-func (g *Game) GetViewer() *house.HouseViewer {
+func (g *Game) GetViewer() Viewer {
 	return g.viewer
 }
 
@@ -656,9 +686,9 @@ func (g *Game) setup() {
 	g.all_ents_in_game = make(map[*Entity]bool)
 	g.all_ents_in_memory = make(map[*Entity]bool)
 	if g.Side == SideHaunt {
-		g.viewer.Los_tex = g.los.intruders.tex
+		g.viewer.SetLosTexture(g.los.intruders.tex)
 	} else {
-		g.viewer.Los_tex = g.los.denizens.tex
+		g.viewer.SetLosTexture(g.los.denizens.tex)
 	}
 
 	g.Ai.minions = inactiveAi{}
@@ -670,11 +700,7 @@ func makeGameTheWrongWay(scenario Scenario) *Game {
 	logging.Debug("and now for the wrong (but maybe less-wrong?) way", "scenario", scenario)
 	hdef := house.MakeHouseFromName(scenario.HouseName)
 	// TODO(tmckee:#36): we should pass in a render queue instead!
-	queue := texture.GetRenderQueue()
-	mgr := sprite.MakeManager(queue, func(s string) cache.ByteBank {
-		return cache.MakeLockingByteBank(cache.MakeRamByteBank())
-	})
-	return MakeGame(hdef, mgr)
+	return MakeGame(hdef, makeSpriteManager())
 }
 
 type gobbablePrng interface {
@@ -734,12 +760,17 @@ func init() {
 	gob.Register(&gobbableRandSource{})
 }
 
-func MakeGame(h *house.HouseDef, spriteManager *sprite.Manager) *Game {
+func MakeGame(h *house.HouseDef, spriteManager SpriteLoader) *Game {
+	return makeGame(h, spriteManager, false)
+}
+
+// Like MakeGame, 'edit' is passed on to makeViewer.
+func makeGame(h *house.HouseDef, spriteManager SpriteLoader, edit bool) *Game {
 	var g Game
 	g.Side = SideExplorers
 	g.House = h
 	g.House.Normalize()
-	g.viewer = house.MakeHouseViewer(g.House, 62)
+	g.viewer = makeViewer(g.House, edit)
 	g.Rand = gobbableRand(rand.NewSource(4285415527))
 	g.spriteManager = spriteManager
 
@@ -826,6 +857,8 @@ func (g *Game) SetLosMode(side Side, mode LosMode, rooms []*house.Room) {
 }
 
 func (g *Game) Think(dt int64) {
+	g.handleAiErrors()
+
 	for _, ent := range g.Ents {
 		if !g.all_ents_in_game[ent] {
 			g.all_ents_in_game[ent] = true
@@ -979,6 +1012,7 @@ func (g *Game) Think(dt int64) {
 	// If there is an action that is currently executing we need to advance that
 	// action.
 	if g.Action_state == doingAction {
+		g.tally.startAction(g)
 		res := g.current_action.Maintain(dt, g, g.current_exec)
 		if g.current_exec != nil {
 			base.DeprecatedLog().Printf("ScriptComm: sent action")
@@ -986,6 +1020,7 @@ func (g *Game) Think(dt int64) {
 		}
 		switch res {
 		case Complete:
+			g.tally.completeAction(g)
 			g.current_action.Cancel()
 			g.viewer.RemoveFloorDrawable(g.current_action)
 			g.current_action = nil
@@ -1132,6 +1167,15 @@ func (g *Game) Think(dt int64) {
 		}
 	}
 
+	// Execs from a turn journal go before anything the player or the ai might
+	// want to do.
+	if g.Action_state == noAction {
+		if exec := g.nextResumedExec(); exec != nil {
+			g.current_exec = exec
+			return
+		}
+	}
+
 	// Do Ai - if there is any to do
 	if g.Side == SideHaunt {
 		if g.Ai.minions.Active() {
@@ -1253,7 +1297,7 @@ func (g *Game) ViewFrac(x, y, dx, dy house.BoardSpaceUnit) float64 {
 	if g == nil {
 		return 1.0
 	}
-	team_los := g.viewer.Los_tex.Pix()
+	team_los := g.viewer.LosTexture().Pix()
 	for i := x; i < x+dx; i++ {
 		for j := y; j < y+dy; j++ {
 			if i < 0 || j < 0 || int(i) >= len(team_los) || int(j) >= len(team_los[0]) {
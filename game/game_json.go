@@ -0,0 +1,283 @@
+package game
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game/status"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/caffeine-storm/glop/sprite"
+)
+
+// A readable form of a state as made by Script.SaveGameState, so that states
+// can go in bug reports and be looked at or edited by hand. Only what can't
+// be looked up again by name is written out: the house is named rather than
+// included, as are entity, action and gear definitions, and only the parts
+// of them that change during a game are kept alongside. The script's store
+// stays in its Lua encoding since Lua values don't survive JSON intact, and
+// so do the entities' sprite states, which are opaque.
+type gameDoc struct {
+	House     string
+	Doors     []doorDoc
+	Net       bool
+	Turn      int
+	Side      Side
+	Entity_id EntityId
+
+	Los_spawns struct {
+		Denizens, Intruders string
+	}
+
+	// State of the PRNG, see gobbableRandSource.
+	Rand []int64
+
+	Waypoints []Waypoint
+
+	// Paths of the side-wide Ais.
+	Ai struct {
+		Minions, Denizens, Intruders string
+	}
+
+	Ents []entityDoc
+
+	Store []byte
+}
+
+type doorDoc struct {
+	Floor, Room int
+	Facing      house.WallFacing
+	Pos         house.BoardSpaceUnit
+	Opened      bool
+}
+
+type entityDoc struct {
+	Defname string
+	Id      EntityId
+	X, Y    float64
+
+	Stats *status.Inst `json:",omitempty"`
+
+	// Name of the gear an explorer has picked, if any.
+	Gear string `json:",omitempty"`
+
+	Actions []actionDoc
+
+	// Path of the entity's Ai if it isn't the one from its definition.
+	Ai_path base.Path         `json:",omitempty"`
+	Ai_data map[string]string `json:",omitempty"`
+
+	Info   Info
+	Active bool
+
+	// Gob of the sprite's state, where it's facing and what it's doing. If
+	// any entity is missing one then every sprite starts out as it would for
+	// a new entity.
+	Sprite []byte `json:",omitempty"`
+}
+
+type actionDoc struct {
+	Name string
+
+	// Ammo left, for actions that have ammo. -1 means it's unlimited.
+	Ammo *int `json:",omitempty"`
+}
+
+// Converts 'state', as made by Script.SaveGameState, to JSON.
+func GameStateToJSON(state []byte, sprites SpriteLoader) ([]byte, error) {
+	g := &Game{spriteManager: sprites}
+	ts := totalState{Game: &g}
+	if err := base.FromBase64FromGob(&ts, string(state)); err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, fmt.Errorf("no game in state")
+	}
+	return json.MarshalIndent(makeGameDoc(g, ts.Store), "", "  ")
+}
+
+// Converts JSON made by GameStateToJSON back to a state that
+// Script.LoadGameState will take.
+func GameStateFromJSON(data []byte, sprites SpriteLoader) (string, error) {
+	var doc gameDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+	g, err := doc.makeGame(sprites)
+	if err != nil {
+		return "", err
+	}
+	return base.ToGobToBase64(totalState{Game: &g, Store: doc.Store})
+}
+
+func makeGameDoc(g *Game, store []byte) *gameDoc {
+	doc := gameDoc{
+		Net:       g.Net,
+		Turn:      g.Turn,
+		Side:      g.Side,
+		Entity_id: g.Entity_id,
+		Waypoints: g.Waypoints,
+		Store:     store,
+	}
+	doc.Los_spawns.Denizens = g.Los_spawns.Denizens.Pattern
+	doc.Los_spawns.Intruders = g.Los_spawns.Intruders.Pattern
+	doc.Ai.Minions = g.Ai.Path.Minions
+	doc.Ai.Denizens = g.Ai.Path.Denizens
+	doc.Ai.Intruders = g.Ai.Path.Intruders
+	if grs, ok := g.Rand.(*gobbableRandSource); ok {
+		doc.Rand = grs.Buf
+	}
+
+	if g.House != nil {
+		doc.House = g.House.Name
+		for i, floor := range g.House.Floors {
+			for j, room := range floor.Rooms {
+				for _, door := range room.Doors {
+					doc.Doors = append(doc.Doors, doorDoc{
+						Floor:  i,
+						Room:   j,
+						Facing: door.Facing,
+						Pos:    door.Pos,
+						Opened: door.Opened,
+					})
+				}
+			}
+		}
+	}
+
+	for _, ent := range g.Ents {
+		ed := entityDoc{
+			Defname: ent.Defname,
+			Id:      ent.Id,
+			X:       ent.X,
+			Y:       ent.Y,
+			Stats:   ent.Stats,
+			Ai_path: ent.Ai_file_override,
+			Ai_data: ent.Ai_data,
+			Info:    ent.Info,
+			Active:  ent.Active,
+		}
+		if ent.ExplorerEnt != nil && ent.ExplorerEnt.Gear != nil {
+			ed.Gear = ent.ExplorerEnt.Gear.Defname
+		}
+		if ent.Sprite() != nil {
+			ss := ent.Sprite().GetSpriteState()
+			buf := bytes.NewBuffer(nil)
+			if err := gob.NewEncoder(buf).Encode(&ss); err == nil {
+				ed.Sprite = buf.Bytes()
+			}
+		}
+		for _, action := range ent.Actions {
+			ad := actionDoc{Name: action.String()}
+			if ammo := actionAmmo(action); ammo.IsValid() {
+				n := int(ammo.Int())
+				ad.Ammo = &n
+			}
+			ed.Actions = append(ed.Actions, ad)
+		}
+		doc.Ents = append(doc.Ents, ed)
+	}
+	return &doc
+}
+
+func (doc *gameDoc) makeGame(sprites SpriteLoader) (*Game, error) {
+	if !slices.Contains(base.GetAllNamesInRegistry("houses"), doc.House) {
+		return nil, fmt.Errorf("no house named %q", doc.House)
+	}
+	g := &Game{spriteManager: sprites}
+	g.House = house.MakeHouseFromName(doc.House)
+	for _, dd := range doc.Doors {
+		if dd.Floor >= len(g.House.Floors) || dd.Room >= len(g.House.Floors[dd.Floor].Rooms) {
+			return nil, fmt.Errorf("house %q has no room %d on floor %d", doc.House, dd.Room, dd.Floor)
+		}
+		for _, door := range g.House.Floors[dd.Floor].Rooms[dd.Room].Doors {
+			if door.Facing == dd.Facing && door.Pos == dd.Pos {
+				door.Opened = dd.Opened
+			}
+		}
+	}
+
+	g.Net = doc.Net
+	g.Turn = doc.Turn
+	g.Side = doc.Side
+	g.Entity_id = doc.Entity_id
+	g.Los_spawns.Denizens.Pattern = doc.Los_spawns.Denizens
+	g.Los_spawns.Intruders.Pattern = doc.Los_spawns.Intruders
+	g.Waypoints = doc.Waypoints
+	g.Ai.Path.Minions = doc.Ai.Minions
+	g.Ai.Path.Denizens = doc.Ai.Denizens
+	g.Ai.Path.Intruders = doc.Ai.Intruders
+	if doc.Rand != nil {
+		g.Rand = &gobbableRandSource{Buf: doc.Rand}
+	}
+
+	entityNames := base.GetAllNamesInRegistry("entities")
+	var sss []sprite.SpriteState
+	for _, ed := range doc.Ents {
+		if !slices.Contains(entityNames, ed.Defname) {
+			return nil, fmt.Errorf("no entity named %q", ed.Defname)
+		}
+		ent := &Entity{Defname: ed.Defname}
+		base.GetObject("entities", ent)
+		ent.Id = ed.Id
+		ent.X, ent.Y = ed.X, ed.Y
+		ent.Stats = ed.Stats
+		ent.Ai_file_override = ed.Ai_path
+		ent.Ai_data = ed.Ai_data
+		ent.Info = ed.Info
+		if ent.Info.RoomsExplored == nil {
+			ent.Info.RoomsExplored = make(map[int]bool)
+		}
+		ent.Active = ed.Active
+		if ed.Gear != "" {
+			if ent.ExplorerEnt == nil {
+				return nil, fmt.Errorf("%s (%d) has gear but isn't an explorer", ed.Defname, ed.Id)
+			}
+			gear := Gear{Defname: ed.Gear}
+			base.GetObject("gear", &gear)
+			ent.ExplorerEnt.Gear = &gear
+		}
+		for _, ad := range ed.Actions {
+			if _, ok := action_map[ad.Name]; !ok {
+				return nil, fmt.Errorf("%s (%d) has an unknown action %q", ed.Defname, ed.Id, ad.Name)
+			}
+			action := MakeAction(ad.Name)
+			if ammo := actionAmmo(action); ammo.IsValid() && ad.Ammo != nil {
+				ammo.SetInt(int64(*ad.Ammo))
+			}
+			ent.Actions = append(ent.Actions, action)
+		}
+		if ed.Sprite != nil {
+			var ss sprite.SpriteState
+			if err := gob.NewDecoder(bytes.NewReader(ed.Sprite)).Decode(&ss); err != nil {
+				return nil, fmt.Errorf("%s (%d) has a bad sprite state: %w", ed.Defname, ed.Id, err)
+			}
+			sss = append(sss, ss)
+		}
+		g.Ents = append(g.Ents, ent)
+	}
+	if len(sss) != len(g.Ents) {
+		sss = nil
+	}
+
+	g.finishLoading(sss)
+	return g, nil
+}
+
+// Returns the remaining ammo of 'action', or an invalid Value if it's not the
+// kind of action that has ammo.
+func actionAmmo(action Action) reflect.Value {
+	v := reflect.ValueOf(action)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	ammo := v.Elem().FieldByName("Current_ammo")
+	if !ammo.IsValid() || ammo.Kind() != reflect.Int {
+		return reflect.Value{}
+	}
+	return ammo
+}
@@ -0,0 +1,64 @@
+package game_test
+
+import (
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/house/housetest"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGameStateJSON(t *testing.T) {
+	Convey("Game states as JSON", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		g := game.MakeGame(housetest.GivenAHouseDef(), givenASpriteManager())
+		g.Turn = 4
+		g.Side = game.SideExplorers
+		g.Rand.Int63()
+		var opened bool
+		for _, room := range g.House.Floors[0].Rooms {
+			if len(room.Doors) > 0 {
+				room.Doors[0].Opened = true
+				opened = true
+				break
+			}
+		}
+		So(opened, ShouldBeTrue)
+		state, err := game.EncodeGameState(g)
+		So(err, ShouldBeNil)
+
+		Convey("round-trip", func() {
+			data, err := game.GameStateToJSON(state, givenASpriteManager())
+			So(err, ShouldBeNil)
+			back, err := game.GameStateFromJSON(data, givenASpriteManager())
+			So(err, ShouldBeNil)
+
+			loaded, err := game.DecodeGameState([]byte(back), givenASpriteManager())
+			So(err, ShouldBeNil)
+			So(loaded.Turn, ShouldEqual, 4)
+			So(loaded.Side, ShouldEqual, game.SideExplorers)
+			So(loaded.StateChecksum(), ShouldEqual, g.StateChecksum())
+
+			again, err := game.GameStateToJSON([]byte(back), givenASpriteManager())
+			So(err, ShouldBeNil)
+			So(string(again), ShouldEqual, string(data))
+		})
+
+		Convey("won't make a game out of a house that doesn't exist", func() {
+			_, err := game.GameStateFromJSON([]byte(`{"House": "Nowhere"}`), givenASpriteManager())
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("won't take something that isn't a state", func() {
+			_, err := game.GameStateToJSON([]byte("not a state"), givenASpriteManager())
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,6 +1,8 @@
 package game
 
 import (
+	"fmt"
+
 	"github.com/MobRulesGames/haunts/house"
 	"github.com/MobRulesGames/haunts/logging"
 	"github.com/MobRulesGames/haunts/mrgnet"
@@ -26,6 +28,28 @@ type GamePanel struct {
 
 	script *gameScript
 	game   *Game
+
+	// What's being played, as it was asked for.
+	scenario Scenario
+
+	// Set if both sides are being played on this machine.
+	hotseat *hotseat
+
+	// Set if this panel is playing back a Replay.
+	replay *replayPlayer
+
+	// Set while this panel is watching an online game.
+	spectating *spectating
+
+	// Execs the player can take back this turn.
+	undo undoStack
+
+	// Set if the script's questions are answered without asking anyone, see
+	// HeadlessGame.
+	prompter Prompter
+
+	// Set if the game's damage is being counted.
+	tally *Tally
 }
 
 func (gp *GamePanel) SetLosModeAll() {
@@ -37,15 +61,32 @@ func (gp *GamePanel) SetLosModeAll() {
 // TODO(#36): add a render.RenderQueueInterface to the parameter list and store
 // it with the GamePanel so that the GamePanel can forward it to ... stuff.
 func MakeGamePanel(scenario Scenario, p *Player, data map[string]string, game_key mrgnet.GameKey) *GamePanel {
+	gp, err := StartGamePanel(scenario, p, data, game_key)
+	if err != nil {
+		panic(fmt.Errorf("couldn't create a game: %w", err))
+	}
+	return gp
+}
+
+// Like MakeGamePanel but reports failures to get the game going, e.g. not
+// being able to reach the server for an online game, instead of panicking.
+func StartGamePanel(scenario Scenario, p *Player, data map[string]string, game_key mrgnet.GameKey) (*GamePanel, error) {
 	var gp GamePanel
+	err := gp.start(scenario, p, data, game_key)
+	if err != nil {
+		return nil, err
+	}
+	return &gp, nil
+}
+
+func (gp *GamePanel) start(scenario Scenario, p *Player, data map[string]string, game_key mrgnet.GameKey) error {
 	if p == nil {
 		p = &Player{}
 	}
 	if scenario.Script == "" {
 		scenario.Script = p.Script_path
 	}
-	startGameScript(&gp, scenario, p, data, game_key)
-	return &gp
+	return startGameScript(gp, scenario, p, data, game_key)
 }
 
 func (gp *GamePanel) ClearCanvas() {
@@ -94,6 +135,7 @@ func (gp *GamePanel) Active() bool {
 
 func (gp *GamePanel) Think(ui *gui.Gui, t int64) {
 	gp.scriptThinkOnce()
+	gp.thinkAsSpectator()
 	gp.canvas.Think(ui, t)
 	if !gp.Active() {
 		return
@@ -162,6 +204,14 @@ func (gp *GamePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
 		}
 	}
 
+	if gp.respondToAiTrace(group) {
+		return true
+	}
+
+	if gp.game.spectator.active {
+		return gp.respondAsSpectator(group)
+	}
+
 	if group.IsPressed(gin.AnyEscape) {
 		if gp.game.selected_ent != nil {
 			switch gp.game.Action_state {
@@ -198,6 +248,7 @@ func (gp *GamePanel) Respond(ui *gui.Gui, group gui.EventGroup) bool {
 		consumed, exec := gp.game.current_action.HandleInput(ui, group, gp.game)
 		if consumed {
 			if exec != nil {
+				gp.pushUndo()
 				gp.game.current_exec = exec
 				// TODO: Should send the exec across the wire here
 			}
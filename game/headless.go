@@ -0,0 +1,386 @@
+package game
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/cache"
+	"github.com/caffeine-storm/glop/gin"
+	"github.com/caffeine-storm/glop/gui"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	"github.com/caffeine-storm/glop/sprite"
+)
+
+// Most of what a game does doesn't need anything to be drawn, but the parts
+// that do get drawn need OpenGL, and so a window, just to be made. In
+// headless mode, see SetHeadless, they're swapped for ones that do nothing,
+// so that whole games, level scripts and Ais included, can be played out in
+// go test or on machines without a display.
+
+// What a Game needs from whatever shows its house.
+type Viewer interface {
+	house.Viewer
+
+	AddDrawable(house.Drawable)
+	RemoveDrawable(house.Drawable)
+	AddFloorDrawable(house.RenderOnFloorer)
+	RemoveFloorDrawable(house.RenderOnFloorer)
+
+	SetFocusTarget(bx, by float32)
+	SetZoomTarget(z float64)
+	GetState() house.HouseViewerState
+	SetState(house.HouseViewerState)
+
+	LosTexture() *house.LosTexture
+	SetLosTexture(*house.LosTexture)
+}
+
+var _ Viewer = (*house.HouseViewer)(nil)
+
+// Where a Game gets its entities' sprites from.
+type SpriteLoader interface {
+	LoadSprite(path string) (*sprite.Sprite, error)
+}
+
+var _ SpriteLoader = (*sprite.Manager)(nil)
+
+// Makes the Viewer for a newly made or loaded house, 'edit' is the
+// HouseViewer's Edit_mode.
+var makeViewer = func(h *house.HouseDef, edit bool) Viewer {
+	hv := house.MakeHouseViewer(h, 62)
+	hv.Edit_mode = edit
+	return hv
+}
+
+var headless bool
+
+// Switches over to headless mode. Textures never get made, and neither do
+// sprite sheets, but sprites still load and animate since the game waits on
+// their animations. Every Game gets a Viewer that doesn't draw anything, and
+// games don't leave replays or autosaves behind. This has to be called
+// before any textures, Games or GamePanels are made, and it can't be undone.
+// Returns a SpriteLoader for making Games with directly.
+func SetHeadless() SpriteLoader {
+	headless = true
+	texture.Init(rendertest.MakeStubbedRenderQueue())
+	makeViewer = func(h *house.HouseDef, edit bool) Viewer {
+		return &headlessViewer{zoom: 10}
+	}
+	return makeSpriteManager()
+}
+
+// Makes a sprite manager that uses the same render queue as textures do.
+func makeSpriteManager() *sprite.Manager {
+	return sprite.MakeManager(texture.GetRenderQueue(), func(string) cache.ByteBank {
+		return cache.MakeLockingByteBank(cache.MakeRamByteBank())
+	})
+}
+
+// The Viewer for headless games. It remembers what it's told but never
+// draws anything, and since nothing is ever on screen window coordinates are
+// the same as board coordinates.
+type headlessViewer struct {
+	gui.Childless
+	gui.BasicZone
+	gui.StubDrawFocuseder
+
+	state house.HouseViewerState
+	los   *house.LosTexture
+	zoom  float32
+}
+
+func (hv *headlessViewer) Respond(*gui.Gui, gui.EventGroup) bool {
+	return false
+}
+
+func (hv *headlessViewer) Think(*gui.Gui, int64)               {}
+func (hv *headlessViewer) Draw(gui.Region, gui.DrawingContext) {}
+
+func (hv *headlessViewer) String() string {
+	return "headless viewer"
+}
+
+func (hv *headlessViewer) SetZoom(z float32) {
+	hv.zoom = z
+}
+
+func (hv *headlessViewer) GetZoom() float32 {
+	return hv.zoom
+}
+
+func (hv *headlessViewer) WindowToBoard(wx, wy int) (float32, float32) {
+	return float32(wx), float32(wy)
+}
+
+func (hv *headlessViewer) BoardToWindow(bx, by float32) (int, int) {
+	return int(bx), int(by)
+}
+
+func (hv *headlessViewer) AddDrawable(house.Drawable)                {}
+func (hv *headlessViewer) RemoveDrawable(house.Drawable)             {}
+func (hv *headlessViewer) AddFloorDrawable(house.RenderOnFloorer)    {}
+func (hv *headlessViewer) RemoveFloorDrawable(house.RenderOnFloorer) {}
+func (hv *headlessViewer) SetFocusTarget(bx, by float32)             {}
+func (hv *headlessViewer) SetZoomTarget(z float64)                   {}
+
+func (hv *headlessViewer) GetState() house.HouseViewerState {
+	return hv.state
+}
+
+func (hv *headlessViewer) SetState(state house.HouseViewerState) {
+	hv.state = state
+}
+
+func (hv *headlessViewer) LosTexture() *house.LosTexture {
+	return hv.los
+}
+
+func (hv *headlessViewer) SetLosTexture(lt *house.LosTexture) {
+	hv.los = lt
+}
+
+// Answers the questions that level scripts otherwise put to the player with
+// Script.ChooserFromFile, Script.DialogBox, Script.PickFromN and
+// Script.PlaceEntities, for games that nobody is playing.
+type Prompter interface {
+	// Returns the ids of the options picked from the chooser in 'path'.
+	Choose(path string, ids []string) []string
+
+	// Returns the index of the section picked when a page of the dialog in
+	// 'path' offers a choice between the sections with 'ids'.
+	DialogChoice(path string, ids []string) int
+
+	// Returns between min and max of 'names'.
+	PickFromN(min, max int, names []string) []string
+
+	// Places entities from 'names', which cost 'costs', into spawn points
+	// matching 'pattern'. At least 'min' and at most 'max' points are to be
+	// spent. Returns the entities that were placed.
+	PlaceEntities(g *Game, pattern string, names []string, costs []int, min, max int) []*Entity
+
+	// Returns the Ai, as a path under data/ais, that plays 'side' when the
+	// script binds it to "human". Returning "" leaves it to a human, and so the
+	// game won't get past that side's first turn.
+	StandIn(side Side) string
+}
+
+// Answers everything with whatever is offered first, and places entities in
+// the first spots they fit. Sides meant for a human are played by the Ais
+// named here, or by denizens.lua and intruders.lua if none are.
+type FirstChoicePrompter struct {
+	Denizens, Intruders string
+}
+
+func (FirstChoicePrompter) Choose(path string, ids []string) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids[:1]
+}
+
+func (FirstChoicePrompter) DialogChoice(path string, ids []string) int {
+	return 0
+}
+
+func (FirstChoicePrompter) PickFromN(min, max int, names []string) []string {
+	n := min
+	if n < 1 {
+		n = 1
+	}
+	if n > max {
+		n = max
+	}
+	if n > len(names) {
+		n = len(names)
+	}
+	return names[:n]
+}
+
+func (FirstChoicePrompter) PlaceEntities(g *Game, pattern string, names []string, costs []int, min, max int) []*Entity {
+	return g.placeEntitiesInOrder(pattern, names, costs, max)
+}
+
+func (fcp FirstChoicePrompter) StandIn(side Side) string {
+	switch side {
+	case SideHaunt:
+		if fcp.Denizens != "" {
+			return fcp.Denizens
+		}
+		return "denizens.lua"
+	case SideExplorers:
+		if fcp.Intruders != "" {
+			return fcp.Intruders
+		}
+		return "intruders.lua"
+	}
+	return ""
+}
+
+// Returns the Ai that stands in for a human playing the BindAi target
+// 'target'.
+func (gp *GamePanel) standIn(target string) string {
+	var ai string
+	switch target {
+	case "denizen":
+		ai = gp.prompter.StandIn(SideHaunt)
+	case "intruder":
+		ai = gp.prompter.StandIn(SideExplorers)
+	}
+	if ai == "" {
+		return "human"
+	}
+	return ai
+}
+
+// Places as many of each of 'names' in turn as 'points' allows, each in the
+// first spot that it fits in a spawn point matching 'pattern'.
+func (g *Game) placeEntitiesInOrder(pattern string, names []string, costs []int, points int) []*Entity {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		logging.Warn("couldn't place entities", "pattern", pattern, "err", err)
+		return nil
+	}
+	var placed []*Entity
+	for i := 0; i < len(names) && i < len(costs); {
+		if costs[i] > points {
+			i++
+			continue
+		}
+		ent := MakeEntity(names[i], g)
+		if !g.placeSomewhere(ent, re, pattern) {
+			i++
+			continue
+		}
+		g.viewer.AddDrawable(ent)
+		placed = append(placed, ent)
+		points -= costs[i]
+		if costs[i] <= 0 {
+			i++
+		}
+	}
+	return placed
+}
+
+// Puts 'ent' in the first spot it fits in a spawn point matched by 're'.
+func (g *Game) placeSomewhere(ent *Entity, re *regexp.Regexp, pattern string) bool {
+	defer func() { g.new_ent = nil }()
+	dx, dy := ent.Dims()
+	for _, spawn := range g.House.Floors[0].Spawns {
+		if !re.MatchString(spawn.Name) {
+			continue
+		}
+		sx, sy := spawn.FloorPos()
+		sdx, sdy := spawn.Dims()
+		for x := sx; x+dx <= sx+sdx; x++ {
+			for y := sy; y+dy <= sy+sdy; y++ {
+				ent.X, ent.Y = float64(x), float64(y)
+				g.new_ent = ent
+				if g.placeEntity(pattern) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// A game that nobody is watching or playing. Its GamePanel lives in a Gui
+// that is never drawn and never gets any input, the level script's
+// questions go to a Prompter, and time only passes when Step is called. It
+// only gets anywhere if every side is played by Ais. The damage done during
+// the game is counted in its Tally.
+type HeadlessGame struct {
+	panel *GamePanel
+	ui    *gui.Gui
+	now   int64
+}
+
+// Starts 'scenario' like StartGamePanel does, SetHeadless has to have been
+// called already.
+func StartHeadlessGame(scenario Scenario, player *Player, data map[string]string, prompter Prompter) (*HeadlessGame, error) {
+	gp := &GamePanel{prompter: prompter, tally: &Tally{}}
+	return startHeadlessGame(gp, func() error {
+		return gp.start(scenario, player, data, "")
+	})
+}
+
+// Like StartHeadlessGame, but the sides take turns at the machine the way
+// they do in a hotseat game, see StartHotseatPanel. There's nobody to hand
+// the machine over to, so hand-offs happen straight away.
+func StartHeadlessHotseatGame(scenario Scenario, prompter Prompter) (*HeadlessGame, error) {
+	gp := &GamePanel{prompter: prompter, tally: &Tally{}, hotseat: &hotseat{side: SideHaunt}}
+	return startHeadlessGame(gp, func() error {
+		return startGameScript(gp, scenario, &Player{}, nil, "")
+	})
+}
+
+func startHeadlessGame(gp *GamePanel, start func() error) (*HeadlessGame, error) {
+	if !headless {
+		return nil, errors.New("SetHeadless has to be called before starting a headless game")
+	}
+	ui, err := gui.Make(gui.Dims{Dx: 1024, Dy: 768}, gin.Make())
+	if err != nil {
+		return nil, err
+	}
+	err = start()
+	if err != nil {
+		return nil, err
+	}
+	ui.AddChild(gp)
+	return &HeadlessGame{panel: gp, ui: ui}, nil
+}
+
+// The game being played. Only safe to look at from the goroutine calling
+// Step, between Steps.
+func (hg *HeadlessGame) Game() *Game {
+	return hg.panel.game
+}
+
+func (hg *HeadlessGame) Panel() *GamePanel {
+	return hg.panel
+}
+
+func (hg *HeadlessGame) Tally() *Tally {
+	return hg.panel.tally
+}
+
+// Whether the script has ended the game, and if so which side won, as the
+// script said when it called Script.EndGame.
+func (hg *HeadlessGame) Ended() (bool, Side) {
+	g := hg.panel.game
+	if g == nil {
+		return false, SideNone
+	}
+	return g.ended, g.winner
+}
+
+// Stops the game's script and Ais and frees what they were using. Nothing
+// else can be done with 'hg' afterwards.
+func (hg *HeadlessGame) Close() {
+	hg.ui.RemoveChild(hg.panel)
+	hg.panel.stopScript()
+	if g := hg.panel.game; g != nil {
+		g.release()
+	}
+}
+
+// Runs one frame, 'dt' milliseconds after the last one.
+func (hg *HeadlessGame) Step(dt int64) {
+	hg.now += dt
+	hg.ui.Think(hg.now)
+}
+
+// Steps 'dt' at a time until 'done' returns true, or 'limit' frames have
+// gone by. Returns what 'done' last returned.
+func (hg *HeadlessGame) StepUntil(dt int64, limit int, done func(g *Game) bool) bool {
+	for i := 0; i < limit; i++ {
+		hg.Step(dt)
+		if hg.panel.game != nil && done(hg.panel.game) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package game
+
+import (
+	"bytes"
+
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/caffeine-storm/glop/gui"
+)
+
+// Two people playing versus on the same machine and taking turns at it. The
+// level scripts are told that they're in an online game, Net.Active() is true,
+// so they go about things exactly as they would online. The turns that would
+// have gone to the server are kept here instead and, rather than waiting on
+// the other player's machine, Net.Wait() hands the machine over to them.
+type hotseat struct {
+	// The side of whoever is sitting at the machine right now. This is what
+	// Net.Side() reports, so it changes every round.
+	side Side
+
+	// The state at the start of the most recent turn and the execs made
+	// during it, as the script handed them to Net.UpdateState and
+	// Net.UpdateExecs.
+	before, execs []byte
+}
+
+func StartHotseatPanel(scenario Scenario) (*GamePanel, error) {
+	var gp GamePanel
+	// The Denizens always go first.
+	gp.hotseat = &hotseat{side: SideHaunt}
+	err := startGameScript(&gp, scenario, &Player{}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return &gp, nil
+}
+
+func (hs *hotseat) sideName() string {
+	if hs.side == SideExplorers {
+		return "Intruders"
+	}
+	return "Denizens"
+}
+
+// Hides the board so the player who just went can't see what the other side
+// can see, and waits for the other player to say that they've taken over. In
+// headless games the dialog goes to the Prompter instead.
+func (gp *GamePanel) hotseatHandoff() {
+	next := SideHaunt
+	dialog := "ui/start/versus/pass_to_denizens.json"
+	if gp.hotseat.side == SideHaunt {
+		next = SideExplorers
+		dialog = "ui/start/versus/pass_to_intruders.json"
+	}
+
+	gp.script.syncStart()
+	gp.game.SetLosMode(SideHaunt, LosModeBlind, nil)
+	gp.game.SetLosMode(SideExplorers, LosModeBlind, nil)
+	box, output, err := MakeDialogBox(dialog, nil)
+	if err != nil {
+		logging.Error("couldn't make the hotseat handoff dialog", "err", err)
+	} else if gp.prompter != nil {
+		box.answer(func(ids []string) int {
+			return gp.prompter.DialogChoice(dialog, ids)
+		})
+		box = nil
+	} else {
+		gp.AddChild(box, gui.Anchor{Wx: 0.5, Wy: 0.5, Bx: 0.5, By: 0.5})
+	}
+	gp.script.syncEnd()
+
+	if box != nil {
+		for range output {
+		}
+	}
+
+	gp.script.syncStart()
+	defer gp.script.syncEnd()
+	if box != nil {
+		gp.RemoveChild(box)
+	}
+	gp.hotseat.side = next
+	gp.game.SetLosMode(SideHaunt, LosModeEntities, nil)
+	gp.game.SetLosMode(SideExplorers, LosModeEntities, nil)
+	gp.game.SetVisibility(next)
+}
+
+// The hotseat versions of the Net.* functions. Each takes the same arguments
+// and returns the same values as the online one that it stands in for.
+
+func hotseatUpdateState(gp *GamePanel, L *lua.State) int {
+	gp.hotseat.before = []byte(L.ToString(-1))
+	L.PushBoolean(true)
+	return 1
+}
+
+func hotseatUpdateExecs(gp *GamePanel, L *lua.State) int {
+	buf := bytes.NewBuffer(nil)
+	err := LuaEncodeValue(buf, L, -1)
+	if err != nil {
+		base.DeprecatedError().Printf("Unable to serialize execs: %v", err)
+		return 0
+	}
+	gp.hotseat.execs = buf.Bytes()
+	L.PushBoolean(true)
+	return 1
+}
+
+func hotseatWait(gp *GamePanel, L *lua.State) int {
+	gp.hotseatHandoff()
+	L.PushBoolean(true)
+	return 1
+}
+
+func hotseatLatestStateAndExecs(gp *GamePanel, L *lua.State) int {
+	if gp.hotseat.before == nil || gp.hotseat.execs == nil {
+		base.DeprecatedError().Printf("Asked for the latest turn before one was played.")
+		return 0
+	}
+	L.PushString(string(gp.hotseat.before))
+	gp.script.syncStart()
+	LuaDecodeValue(bytes.NewBuffer(gp.hotseat.execs), L, gp.game)
+	gp.script.syncEnd()
+	return 2
+}
@@ -0,0 +1,277 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/MobRulesGames/haunts/mrgnet"
+)
+
+// An online turn only reaches the server once it's over, so if the client
+// goes down partway through a turn everything done in it would be lost. To
+// avoid that every exec is written to a journal as soon as it's done, and if
+// the game is rejoined before the turn was sent the journal is replayed on
+// top of the state the turn started from.
+//
+// A journal file is a turnJournalHeader followed by the encodeActionExec of
+// each exec in the order they happened. Each of these is written as a uvarint
+// length followed by that many bytes, so if the client died while writing
+// the last one it can just be dropped.
+
+type turnJournalHeader struct {
+	Key mrgnet.GameKey
+
+	// The script the game was started with, so that it can be started again.
+	Script string
+
+	Round     int
+	Intruders bool
+
+	// The state that was sent with Net.UpdateState at the start of the turn.
+	Before []byte
+}
+
+// The index that the server keeps this turn at.
+func (h *turnJournalHeader) turn() int {
+	if h.Intruders {
+		return 2*h.Round + 1
+	}
+	return 2 * h.Round
+}
+
+type turnJournal struct {
+	path string
+	f    *os.File
+}
+
+// Game keys come from the server, so they're hex encoded rather than trusted
+// to make a safe file name.
+func turnJournalPath(key mrgnet.GameKey) string {
+	return filepath.Join(base.GetDataDir(), "journals", hex.EncodeToString([]byte(key)))
+}
+
+func hasTurnJournal(key mrgnet.GameKey) bool {
+	_, err := os.Stat(turnJournalPath(key))
+	return err == nil
+}
+
+// Starts a new journal for the game in 'header', replacing any journal it
+// already had.
+func startTurnJournal(header turnJournalHeader) (*turnJournal, error) {
+	path := turnJournalPath(header.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	j := &turnJournal{path: path, f: f}
+	if err := j.write(buf.Bytes()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *turnJournal) write(record []byte) error {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], uint64(len(record)))
+	if _, err := j.f.Write(append(scratch[:n], record...)); err != nil {
+		return err
+	}
+	// The whole point is to survive the client dying, so don't leave this
+	// sitting in a buffer somewhere.
+	return j.f.Sync()
+}
+
+func (j *turnJournal) append(exec ActionExec) error {
+	record := encodeActionExec(exec)
+	if record == nil {
+		return fmt.Errorf("couldn't encode %T", exec)
+	}
+	return j.write(record)
+}
+
+// Stops writing to the journal but leaves it in place, e.g. because a new
+// turn is starting and gets a journal of its own.
+func (j *turnJournal) close() {
+	if err := j.f.Close(); err != nil {
+		logging.Warn("couldn't close turn journal", "path", j.path, "err", err)
+	}
+}
+
+// Called once the turn has made it to the server, at which point there's
+// nothing left to recover.
+func (j *turnJournal) finish() {
+	j.close()
+	if err := os.Remove(j.path); err != nil {
+		logging.Warn("couldn't remove turn journal", "path", j.path, "err", err)
+	}
+}
+
+func removeTurnJournal(key mrgnet.GameKey) {
+	err := os.Remove(turnJournalPath(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.Warn("couldn't remove turn journal", "key", key, "err", err)
+	}
+}
+
+func readTurnJournal(key mrgnet.GameKey) (*turnJournalHeader, []ActionExec, error) {
+	f, err := os.Open(turnJournalPath(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	next := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		record := make([]byte, n)
+		_, err = io.ReadFull(r, record)
+		return record, err
+	}
+
+	record, err := next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("turn journal has no header: %w", err)
+	}
+	var header turnJournalHeader
+	if err := gob.NewDecoder(bytes.NewReader(record)).Decode(&header); err != nil {
+		return nil, nil, fmt.Errorf("turn journal has a bad header: %w", err)
+	}
+	if header.Key != key {
+		return nil, nil, fmt.Errorf("turn journal for %q is for %q", key, header.Key)
+	}
+
+	var execs []ActionExec
+	for {
+		record, err := next()
+		if err != nil {
+			// Either the end of the journal or an exec that didn't get written
+			// all the way, in which case it never made it into the game either.
+			break
+		}
+		exec := decodeActionExec(record)
+		if exec == nil {
+			return nil, nil, fmt.Errorf("turn journal has a bad exec after %d good ones", len(execs))
+		}
+		execs = append(execs, exec)
+	}
+	return &header, execs, nil
+}
+
+// Returned by reconcileTurnJournal when the server already has the turn, so
+// the journal has nothing to add.
+var errTurnJournalStale = errors.New("that turn has already been sent")
+
+// Checks that the turn in the journal is the one that the server is waiting
+// on.
+func reconcileTurnJournal(header *turnJournalHeader, game *mrgnet.Game, net_id mrgnet.NetId) error {
+	if game == nil {
+		return errors.New("the server doesn't have that game")
+	}
+	if header.Intruders != (net_id == game.Intruders_id) {
+		return errors.New("that turn was played by the other side")
+	}
+	turn := header.turn()
+	if len(game.Execs) > turn {
+		return errTurnJournalStale
+	}
+	if len(game.Execs) < turn {
+		return fmt.Errorf("the server is waiting on turn %d, not turn %d", len(game.Execs), turn)
+	}
+	return nil
+}
+
+// A turn from a journal that's being replayed.
+type turnResume struct {
+	before []byte
+	execs  []ActionExec
+}
+
+// Rejoins the game with the given key at the point that the journal for it
+// stops.
+func ResumeOnlineGame(key mrgnet.GameKey) (*GamePanel, error) {
+	header, execs, err := readTurnJournal(key)
+	if err != nil {
+		return nil, err
+	}
+	var net_id mrgnet.NetId
+	fmt.Sscanf(base.GetStoreVal("netid"), "%d", &net_id)
+	ctx, cancel := onlineContext()
+	defer cancel()
+	resp, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Id: net_id, Game_key: key})
+	if err != nil {
+		return nil, err
+	}
+	err = reconcileTurnJournal(header, resp.Game, net_id)
+	if err == errTurnJournalStale {
+		removeTurnJournal(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logging.Info("resuming turn from journal", "key", key, "turn", header.turn(), "execs", len(execs))
+	gp, err := StartGamePanel(Scenario{Script: header.Script}, nil, nil, key)
+	if err != nil {
+		return nil, err
+	}
+	if gp.game == nil {
+		return nil, errors.New("couldn't start the game")
+	}
+	gp.game.net.resume = &turnResume{before: header.Before, execs: execs}
+	return gp, nil
+}
+
+// Run from gameScript.OnRound once RoundStart is done. RoundStart may not
+// come up with the same state it did the first time around, so the state
+// from the journal replaces it, both here and on the server.
+func (gs *gameScript) resumeTurn(g *Game) {
+	gs.L.PushString(string(g.net.resume.before))
+	gs.L.SetGlobal("__resume_state")
+	gs.mustRunString(`
+		Script.LoadGameState(__resume_state)
+		store.game = __resume_state
+		Net.UpdateState(__resume_state)
+		__resume_state = nil
+	`)
+}
+
+// Hands out the execs that are left to replay, one at a time, as though the
+// player had done them.
+func (g *Game) nextResumedExec() ActionExec {
+	if g.net.resume == nil {
+		return nil
+	}
+	if len(g.net.resume.execs) == 0 {
+		g.net.resume = nil
+		return nil
+	}
+	exec := g.net.resume.execs[0]
+	g.net.resume.execs = g.net.resume.execs[1:]
+	ent := g.EntityById(exec.EntityId())
+	if ent == nil || exec.ActionIndex() < 0 || exec.ActionIndex() >= len(ent.Actions) || !ent.Actions[exec.ActionIndex()].IsExec(exec) {
+		logging.Error("turn journal doesn't match the game, giving up on the rest of it", "exec", exec)
+		g.net.resume = nil
+		return nil
+	}
+	return exec
+}
@@ -0,0 +1,101 @@
+package game_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/mrgnet"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTurnJournal(t *testing.T) {
+	Convey("Turn journals", t, func() {
+		base.SetDatadir("../data")
+		key := mrgnet.GameKey("journal-test")
+		defer os.Remove(filepath.Dir(game.TurnJournalPath(key)))
+		defer os.Remove(game.TurnJournalPath(key))
+
+		header := game.TurnJournalHeader{
+			Key:       key,
+			Script:    "Lvl01.lua",
+			Round:     2,
+			Intruders: true,
+			Before:    []byte("before"),
+		}
+		execs := []game.ActionExec{
+			&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 1}, Hp: 3},
+			&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 2}, Hp: 4},
+		}
+		So(game.WriteTurnJournal(header, execs), ShouldBeNil)
+
+		Convey("stay in the journals directory whatever the game key", func() {
+			dir := filepath.Dir(game.TurnJournalPath(key))
+			for _, key := range []mrgnet.GameKey{"../escape", "a/b", `a\b`, ".."} {
+				path := game.TurnJournalPath(key)
+				So(filepath.Dir(path), ShouldEqual, dir)
+				So(filepath.Base(path), ShouldNotEqual, "..")
+			}
+			So(game.TurnJournalPath("a/b"), ShouldNotEqual, game.TurnJournalPath("a_b"))
+		})
+
+		Convey("read back what was written", func() {
+			read, readExecs, err := game.ReadTurnJournal(key)
+			So(err, ShouldBeNil)
+			So(*read, ShouldResemble, header)
+			So(readExecs, ShouldResemble, execs)
+		})
+
+		Convey("drop an exec that didn't get written all the way", func() {
+			f, err := os.OpenFile(game.TurnJournalPath(key), os.O_APPEND|os.O_WRONLY, 0)
+			So(err, ShouldBeNil)
+			// Says there are 100 bytes to come, but only 3 made it.
+			_, err = f.Write([]byte{100, 1, 2, 3})
+			So(err, ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+
+			_, readExecs, err := game.ReadTurnJournal(key)
+			So(err, ShouldBeNil)
+			So(readExecs, ShouldResemble, execs)
+		})
+
+		Convey("only belong to the game they were written for", func() {
+			other := mrgnet.GameKey("journal-test-other")
+			data, err := os.ReadFile(game.TurnJournalPath(key))
+			So(err, ShouldBeNil)
+			So(os.WriteFile(game.TurnJournalPath(other), data, 0644), ShouldBeNil)
+			defer os.Remove(game.TurnJournalPath(other))
+
+			_, _, err = game.ReadTurnJournal(other)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("aren't there for games that never had one", func() {
+			_, _, err := game.ReadTurnJournal("journal-test-missing")
+			So(errors.Is(err, fs.ErrNotExist), ShouldBeTrue)
+		})
+
+		Convey("are checked against the game on the server", func() {
+			const intruders = mrgnet.NetId(7)
+			server := &mrgnet.Game{Intruders_id: intruders}
+			// Round 2 for the intruders is turn 5.
+			server.Execs = make([][]byte, 5)
+			So(game.ReconcileTurnJournal(&header, server, intruders), ShouldBeNil)
+
+			So(game.ReconcileTurnJournal(&header, nil, intruders), ShouldNotBeNil)
+			So(game.ReconcileTurnJournal(&header, server, intruders+1), ShouldNotBeNil)
+
+			server.Execs = make([][]byte, 6)
+			So(game.ReconcileTurnJournal(&header, server, intruders), ShouldEqual, game.ErrTurnJournalStale)
+
+			server.Execs = make([][]byte, 3)
+			err := game.ReconcileTurnJournal(&header, server, intruders)
+			So(err, ShouldNotBeNil)
+			So(err, ShouldNotEqual, game.ErrTurnJournalStale)
+		})
+	})
+}
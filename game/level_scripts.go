@@ -0,0 +1,178 @@
+package game
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/logging"
+)
+
+// What a level script's own execs, see e.g. StoreSpawn, StoreDamage and
+// StoreDespawn in the level scripts, can do to a game. Scripts declare it in
+// a global table, e.g.
+//
+//	ScriptedExecs = {
+//	  spawns = {"Angry Shade"},
+//	  damage = {25},
+//	  despawns = true,
+//	}
+//
+// and turns that claim a scripted change the script didn't declare get
+// rejected, see TurnValidator.
+type ScriptedExecs struct {
+	// Names of the entities that the script can spawn.
+	Spawns []string
+
+	// Amounts of damage that the script can deal.
+	Damage []int
+
+	// Whether the script can despawn entities.
+	Despawns bool
+}
+
+func (se *ScriptedExecs) canSpawn(name string) bool {
+	return se != nil && slices.Contains(se.Spawns, name)
+}
+
+func (se *ScriptedExecs) canDamage(amount float64) bool {
+	return se != nil && amount == float64(int(amount)) && slices.Contains(se.Damage, int(amount))
+}
+
+func (se *ScriptedExecs) canDespawn() bool {
+	return se != nil && se.Despawns
+}
+
+// The ScriptedExecs of level scripts, by the sha256 of their contents.
+type LevelScripts map[[sha256.Size]byte]*ScriptedExecs
+
+// Returns what 'script' declares that its execs can do, or nil if it isn't a
+// script in 'ls'. Servers get a game's script from whoever started the game,
+// so only the declarations of scripts that they have themselves count.
+func (ls LevelScripts) scriptedExecs(script []byte) *ScriptedExecs {
+	if script == nil {
+		return nil
+	}
+	return ls[sha256.Sum256(script)]
+}
+
+// Loads the ScriptedExecs of every level script under 'dir'. Scripts that
+// can't be loaded are left out, so scripted changes in their games are all
+// rejected.
+func LoadLevelScripts(dir string) (LevelScripts, error) {
+	ls := make(LevelScripts)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".lua") {
+			return nil
+		}
+		prog, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		se, err := readScriptedExecs(prog)
+		if err != nil {
+			logging.Warn("couldn't read what a level script's execs can do", "path", path, "err", err)
+			return nil
+		}
+		ls[sha256.Sum256(prog)] = se
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ls, nil
+}
+
+// How many instructions a level script gets to define its functions and its
+// ScriptedExecs in. None of them do anything else when they're loaded.
+const levelScriptLoadBudget = 250000
+
+// Runs 'prog' in a sandbox, without any of the game's bindings, and reads its
+// ScriptedExecs. A script without one can't do anything.
+func readScriptedExecs(prog []byte) (*ScriptedExecs, error) {
+	L := lua.NewState()
+	defer L.Close()
+	LuaOpenLibs(L, true)
+	L.SetExecutionLimit(levelScriptLoadBudget)
+	err := L.DoString(string(prog))
+	if err != nil {
+		return nil, err
+	}
+	L.GetGlobal("ScriptedExecs")
+	defer L.Pop(1)
+	if L.IsNil(-1) {
+		return &ScriptedExecs{}, nil
+	}
+	buf := bytes.NewBuffer(nil)
+	err = LuaEncodeValue(buf, L, -1)
+	if err != nil {
+		return nil, err
+	}
+	val, err := luaDecodeValueToGo(buf)
+	if err != nil {
+		return nil, err
+	}
+	table, ok := val.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("ScriptedExecs should be a table, not %T", val)
+	}
+
+	var se ScriptedExecs
+	for k, v := range table {
+		switch k {
+		case "spawns":
+			names, err := luaArray[string](v)
+			if err != nil {
+				return nil, fmt.Errorf("spawns: %w", err)
+			}
+			se.Spawns = names
+		case "damage":
+			amounts, err := luaArray[float64](v)
+			if err != nil {
+				return nil, fmt.Errorf("damage: %w", err)
+			}
+			for _, amount := range amounts {
+				se.Damage = append(se.Damage, int(amount))
+			}
+		case "despawns":
+			despawns, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("despawns should be true or false, not %v", v)
+			}
+			se.Despawns = despawns
+		default:
+			return nil, fmt.Errorf("unexpected field %v", k)
+		}
+	}
+	return &se, nil
+}
+
+// The values of a decoded lua array, which all have to be of type T.
+func luaArray[T any](v interface{}) ([]T, error) {
+	table, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("should be a table")
+	}
+	vals := make([]T, len(table))
+	for k, elem := range table {
+		index, ok := k.(float64)
+		if !ok || index < 1 || int(index) > len(table) || index != float64(int(index)) {
+			return nil, fmt.Errorf("should be an array, found key %v", k)
+		}
+		vals[int(index)-1], ok = elem.(T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected value %v", elem)
+		}
+	}
+	return vals, nil
+}
@@ -128,6 +128,53 @@ type gameDataTransient struct {
 		key  mrgnet.GameKey
 		game *mrgnet.Game
 		side Side
+
+		// The last problem the Net.* functions had talking to the server, if
+		// any, so that it can be shown to the player.
+		err string
+
+		// The most recent state that we know the server has for this game.
+		// States get uploaded as deltas against it.
+		latest_state []byte
+
+		// The script the game was started with.
+		script string
+
+		// Every exec done so far this turn, in case the client goes down before
+		// the turn gets sent.
+		journal *turnJournal
+
+		// Set when rejoining a game partway through a turn, see
+		// ResumeOnlineGame.
+		resume *turnResume
+
+		// The checksum that the other player's last turn should come out to
+		// once it has been played back here.
+		expected_checksum string
+
+		// Set once either player has noticed that the game has desynced, so
+		// that it can be shown to the player.
+		desync string
+
+		// A desync noticed here that the server hasn't heard about yet.
+		desync_report string
+	}
+
+	// The most recent Ai evaluations, see AiTrace.
+	ai_traces aiTraces
+
+	// Ais that had to be stopped, see ReportAiError.
+	ai_errors aiErrors
+
+	// Set when the game is being watched rather than played.
+	spectator struct {
+		active bool
+
+		// Whose line of sight the spectator is looking through.
+		view Side
+
+		// Where a replay is up to, empty unless a replay is being watched.
+		replay string
 	}
 }
 
@@ -202,7 +249,7 @@ type gameDataGobbable struct {
 
 	player_inactive bool
 
-	viewer *house.HouseViewer
+	viewer Viewer
 
 	// If the user is dragging around a new Entity to place, this is it
 	new_ent *Entity
@@ -227,6 +274,13 @@ type gameDataGobbable struct {
 
 	current_exec   ActionExec
 	current_action Action
+
+	// Set if what happens in this game is being counted, see Tally.
+	tally *Tally
+
+	// Set once the script has called Script.EndGame.
+	ended  bool
+	winner Side
 }
 
 type actionState int
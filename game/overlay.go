@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/globals"
 	"github.com/MobRulesGames/haunts/logging"
 	"github.com/caffeine-storm/gl"
 	"github.com/caffeine-storm/glop/gui"
@@ -53,9 +54,9 @@ func (o *Overlay) Respond(g *gui.Gui, group gui.EventGroup) bool {
 
 func (o *Overlay) Think(g *gui.Gui, dt int64) {
 	var side Side
-	if o.game.viewer.Los_tex == o.game.los.intruders.tex {
+	if o.game.viewer.LosTexture() == o.game.los.intruders.tex {
 		side = SideExplorers
-	} else if o.game.viewer.Los_tex == o.game.los.denizens.tex {
+	} else if o.game.viewer.LosTexture() == o.game.los.denizens.tex {
 		side = SideHaunt
 	} else {
 		side = SideNone
@@ -86,6 +87,11 @@ func (o *Overlay) Draw(region gui.Region, ctx gui.DrawingContext) {
 	default:
 		panic(fmt.Errorf("unknown side: %v", o.game.Side))
 	}
+	o.drawNetError(region)
+	o.drawDesync(region)
+	o.drawAiError(region)
+	o.drawSpectatorView(region)
+	o.drawAiTrace(region)
 	if len(o.game.Waypoints) == 0 {
 		return
 	}
@@ -138,6 +144,66 @@ func (o *Overlay) Draw(region gui.Region, ctx gui.DrawingContext) {
 	})
 }
 
+// If talking to the server went wrong the player should hear about it rather
+// than wonder why the other side never moves.
+func (o *Overlay) drawNetError(region gui.Region) {
+	if o.game.net.err == "" {
+		return
+	}
+	shaderBank := globals.RenderQueueState().Shaders()
+	d := base.GetDictionary(15)
+	gl.Color4ub(255, 0, 0, 255)
+	pos := gui.Point{X: region.X + 10, Y: region.Y + region.Dy - 2*int(d.MaxHeight())}
+	d.RenderString(fmt.Sprintf("Network error: %s", o.game.net.err), pos, d.MaxHeight(), gui.Left, shaderBank)
+}
+
+// Once the two sides of an online game disagree about what happened there's
+// no telling what either player is looking at, so both of them get told.
+func (o *Overlay) drawDesync(region gui.Region) {
+	if o.game.net.desync == "" {
+		return
+	}
+	shaderBank := globals.RenderQueueState().Shaders()
+	d := base.GetDictionary(15)
+	gl.Color4ub(255, 255, 0, 255)
+	pos := gui.Point{X: region.X + 10, Y: region.Y + region.Dy - 3*int(d.MaxHeight())}
+	d.RenderString(fmt.Sprintf("Out of sync: %s", o.game.net.desync), pos, d.MaxHeight(), gui.Left, shaderBank)
+}
+
+// An Ai that had to be stopped leaves its side short of a move or two, which
+// would look like a bug if nobody said why.
+func (o *Overlay) drawAiError(region gui.Region) {
+	msg := o.game.aiErrorMessage()
+	if msg == "" {
+		return
+	}
+	shaderBank := globals.RenderQueueState().Shaders()
+	d := base.GetDictionary(15)
+	gl.Color4ub(255, 0, 0, 255)
+	pos := gui.Point{X: region.X + 10, Y: region.Y + region.Dy - 4*int(d.MaxHeight())}
+	d.RenderString(fmt.Sprintf("Ai stopped: %s", msg), pos, d.MaxHeight(), gui.Left, shaderBank)
+}
+
+// Spectators need to know whose line of sight they're looking through.
+func (o *Overlay) drawSpectatorView(region gui.Region) {
+	if !o.game.spectator.active {
+		return
+	}
+	shaderBank := globals.RenderQueueState().Shaders()
+	d := base.GetDictionary(15)
+	gl.Color4ub(255, 255, 255, 255)
+	view := "Denizens"
+	if o.game.spectator.view == SideExplorers {
+		view = "Intruders"
+	}
+	pos := gui.Point{X: region.X + 10, Y: region.Y + region.Dy - int(d.MaxHeight())}
+	d.RenderString(fmt.Sprintf("Watching as the %s", view), pos, d.MaxHeight(), gui.Left, shaderBank)
+	if o.game.spectator.replay != "" {
+		pos.Y -= 2 * int(d.MaxHeight())
+		d.RenderString(o.game.spectator.replay, pos, d.MaxHeight(), gui.Left, shaderBank)
+	}
+}
+
 func (o *Overlay) DrawFocused(region gui.Region, ctx gui.DrawingContext) {
 	o.Draw(region, ctx)
 }
@@ -4,6 +4,7 @@
 package game
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/gob"
 	"fmt"
@@ -54,9 +55,13 @@ func GetAllPlayers() map[string]string {
 			return nil
 		}
 		defer f.Close()
-		dec := gob.NewDecoder(f)
+		header, _, err := readEnvelopeHeader(bufio.NewReader(f), PlayerFormat)
+		if err != nil {
+			base.DeprecatedWarn().Printf("Unable to read player file: %s: %v.", path, err)
+			return nil
+		}
 		var name string
-		err = dec.Decode(&name)
+		err = gob.NewDecoder(bytes.NewReader(header)).Decode(&name)
 		if err != nil {
 			base.DeprecatedWarn().Printf("Unable to read player file: %s.", path)
 			return nil
@@ -78,28 +83,53 @@ func UpdatePlayer(p *Player, L *lua.State) {
 	p.Lua_store = buffer.Bytes()
 }
 
-// Encode a player's name, then the entire player.  This way we can just read
-// the first value to get it's name without having to de-gob the entire file.
+// Encode a player's name in the header of a PlayerFormat envelope, then the
+// entire player as the payload.  This way we can just read the header to get
+// its name without having to de-gob the entire file.
 func EncodePlayer(w io.Writer, p *Player) error {
-	enc := gob.NewEncoder(w)
-	err := enc.Encode(p.Name)
+	header := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(header).Encode(p.Name)
 	if err != nil {
 		return err
 	}
-	return enc.Encode(p)
+	payload := bytes.NewBuffer(nil)
+	err = gob.NewEncoder(payload).Encode(p)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encodeHeaderedEnvelope(PlayerFormat, header.Bytes(), payload.Bytes()))
+	return err
 }
 
 func DecodePlayer(r io.Reader) (*Player, error) {
-	var p Player
-	dec := gob.NewDecoder(r)
-	err := dec.Decode(&p.Name)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	_, payload, err := decodeHeaderedEnvelope(PlayerFormat, data)
 	if err != nil {
 		return nil, err
 	}
-	err = dec.Decode(&p)
+	var p Player
+	err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&p)
 	return &p, err
 }
 
+// Player files used to have the name ahead of the player in the payload.
+func stripPlayerName(payload []byte) ([]byte, error) {
+	dec := gob.NewDecoder(bytes.NewReader(payload))
+	var p Player
+	if err := dec.Decode(&p.Name); err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(&p)
+	return buf.Bytes(), err
+}
+
 func LoadPlayer(path string) (*Player, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,74 @@
+package game_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc32"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/game"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPlayerFiles(t *testing.T) {
+	Convey("Player files", t, func() {
+		player := &game.Player{
+			Name:        "Ghost Hunter",
+			Lua_store:   []byte{1, 2, 3},
+			Game_state:  "state",
+			Script_path: "Lvl01.lua",
+			No_init:     true,
+		}
+
+		Convey("round-trip", func() {
+			buf := bytes.NewBuffer(nil)
+			So(game.EncodePlayer(buf, player), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, string(game.PlayerFormat))
+
+			decoded, err := game.DecodePlayer(buf)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, player)
+		})
+
+		Convey("from before the envelope still load", func() {
+			buf := bytes.NewBuffer(nil)
+			enc := gob.NewEncoder(buf)
+			So(enc.Encode(player.Name), ShouldBeNil)
+			So(enc.Encode(player), ShouldBeNil)
+
+			decoded, err := game.DecodePlayer(buf)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, player)
+		})
+
+		Convey("from before the header still load", func() {
+			buf := bytes.NewBuffer(nil)
+			enc := gob.NewEncoder(buf)
+			So(enc.Encode(player.Name), ShouldBeNil)
+			So(enc.Encode(player), ShouldBeNil)
+
+			decoded, err := game.DecodePlayer(bytes.NewReader(givenAVersion1Envelope(game.PlayerFormat, buf.Bytes())))
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, player)
+		})
+
+		Convey("that are damaged don't load", func() {
+			buf := bytes.NewBuffer(nil)
+			So(game.EncodePlayer(buf, player), ShouldBeNil)
+			data := buf.Bytes()
+			data[len(data)-1] ^= 0xff
+
+			_, err := game.DecodePlayer(bytes.NewReader(data))
+			So(err, ShouldWrap, game.ErrCorruptFile)
+		})
+	})
+}
+
+// Wraps 'payload' the way files were before they had headers.
+func givenAVersion1Envelope(format game.FileFormat, payload []byte) []byte {
+	data := []byte(string(format))
+	data = binary.AppendUvarint(data, 1)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(payload))
+	return append(data, payload...)
+}
@@ -0,0 +1,357 @@
+package game
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/MobRulesGames/haunts/mrgnet"
+)
+
+// A Replay is everything needed to watch a game again after the fact.
+// States are the same base64 that Script.SaveGameState makes, so they carry
+// the Rand state along with everything else.
+type Replay struct {
+	Scenario Scenario
+
+	// The state the game was in before the first recorded turn started.
+	Initial []byte
+
+	Turns []ReplayTurn
+}
+
+type ReplayTurn struct {
+	Round int
+	Side  Side
+
+	// The state once RoundStart was done with it, which is where the execs
+	// start from.
+	Before []byte
+
+	Execs []ActionExec
+
+	// The state the execs left the game in. Script execs, e.g. spawns, can't
+	// be played back so this is the only way to be sure of how the turn
+	// ended. Nil if the turn wasn't played on this machine or never finished.
+	After []byte
+}
+
+// The gob that replay files hold. Consecutive states hardly differ, so every
+// state after Initial is kept as a delta against the one before it.
+type replayFile struct {
+	Scenario Scenario
+	Initial  []byte
+	Turns    []replayFileTurn
+}
+
+type replayFileTurn struct {
+	Round  int
+	Side   Side
+	Before []byte
+	Execs  [][]byte
+	After  []byte
+}
+
+func (r *Replay) GobEncode() ([]byte, error) {
+	f := replayFile{Scenario: r.Scenario, Initial: r.Initial}
+	prev := r.Initial
+	delta := func(state []byte) []byte {
+		if state == nil {
+			return nil
+		}
+		d := mrgnet.EncodeDelta(prev, state)
+		prev = state
+		return d
+	}
+	for _, turn := range r.Turns {
+		ft := replayFileTurn{Round: turn.Round, Side: turn.Side}
+		ft.Before = delta(turn.Before)
+		for _, exec := range turn.Execs {
+			encoded := encodeActionExec(exec)
+			if encoded == nil {
+				return nil, fmt.Errorf("couldn't encode %T", exec)
+			}
+			ft.Execs = append(ft.Execs, encoded)
+		}
+		ft.After = delta(turn.After)
+		f.Turns = append(f.Turns, ft)
+	}
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(f)
+	return buf.Bytes(), err
+}
+
+func (r *Replay) GobDecode(data []byte) error {
+	var f replayFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&f); err != nil {
+		return err
+	}
+	*r = Replay{Scenario: f.Scenario, Initial: f.Initial}
+	prev := f.Initial
+	undelta := func(delta []byte) ([]byte, error) {
+		if delta == nil {
+			return nil, nil
+		}
+		state, err := mrgnet.ApplyDelta(prev, delta)
+		prev = state
+		return state, err
+	}
+	for i, ft := range f.Turns {
+		turn := ReplayTurn{Round: ft.Round, Side: ft.Side}
+		var err error
+		if turn.Before, err = undelta(ft.Before); err != nil {
+			return fmt.Errorf("turn %d: %w", i, err)
+		}
+		for j, encoded := range ft.Execs {
+			exec := decodeActionExec(encoded)
+			if exec == nil {
+				return fmt.Errorf("turn %d: exec %d is bad", i, j)
+			}
+			turn.Execs = append(turn.Execs, exec)
+		}
+		if turn.After, err = undelta(ft.After); err != nil {
+			return fmt.Errorf("turn %d: %w", i, err)
+		}
+		r.Turns = append(r.Turns, turn)
+	}
+	return nil
+}
+
+func SaveReplay(path string, replay *Replay) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Write somewhere else first so that a crash halfway through doesn't take
+	// the last good copy with it.
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(replay)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func LoadReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var replay Replay
+	if err := gob.NewDecoder(f).Decode(&replay); err != nil {
+		return nil, fmt.Errorf("couldn't read replay %q: %w", path, err)
+	}
+	return &replay, nil
+}
+
+// Every game that's played leaves a replay behind, only this many of the
+// most recent ones are kept.
+const numReplays = 20
+
+func replaysDir() string {
+	return filepath.Join(base.GetDataDir(), "replays")
+}
+
+// Removes all but the newest 'keep' replays in 'dir'.
+func pruneReplays(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type replayFileInfo struct {
+		path string
+		mod  time.Time
+	}
+	var replays []replayFileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".replay" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		replays = append(replays, replayFileInfo{filepath.Join(dir, entry.Name()), info.ModTime()})
+	}
+	if len(replays) <= keep {
+		return
+	}
+	sort.Slice(replays, func(i, j int) bool {
+		return replays[i].mod.After(replays[j].mod)
+	})
+	for _, replay := range replays[keep:] {
+		if err := os.Remove(replay.path); err != nil {
+			logging.Warn("couldn't remove old replay", "path", replay.path, "err", err)
+		}
+	}
+}
+
+// Returns a map from the name of each replay to the path of its file.
+func GetAllReplays() map[string]string {
+	root := replaysDir()
+	replays := make(map[string]string)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return replays
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".replay" {
+			continue
+		}
+		replays[strings.TrimSuffix(name, ".replay")] = filepath.Join(root, name)
+	}
+	return replays
+}
+
+// Keeps a Replay of the game that a gameScript is running up to date and
+// writes it out at the end of every turn. A nil *replayRecorder records
+// nothing.
+type replayRecorder struct {
+	path   string
+	replay Replay
+}
+
+func makeReplayRecorder(scenario Scenario) *replayRecorder {
+	// Make room for this one.
+	pruneReplays(replaysDir(), numReplays-1)
+	name := strings.TrimSuffix(filepath.Base(scenario.Script), filepath.Ext(scenario.Script))
+	name = fmt.Sprintf("%s-%s.replay", name, time.Now().Format("20060102-150405"))
+	return &replayRecorder{
+		path:   filepath.Join(replaysDir(), name),
+		replay: Replay{Scenario: scenario},
+	}
+}
+
+func (rr *replayRecorder) current() *ReplayTurn {
+	if len(rr.replay.Turns) == 0 {
+		return nil
+	}
+	return &rr.replay.Turns[len(rr.replay.Turns)-1]
+}
+
+// Records the state the game started from, unless that's already known.
+// 'state' is only called if it's needed.
+func (rr *replayRecorder) setInitial(state func() []byte) {
+	if rr == nil || rr.replay.Initial != nil {
+		return
+	}
+	rr.replay.Initial = state()
+}
+
+func (rr *replayRecorder) startTurn(g *Game, before []byte) {
+	if rr == nil {
+		return
+	}
+	rr.setInitial(func() []byte { return before })
+	rr.replay.Turns = append(rr.replay.Turns, ReplayTurn{
+		Round:  (g.Turn + 1) / 2,
+		Side:   g.Side,
+		Before: before,
+	})
+}
+
+// Tells whether the turn that 'g' is on has already been started.
+func (rr *replayRecorder) inTurn(g *Game) bool {
+	turn := rr.current()
+	return turn != nil && turn.Round == (g.Turn+1)/2 && turn.Side == g.Side
+}
+
+func (rr *replayRecorder) exec(exec ActionExec) {
+	if rr == nil {
+		return
+	}
+	turn := rr.current()
+	if turn == nil {
+		logging.Warn("replay got an exec before any turn started", "exec", exec)
+		return
+	}
+	turn.Execs = append(turn.Execs, exec)
+}
+
+// Number of execs recorded so far in the current turn.
+func (rr *replayRecorder) turnExecs() int {
+	if rr == nil || rr.current() == nil {
+		return 0
+	}
+	return len(rr.current().Execs)
+}
+
+// Forgets all but the first 'n' execs of the current turn, they were undone.
+func (rr *replayRecorder) rewind(n int) {
+	if rr == nil || rr.current() == nil {
+		return
+	}
+	turn := rr.current()
+	if n < len(turn.Execs) {
+		turn.Execs = turn.Execs[:n]
+	}
+}
+
+func (rr *replayRecorder) endTurn(after []byte) {
+	if rr == nil {
+		return
+	}
+	if turn := rr.current(); turn != nil {
+		turn.After = after
+	}
+	rr.save()
+}
+
+func (rr *replayRecorder) save() {
+	err := SaveReplay(rr.path, &rr.replay)
+	if err != nil {
+		logging.Error("couldn't save replay", "path", rr.path, "err", err)
+	}
+}
+
+// Gets the state of the game the same way Script.SaveGameState would. Must be
+// called from the script's goroutine.
+func (gs *gameScript) saveState(g *Game) []byte {
+	buf := bytes.NewBuffer(nil)
+	gs.L.GetGlobal("store")
+	LuaEncodeValue(buf, gs.L, -1)
+	gs.L.Pop(1)
+	gs.syncStart()
+	defer gs.syncEnd()
+	str, err := base.ToGobToBase64(totalState{Game: &g, Store: buf.Bytes()})
+	if err != nil {
+		logging.Error("couldn't save game state", "err", err)
+		return nil
+	}
+	return []byte(str)
+}
+
+// Run by Script.DoExec when the other side's turn is played back.
+func (gs *gameScript) recordPlaybackExec(g *Game, exec ActionExec) {
+	if gs.replay == nil {
+		return
+	}
+	if !gs.replay.inTurn(g) {
+		// Playback always starts by loading the state that the other player
+		// started their turn from.
+		if gs.replay.current() != nil {
+			gs.replay.save()
+		}
+		gs.replay.startTurn(g, gs.saveState(g))
+	}
+	gs.replay.exec(exec)
+}
+
+var errEmptyReplay = errors.New("There's nothing in that replay.")
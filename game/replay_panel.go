@@ -0,0 +1,232 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/caffeine-storm/glop/gui"
+)
+
+// Plays a Replay back in a GamePanel. Like a spectator the viewer can only
+// look, but they also get to pause, step through one exec or one round at a
+// time and seek to any point in the game.
+type replayPlayer struct {
+	replay *Replay
+
+	// Where playback is up to: the next exec to play is
+	// replay.Turns[turn].Execs[exec]. Once turn reaches len(replay.Turns)
+	// the replay is over.
+	turn, exec int
+
+	paused bool
+
+	// Everything that changes the above runs on the goroutine doing the
+	// playback, the rest of the panel hands it work through here.
+	cmds chan func()
+}
+
+func StartReplayPanel(replay *Replay) (*GamePanel, error) {
+	if len(replay.Turns) == 0 {
+		return nil, errEmptyReplay
+	}
+	var gp GamePanel
+	gp.ClearCanvas()
+	gp.script = &gameScript{sync: make(chan struct{})}
+	err := gp.loadSpectatedState(replay.Turns[0].Before, SideHaunt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the game: %w", err)
+	}
+	gp.replay = &replayPlayer{
+		replay: replay,
+		cmds:   make(chan func(), 10),
+	}
+	go gp.playReplay()
+	return &gp, nil
+}
+
+// Adds a panel to 'ui' that plays back the replay at 'path'.
+func InsertReplayPanel(ui gui.WidgetParent, path string) error {
+	replay, err := LoadReplay(path)
+	if err != nil {
+		return err
+	}
+	gp, err := StartReplayPanel(replay)
+	if err != nil {
+		return err
+	}
+	ui.AddChild(gp)
+	return nil
+}
+
+func (p *replayPlayer) done() bool {
+	return p.turn >= len(p.replay.Turns)
+}
+
+func (p *replayPlayer) send(cmd func()) {
+	select {
+	case p.cmds <- cmd:
+	default:
+		// Someone is mashing keys faster than the execs can play out.
+	}
+}
+
+func (gp *GamePanel) playReplay() {
+	p := gp.replay
+	for {
+		gp.setReplayStatus()
+		if p.paused || p.done() {
+			(<-p.cmds)()
+			continue
+		}
+		select {
+		case cmd := <-p.cmds:
+			cmd()
+		default:
+			gp.replayStep()
+		}
+	}
+}
+
+// Plays the next exec, or moves on to the start of the next turn if there
+// are no more execs in this one.
+func (gp *GamePanel) replayStep() {
+	p := gp.replay
+	if p.done() {
+		return
+	}
+	turn := &p.replay.Turns[p.turn]
+	if p.exec < len(turn.Execs) {
+		gp.spectateExec(turn.Execs[p.exec])
+		p.exec++
+		return
+	}
+	gp.replaySeek(p.turn+1, 0)
+}
+
+// Jumps to just before exec 'exec' of turn 'turn'. Getting to an exec
+// partway through a turn means playing out the ones before it.
+func (gp *GamePanel) replaySeek(turn, exec int) {
+	p := gp.replay
+	turns := p.replay.Turns
+	if turn < 0 {
+		turn = 0
+	}
+	if turn >= len(turns) {
+		// Show how the game ended, as best we know it.
+		last := turns[len(turns)-1]
+		if last.After != nil {
+			gp.replayLoad(last.After)
+		}
+		p.turn, p.exec = len(turns), 0
+		return
+	}
+	gp.replayLoad(turns[turn].Before)
+	p.turn, p.exec = turn, 0
+	for p.exec < exec && p.exec < len(turns[turn].Execs) {
+		gp.spectateExec(turns[turn].Execs[p.exec])
+		p.exec++
+	}
+}
+
+func (gp *GamePanel) replayLoad(state []byte) {
+	err := gp.syncLoadSpectatedState(state)
+	if err != nil {
+		gp.setSpectatorError(fmt.Sprintf("Couldn't load the replay: %v", err))
+	}
+}
+
+func (gp *GamePanel) setReplayStatus() {
+	p := gp.replay
+	var status string
+	if p.done() {
+		status = "End of replay"
+	} else {
+		turn := p.replay.Turns[p.turn]
+		side := "Denizens"
+		if turn.Side == SideExplorers {
+			side = "Intruders"
+		}
+		status = fmt.Sprintf("Round %d, %s: %d of %d", turn.Round, side, p.exec, len(turn.Execs))
+		if p.paused {
+			status += " (paused)"
+		}
+	}
+	gp.script.syncStart()
+	defer gp.script.syncEnd()
+	gp.game.spectator.replay = status
+}
+
+// Jumps to the start of turn 'turn' and plays up to exec 'exec' of it, then
+// pauses there.
+func (gp *GamePanel) SeekReplay(turn, exec int) {
+	if gp.replay == nil {
+		return
+	}
+	p := gp.replay
+	p.send(func() {
+		p.paused = true
+		gp.replaySeek(turn, exec)
+	})
+}
+
+// The keys a replay responds to. Pressing a key along with a modifier, e.g.
+// "shift+r", presses the key on its own as well, so bindings with modifiers
+// have to come before any without.
+var replayBindings = []string{
+	"replay start",
+	"replay end",
+	"replay pause",
+	"replay step",
+	"replay next round",
+	"replay previous round",
+}
+
+// Returns the replay binding that 'group' presses, or "" if it doesn't press
+// any of them.
+func replayKeyPressed(group gui.EventGroup) string {
+	keys := base.GetDefaultKeyMap()
+	for _, name := range replayBindings {
+		if group.IsPressed(keys[name].Id()) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (gp *GamePanel) respondToReplay(group gui.EventGroup) bool {
+	p := gp.replay
+	switch replayKeyPressed(group) {
+	case "replay pause":
+		p.send(func() {
+			p.paused = !p.paused
+		})
+	case "replay step":
+		p.send(func() {
+			p.paused = true
+			gp.replayStep()
+		})
+	case "replay next round":
+		p.send(func() {
+			p.paused = true
+			gp.replaySeek(p.turn+1, 0)
+		})
+	case "replay start":
+		gp.SeekReplay(0, 0)
+	case "replay end":
+		gp.SeekReplay(len(p.replay.Turns), 0)
+	case "replay previous round":
+		p.send(func() {
+			p.paused = true
+			// Like the back button on a music player, go back to the start of
+			// this turn unless we're already there.
+			if p.exec == 0 || p.done() {
+				gp.replaySeek(p.turn-1, 0)
+			} else {
+				gp.replaySeek(p.turn, 0)
+			}
+		})
+	default:
+		return false
+	}
+	return true
+}
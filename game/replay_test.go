@@ -0,0 +1,137 @@
+package game_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/caffeine-storm/glop/gin"
+	"github.com/caffeine-storm/glop/gui"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplay(t *testing.T) {
+	Convey("Replays", t, func() {
+		replay := &game.Replay{
+			Scenario: game.Scenario{Script: "Lvl01.lua", HouseName: "Lvl_01_Haunted_House", Seed: 7},
+			Initial:  []byte("the state before anything happened"),
+			Turns: []game.ReplayTurn{
+				{
+					Round:  1,
+					Side:   game.SideHaunt,
+					Before: []byte("the state before anything happened, and then some"),
+					Execs: []game.ActionExec{
+						&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 1}, Hp: 3},
+					},
+					After: []byte("the state after the denizens moved"),
+				},
+				{
+					Round:  1,
+					Side:   game.SideExplorers,
+					Before: []byte("the state after the denizens moved, and then some"),
+					Execs: []game.ActionExec{
+						&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 2}, Hp: 4},
+						&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 1}, Hp: 0},
+					},
+					// Never finished.
+				},
+			},
+		}
+
+		Convey("survive a gob round trip", func() {
+			buf := bytes.NewBuffer(nil)
+			So(gob.NewEncoder(buf).Encode(replay), ShouldBeNil)
+			var decoded game.Replay
+			So(gob.NewDecoder(buf).Decode(&decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, *replay)
+		})
+
+		Convey("can be saved and loaded", func() {
+			path := filepath.Join(t.TempDir(), "replays", "test.replay")
+			So(game.SaveReplay(path, replay), ShouldBeNil)
+			loaded, err := game.LoadReplay(path)
+			So(err, ShouldBeNil)
+			So(loaded, ShouldResemble, replay)
+		})
+
+		Convey("are pruned down to the newest ones", func() {
+			dir := t.TempDir()
+			start := time.Now().Add(-time.Hour)
+			for i := 0; i < 5; i++ {
+				path := filepath.Join(dir, fmt.Sprintf("replay-%d.replay", i))
+				So(os.WriteFile(path, nil, 0644), ShouldBeNil)
+				mod := start.Add(time.Duration(i) * time.Minute)
+				So(os.Chtimes(path, mod, mod), ShouldBeNil)
+			}
+			So(os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644), ShouldBeNil)
+
+			game.PruneReplays(dir, 2)
+			entries, err := os.ReadDir(dir)
+			So(err, ShouldBeNil)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			So(names, ShouldResemble, []string{"notes.txt", "replay-3.replay", "replay-4.replay"})
+		})
+	})
+}
+
+// Presses and releases 'binding', e.g. "shift+r", and returns the replay
+// bindings that the resulting event groups pressed.
+func pressReplayKeys(binding string) []string {
+	var keys []gin.KeyIndex
+	for _, part := range strings.Split(binding, "+") {
+		if part == "shift" {
+			keys = append(keys, gin.LeftShift)
+		} else {
+			keys = append(keys, gin.KeyIndex(part[0]))
+		}
+	}
+	var events []gin.OsEvent
+	press := func(key gin.KeyIndex, amt float64) {
+		events = append(events, gin.OsEvent{
+			KeyId: gin.KeyId{
+				Index:  key,
+				Device: gin.DeviceId{Type: gin.DeviceTypeKeyboard, Index: 1},
+			},
+			Press_amt:   amt,
+			TimestampMs: int64(len(events) + 1),
+		})
+	}
+	for _, key := range keys {
+		press(key, 1)
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		press(keys[i], 0)
+	}
+
+	var pressed []string
+	for _, group := range gin.In().Think(int64(len(events)+1), events) {
+		if name := game.ReplayKeyPressed(gui.EventGroup{EventGroup: group}); name != "" {
+			pressed = append(pressed, name)
+		}
+	}
+	return pressed
+}
+
+func TestReplayKeys(t *testing.T) {
+	Convey("Each replay key does exactly what it's bound to", t, func() {
+		base.SetDatadir("../data")
+		var binds base.KeyBinds
+		So(base.LoadJson(filepath.Join(base.GetDataDir(), "key_binds.json"), &binds), ShouldBeNil)
+		base.SetDefaultKeyMap(binds.MakeKeyMap())
+
+		for _, name := range []string{"replay start", "replay end", "replay pause", "replay step", "replay next round", "replay previous round"} {
+			So(binds[name], ShouldNotBeEmpty)
+			So(pressReplayKeys(binds[name]), ShouldResemble, []string{name})
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package game
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/mrgnet"
+)
+
+// Which level scripts and Ais get run in a sandbox. Level scripts for online
+// games are always sandboxed, see levelSandboxed. A sandboxed script only
+// sees the parts of the standard library that can't reach anything outside
+// the game, see luaSandboxGlobals, along with the game's own bindings:
+// Script.*, Net.* and the Ai bindings. There's no io, no os beyond telling
+// the time, no debug and no way to load more code.
+type LuaSandbox int32
+
+const (
+	// Sandbox scripts that come from outside the data directory, e.g. levels
+	// that people have shared.
+	LuaSandboxOutsideData LuaSandbox = iota
+
+	LuaSandboxAlways
+	LuaSandboxNever
+)
+
+var lua_sandbox atomic.Int32
+
+func SetLuaSandbox(mode LuaSandbox) {
+	lua_sandbox.Store(int32(mode))
+}
+
+var luaSandboxNames = map[LuaSandbox]string{
+	LuaSandboxOutsideData: "data",
+	LuaSandboxAlways:      "on",
+	LuaSandboxNever:       "off",
+}
+
+// The name that -sandbox takes on the command line.
+func (mode LuaSandbox) String() string {
+	return luaSandboxNames[mode]
+}
+
+func ParseLuaSandbox(name string) (LuaSandbox, error) {
+	for mode, mode_name := range luaSandboxNames {
+		if name == mode_name {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("sandbox has to be data, on or off, not %q", name)
+}
+
+// Whether the script at 'path' should be run in a sandbox.
+func LuaSandboxed(path string) bool {
+	switch LuaSandbox(lua_sandbox.Load()) {
+	case LuaSandboxAlways:
+		return true
+	case LuaSandboxNever:
+		return false
+	}
+	data, err := filepath.Abs(base.GetDataDir())
+	if err != nil {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return true
+	}
+	rel, err := filepath.Rel(data, abs)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Whether the level script at 'path' should be run in a sandbox. Online
+// games, those with a 'game_key', run whatever script the server has for
+// them, which could have come from the other player, so they always are.
+func levelSandboxed(path string, game_key mrgnet.GameKey) bool {
+	return game_key != "" || LuaSandboxed(path)
+}
+
+// Everything a sandboxed script can see before any bindings are added, and
+// for tables, which of their fields. A table that's listed without any
+// fields is kept whole.
+var luaSandboxGlobals = map[string][]string{
+	"_G":           nil,
+	"_VERSION":     nil,
+	"assert":       nil,
+	"error":        nil,
+	"getmetatable": nil,
+	"ipairs":       nil,
+	"next":         nil,
+	"pairs":        nil,
+	"print":        nil,
+	"rawequal":     nil,
+	"rawget":       nil,
+	"rawset":       nil,
+	"select":       nil,
+	"setmetatable": nil,
+	"tonumber":     nil,
+	"tostring":     nil,
+	"type":         nil,
+	"unpack":       nil,
+
+	"coroutine": nil,
+	"math":      nil,
+	"table":     nil,
+	"string": {
+		"byte", "char", "find", "format", "gmatch", "gsub", "len", "lower",
+		"match", "rep", "reverse", "sub", "upper",
+	},
+	"os": {"clock", "date", "difftime", "time"},
+}
+
+// Opens the standard libraries on L, or, if 'sandboxed' is set, only the
+// parts of them that are in luaSandboxGlobals.
+func LuaOpenLibs(L *lua.State, sandboxed bool) {
+	if !sandboxed {
+		L.OpenLibs()
+		return
+	}
+	L.OpenBase()
+	L.OpenMath()
+	L.OpenOS()
+	L.OpenString()
+	L.OpenTable()
+
+	var drop []string
+	L.PushNil()
+	for L.Next(lua.LUA_GLOBALSINDEX) != 0 {
+		L.Pop(1)
+		if L.Type(-1) != lua.LUA_TSTRING {
+			continue
+		}
+		if _, ok := luaSandboxGlobals[L.ToString(-1)]; !ok {
+			drop = append(drop, L.ToString(-1))
+		}
+	}
+	for _, name := range drop {
+		L.PushNil()
+		L.SetGlobal(name)
+	}
+
+	for name, fields := range luaSandboxGlobals {
+		if fields == nil {
+			continue
+		}
+		L.GetGlobal(name)
+		L.NewTable()
+		for _, field := range fields {
+			L.GetField(-2, field)
+			L.SetField(-2, field)
+		}
+		L.SetGlobal(name)
+		L.Pop(1)
+	}
+}
@@ -0,0 +1,77 @@
+package game_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLuaSandbox(t *testing.T) {
+	Convey("Lua sandbox", t, func() {
+		base.SetDatadir("../data")
+		defer game.SetLuaSandbox(game.LuaSandboxOutsideData)
+
+		// Returns the type of what 'expr' evaluates to in a fresh state.
+		typeOf := func(sandboxed bool, expr string) string {
+			L := lua.NewState()
+			defer L.Close()
+			game.LuaOpenLibs(L, sandboxed)
+			So(L.DoString("result = type("+expr+")"), ShouldBeNil)
+			L.GetGlobal("result")
+			defer L.Pop(1)
+			return L.ToString(-1)
+		}
+
+		Convey("hides everything that can reach outside the game", func() {
+			for _, expr := range []string{"io", "debug", "package", "require", "dofile", "loadfile", "loadstring", "os.execute", "os.remove", "os.getenv", "string.dump"} {
+				So(typeOf(true, expr), ShouldEqual, "nil")
+			}
+		})
+
+		Convey("keeps the rest", func() {
+			for _, expr := range []string{"pairs", "tostring", "math.floor", "table.insert", "string.format", "os.time", "coroutine.wrap"} {
+				So(typeOf(true, expr), ShouldEqual, "function")
+			}
+			So(typeOf(true, `("x"):rep(2)`), ShouldEqual, "string")
+		})
+
+		Convey("isn't applied unless asked for", func() {
+			So(typeOf(false, "io"), ShouldEqual, "table")
+			So(typeOf(false, "os.execute"), ShouldEqual, "function")
+		})
+
+		Convey("is on for scripts from outside the data directory", func() {
+			So(game.LuaSandboxed(filepath.Join(base.GetDataDir(), "scripts", "Lvl01.lua")), ShouldBeFalse)
+			So(game.LuaSandboxed(filepath.Join(base.GetDataDir(), "ais", "..", "..", "level.lua")), ShouldBeTrue)
+			So(game.LuaSandboxed(filepath.Join("testdata", "level.lua")), ShouldBeTrue)
+
+			game.SetLuaSandbox(game.LuaSandboxAlways)
+			So(game.LuaSandboxed(filepath.Join(base.GetDataDir(), "scripts", "Lvl01.lua")), ShouldBeTrue)
+			game.SetLuaSandbox(game.LuaSandboxNever)
+			So(game.LuaSandboxed(filepath.Join("testdata", "level.lua")), ShouldBeFalse)
+		})
+
+		Convey("is always on for online games", func() {
+			lvl01 := filepath.Join(base.GetDataDir(), "scripts", "Lvl01.lua")
+			So(game.LevelSandboxed(lvl01, ""), ShouldBeFalse)
+			So(game.LevelSandboxed(lvl01, "some-game"), ShouldBeTrue)
+
+			game.SetLuaSandbox(game.LuaSandboxNever)
+			So(game.LevelSandboxed(lvl01, "some-game"), ShouldBeTrue)
+		})
+
+		Convey("modes round-trip through their names", func() {
+			for _, mode := range []game.LuaSandbox{game.LuaSandboxOutsideData, game.LuaSandboxAlways, game.LuaSandboxNever} {
+				parsed, err := game.ParseLuaSandbox(mode.String())
+				So(err, ShouldBeNil)
+				So(parsed, ShouldEqual, mode)
+			}
+			_, err := game.ParseLuaSandbox("maybe")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,313 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/logging"
+)
+
+// Each player can have any number of saved games, each under a name of its
+// own. Saves live in datadir/saves/<player>/ and are a gob of the state in a
+// SaveFormat envelope, with a gob of the SaveInfo as its header. The SaveInfo
+// is in the header the same way player files have the name there, so listing
+// them doesn't mean reading every state. Next to each save is a small picture
+// of the board to help tell them apart.
+
+type SaveInfo struct {
+	// The name the player gave the save.
+	Name string
+
+	// The player the save belongs to.
+	Player string
+
+	// Whether the game made this save by itself, see autosave.
+	Auto bool
+
+	Time     time.Time
+	Scenario Scenario
+	Turn     int
+	Side     Side
+
+	// Where the save's data and thumbnail are, filled in when the save is
+	// listed or made rather than saved with it.
+	path string
+}
+
+func (si *SaveInfo) Path() string {
+	return si.path
+}
+
+func (si *SaveInfo) ThumbnailPath() string {
+	return strings.TrimSuffix(si.path, ".save") + ".png"
+}
+
+func (si *SaveInfo) Round() int {
+	return (si.Turn + 1) / 2
+}
+
+func savesDir(player string) string {
+	return filepath.Join(base.GetDataDir(), "saves", hashedName(player))
+}
+
+// Names are hashed, the same way player files are, so that they can be
+// anything at all without upsetting the filesystem.
+func hashedName(name string) string {
+	hash := fnv.New64()
+	hash.Write([]byte(name))
+	return fmt.Sprintf("%x", hash.Sum64())
+}
+
+// Saves the game in 'gp' under 'name' for 'player', replacing any save of
+// theirs that already has that name.
+func SaveGame(gp *GamePanel, player, name string) (*SaveInfo, error) {
+	if name == "" {
+		name = time.Now().Format("2006-01-02 15:04:05")
+	}
+	store := bytes.NewBuffer(nil)
+	gp.script.L.GetGlobal("store")
+	err := LuaEncodeValue(store, gp.script.L, -1)
+	gp.script.L.Pop(1)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode the script's store: %w", err)
+	}
+	state, err := base.ToGobToBase64(totalState{Game: &gp.game, Store: store.Bytes()})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode the game: %w", err)
+	}
+	info := makeSaveInfo(gp, player, name)
+	info.path = filepath.Join(savesDir(player), hashedName(name)+".save")
+	if err := writeGameSave(info, state, gp.game); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func makeSaveInfo(gp *GamePanel, player, name string) *SaveInfo {
+	return &SaveInfo{
+		Name:     name,
+		Player:   player,
+		Time:     time.Now(),
+		Scenario: gp.scenario,
+		Turn:     gp.game.Turn,
+		Side:     gp.game.Side,
+	}
+}
+
+// Writes 'state' to the save described by 'info' along with a thumbnail of
+// 'g'.
+func writeGameSave(info *SaveInfo, state string, g *Game) error {
+	if err := os.MkdirAll(filepath.Dir(info.path), 0755); err != nil {
+		return err
+	}
+	if err := writeSave(info, state); err != nil {
+		return err
+	}
+	if err := writeThumbnail(info.ThumbnailPath(), g); err != nil {
+		// A save without a picture is still a save.
+		logging.Warn("couldn't make save thumbnail", "save", info.Name, "err", err)
+	}
+	return nil
+}
+
+func writeSave(info *SaveInfo, state string) error {
+	header := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(header).Encode(info); err != nil {
+		return err
+	}
+	payload := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(payload).Encode(state); err != nil {
+		return err
+	}
+	// Write somewhere else first so that a crash halfway through doesn't take
+	// the last good copy with it.
+	tmp := info.path + ".tmp"
+	if err := os.WriteFile(tmp, encodeHeaderedEnvelope(SaveFormat, header.Bytes(), payload.Bytes()), 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, info.path)
+}
+
+// Reads just enough of the save at 'path' to describe it.
+func readSaveInfo(path string) (*SaveInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header, _, err := readEnvelopeHeader(bufio.NewReader(f), SaveFormat)
+	if err != nil {
+		return nil, err
+	}
+	var info SaveInfo
+	if err := gob.NewDecoder(bytes.NewReader(header)).Decode(&info); err != nil {
+		return nil, err
+	}
+	info.path = path
+	return &info, nil
+}
+
+// Saves used to have the SaveInfo ahead of the state in the payload.
+func stripSaveInfo(payload []byte) ([]byte, error) {
+	dec := gob.NewDecoder(bytes.NewReader(payload))
+	var info SaveInfo
+	if err := dec.Decode(&info); err != nil {
+		return nil, err
+	}
+	var state string
+	if err := dec.Decode(&state); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(state)
+	return buf.Bytes(), err
+}
+
+// Lists the saves that belong to 'player', newest first.
+func GetSaves(player string) []*SaveInfo {
+	paths, _ := filepath.Glob(filepath.Join(savesDir(player), "*.save"))
+	return readSaveInfos(paths)
+}
+
+// Lists every player's saves, newest first.
+func GetAllSaves() []*SaveInfo {
+	paths, _ := filepath.Glob(filepath.Join(base.GetDataDir(), "saves", "*", "*.save"))
+	return readSaveInfos(paths)
+}
+
+func readSaveInfos(paths []string) []*SaveInfo {
+	var saves []*SaveInfo
+	for _, path := range paths {
+		info, err := readSaveInfo(path)
+		if err != nil {
+			logging.Warn("Unable to read save", "path", path, "err", err)
+			continue
+		}
+		saves = append(saves, info)
+	}
+	sort.Slice(saves, func(i, j int) bool {
+		return saves[i].Time.After(saves[j].Time)
+	})
+	return saves
+}
+
+// Returns the state stored in a save, as made by Script.SaveGameState.
+func LoadSave(info *SaveInfo) (string, error) {
+	data, err := os.ReadFile(info.path)
+	if err != nil {
+		return "", err
+	}
+	_, payload, err := decodeHeaderedEnvelope(SaveFormat, data)
+	if err != nil {
+		return "", err
+	}
+	var state string
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&state); err != nil {
+		return "", fmt.Errorf("couldn't read save %q: %w", info.Name, err)
+	}
+	return state, nil
+}
+
+func DeleteSave(info *SaveInfo) error {
+	if err := os.Remove(info.path); err != nil {
+		return err
+	}
+	if err := os.Remove(info.ThumbnailPath()); err != nil && !os.IsNotExist(err) {
+		logging.Warn("couldn't remove save thumbnail", "save", info.Name, "err", err)
+	}
+	return nil
+}
+
+// Starts playing a saved game from where it was saved.
+func StartSavedGamePanel(info *SaveInfo) (*GamePanel, error) {
+	state, err := LoadSave(info)
+	if err != nil {
+		return nil, err
+	}
+	player := &Player{
+		Name:        info.Player,
+		Game_state:  state,
+		Script_path: info.Scenario.Script,
+		No_init:     true,
+	}
+	return StartGamePanel(info.Scenario, player, nil, "")
+}
+
+const (
+	thumbnailDx = 320
+	thumbnailDy = 240
+)
+
+// Draws the first floor of the house with a dot for each entity on it.
+func writeThumbnail(path string, g *Game) error {
+	img := image.NewRGBA(image.Rect(0, 0, thumbnailDx, thumbnailDy))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{20, 20, 25, 255}), image.Point{}, draw.Src)
+	if g.House == nil || len(g.House.Floors) == 0 || len(g.House.Floors[0].Rooms) == 0 {
+		return writePng(path, img)
+	}
+
+	rooms := g.House.Floors[0].Rooms
+	var maxx, maxy house.BoardSpaceUnit
+	for _, room := range rooms {
+		dx, dy := room.Dims()
+		maxx = max(maxx, room.X+dx)
+		maxy = max(maxy, room.Y+dy)
+	}
+	scale := min(float64(thumbnailDx-4)/float64(maxx), float64(thumbnailDy-4)/float64(maxy))
+	// Board coordinates go up the screen, images go down it.
+	rect := func(x, y, dx, dy float64) image.Rectangle {
+		x0 := 2 + int(x*scale)
+		y1 := thumbnailDy - 2 - int(y*scale)
+		return image.Rect(x0, y1-int(dy*scale), x0+int(dx*scale), y1)
+	}
+	for _, room := range rooms {
+		dx, dy := room.Dims()
+		r := rect(float64(room.X), float64(room.Y), float64(dx), float64(dy))
+		draw.Draw(img, r, image.NewUniform(color.RGBA{90, 90, 100, 255}), image.Point{}, draw.Src)
+		draw.Draw(img, r.Inset(1), image.NewUniform(color.RGBA{60, 60, 70, 255}), image.Point{}, draw.Src)
+	}
+	for _, ent := range g.Ents {
+		c := color.RGBA{220, 220, 80, 255}
+		switch ent.Side() {
+		case SideExplorers:
+			c = color.RGBA{80, 140, 255, 255}
+		case SideHaunt:
+			c = color.RGBA{230, 60, 60, 255}
+		}
+		x, y := ent.FloorPos()
+		r := rect(float64(x), float64(y), 1, 1)
+		if r.Dx() < 3 {
+			r.Max.X = r.Min.X + 3
+			r.Min.Y = r.Max.Y - 3
+		}
+		draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+	}
+	return writePng(path, img)
+}
+
+func writePng(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package game_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSaves(t *testing.T) {
+	Convey("Saved games", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		const player = "save-test-player"
+		// Leaves datadir/saves alone unless this made it.
+		defer os.Remove(filepath.Dir(game.SavesDir(player)))
+		defer os.RemoveAll(game.SavesDir(player))
+
+		g := givenAGame()
+		g.Turn = 5
+		g.Side = game.SideExplorers
+		scenario := game.Scenario{Script: "Lvl01.lua", HouseName: "Lvl_01_Haunted_House"}
+		gp, L, err := game.GivenASaveablePanel(g, scenario, `{found = 2}`)
+		So(err, ShouldBeNil)
+		defer L.Close()
+
+		info, err := game.SaveGame(gp, player, "before the attic")
+		So(err, ShouldBeNil)
+		So(info.Round(), ShouldEqual, 3)
+
+		Convey("are listed for the player that saved them", func() {
+			saves := game.GetSaves(player)
+			So(len(saves), ShouldEqual, 1)
+			So(saves[0].Name, ShouldEqual, "before the attic")
+			So(saves[0].Player, ShouldEqual, player)
+			So(saves[0].Scenario, ShouldResemble, scenario)
+			So(saves[0].Turn, ShouldEqual, 5)
+			So(saves[0].Side, ShouldEqual, game.SideExplorers)
+			So(saves[0].Path(), ShouldEqual, info.Path())
+			So(game.GetSaves("someone-else"), ShouldBeEmpty)
+		})
+
+		Convey("load back the game they were made from", func() {
+			state, err := game.LoadSave(game.GetSaves(player)[0])
+			So(err, ShouldBeNil)
+			loaded, err := game.DecodeGameState([]byte(state), givenASpriteManager())
+			So(err, ShouldBeNil)
+			So(loaded.Turn, ShouldEqual, 5)
+			So(loaded.StateChecksum(), ShouldEqual, g.StateChecksum())
+		})
+
+		Convey("replace older saves with the same name", func() {
+			g.Turn = 7
+			_, err := game.SaveGame(gp, player, "before the attic")
+			So(err, ShouldBeNil)
+			saves := game.GetSaves(player)
+			So(len(saves), ShouldEqual, 1)
+			So(saves[0].Turn, ShouldEqual, 7)
+		})
+
+		Convey("are still listed when the state is damaged", func() {
+			data, err := os.ReadFile(info.Path())
+			So(err, ShouldBeNil)
+			data[len(data)-1] ^= 0xff
+			So(os.WriteFile(info.Path(), data, 0644), ShouldBeNil)
+
+			saves := game.GetSaves(player)
+			So(len(saves), ShouldEqual, 1)
+			So(saves[0].Name, ShouldEqual, "before the attic")
+			_, err = game.LoadSave(saves[0])
+			So(err, ShouldWrap, game.ErrCorruptFile)
+		})
+
+		Convey("from before the header still list and load", func() {
+			state, err := game.LoadSave(info)
+			So(err, ShouldBeNil)
+			old := *info
+			old.Name = "from an older build"
+			buf := bytes.NewBuffer(nil)
+			enc := gob.NewEncoder(buf)
+			So(enc.Encode(&old), ShouldBeNil)
+			So(enc.Encode(state), ShouldBeNil)
+			path := filepath.Join(game.SavesDir(player), "old.save")
+			So(os.WriteFile(path, givenAVersion1Envelope(game.SaveFormat, buf.Bytes()), 0644), ShouldBeNil)
+
+			saves := game.GetSaves(player)
+			So(len(saves), ShouldEqual, 2)
+			var listed *game.SaveInfo
+			for _, save := range saves {
+				if save.Name == old.Name {
+					listed = save
+				}
+			}
+			So(listed, ShouldNotBeNil)
+			So(listed.Path(), ShouldEqual, path)
+			loaded, err := game.LoadSave(listed)
+			So(err, ShouldBeNil)
+			So(loaded, ShouldEqual, state)
+		})
+
+		Convey("are gone once deleted, thumbnail and all", func() {
+			So(game.DeleteSave(info), ShouldBeNil)
+			So(game.GetSaves(player), ShouldBeEmpty)
+			_, err := os.Stat(info.ThumbnailPath())
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			_, err = game.LoadSave(info)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
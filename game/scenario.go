@@ -5,4 +5,16 @@ type Scenario struct {
 	// filesystem path :(
 	Script    string
 	HouseName string
+
+	// If set, Script.LoadHouse loads the house with this name instead of the
+	// one the script asks for.
+	HouseOverride string
+
+	// If set, the script's side chooser, ui/start/versus/side.json, is
+	// answered with this instead of being shown.
+	Side string
+
+	// Seeds the game's random numbers when the script loads its house, if it
+	// isn't 0. Otherwise every game gets the same seed.
+	Seed int64
 }
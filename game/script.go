@@ -2,10 +2,15 @@ package game
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/MobRulesGames/golua/lua"
@@ -28,12 +33,56 @@ type gameScript struct {
 	// Since the scripts can do anything they want sometimes we want make sure
 	// certain things only run when the game is ready for them.
 	sync chan struct{}
+
+	// Records the game as it's played, nil if nothing should be recorded.
+	replay *replayRecorder
+
+	// Saves the game at the start of each turn, nil for online games.
+	autosaver func()
+
+	// Closed by GamePanel.stopScript, after which the script's goroutines
+	// quit the next time they wait on the game.
+	done chan struct{}
+
+	// The script's goroutines, see goRun.
+	running sync.WaitGroup
 }
 
 func (gs *gameScript) syncStart() {
 	<-gs.sync
 }
 
+// Runs 'f' on a goroutine of its own that GamePanel.stopScript waits for.
+func (gs *gameScript) goRun(f func()) {
+	gs.running.Add(1)
+	go func() {
+		defer gs.running.Done()
+		f()
+	}()
+}
+
+// Hands 'v' to the game. Must only be called by a goroutine from goRun, and
+// not from inside the Lua state, since the goroutine exits here if the
+// script has been stopped.
+func (gs *gameScript) toGame(g *Game, v interface{}) {
+	select {
+	case g.comm.script_to_game <- v:
+	case <-gs.done:
+		runtime.Goexit()
+	}
+}
+
+// Waits for the game, see toGame.
+func (gs *gameScript) fromGame(g *Game) interface{} {
+	select {
+	case v := <-g.comm.game_to_script:
+		return v
+	case <-gs.done:
+		runtime.Goexit()
+		return nil
+	}
+}
+
 func (gs *gameScript) syncEnd() {
 	gs.sync <- struct{}{}
 }
@@ -42,9 +91,9 @@ func (gs *gameScript) mustRunString(cmd string) {
 	gs.L.MustDoString(cmd)
 }
 
-func makeNewLuaState(gp *GamePanel, player *Player, isOnline bool) *lua.State {
+func makeNewLuaState(gp *GamePanel, player *Player, isOnline bool, sandboxed bool) *lua.State {
 	ret := lua.NewState()
-	ret.OpenLibs()
+	LuaOpenLibs(ret, sandboxed)
 	ret.SetExecutionLimit(25000)
 	ret.NewTable()
 
@@ -121,9 +170,10 @@ func makeNewLuaState(gp *GamePanel, player *Player, isOnline bool) *lua.State {
 	return ret
 }
 
-func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[string]string, game_key mrgnet.GameKey) {
+func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[string]string, game_key mrgnet.GameKey) error {
 	// Clear out the panel, now the script can do whatever it wants
 	player.Script_path = scenario.Script
+	gp.scenario = scenario
 	gp.ClearCanvas()
 	logging.Debug("startGameScript", "scenario", scenario)
 	if scenario.Script != "" && !filepath.IsAbs(scenario.Script) {
@@ -135,14 +185,25 @@ func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[
 	// write this comment?
 	prog, err := os.ReadFile(scenario.Script)
 	if err != nil {
-		logging.Error("Unable to load game script", "scenario", scenario, "err", err)
-		return
+		return fmt.Errorf("unable to load game script: %w", err)
 	}
 
-	luaState := makeNewLuaState(gp, player, string(game_key) != "")
+	sandboxed := levelSandboxed(scenario.Script, game_key)
+	if sandboxed {
+		logging.Info("running game script in a sandbox", "script", scenario.Script)
+	}
+	luaState := makeNewLuaState(gp, player, string(game_key) != "" || gp.hotseat != nil, sandboxed)
 	gp.script = &gameScript{
 		L:    luaState,
 		sync: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if !headless {
+		gp.script.replay = makeReplayRecorder(scenario)
+	}
+	if game_key == "" && !headless {
+		gs := gp.script
+		gs.autosaver = func() { gs.autosave(gp, player.Name) }
 	}
 
 	if player.Lua_store != nil {
@@ -171,18 +232,22 @@ func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[
 	// the calling goroutine? I'd much rather just call a function.
 	gameStartChan := make(chan error)
 
-	go func() {
+	// Online games have to hear back from the server before they can start.
+	startupDeadline := time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), onlineRequestTimeout)
+	defer cancel()
+	if game_key != "" {
+		startupDeadline += onlineRequestTimeout
+	}
+
+	gp.script.goRun(func() {
 		if game_key != "" {
 			var net_id mrgnet.NetId
 			fmt.Sscanf(base.GetStoreVal("netid"), "%d", &net_id)
-			var req mrgnet.StatusRequest
-			req.Game_key = game_key
-			req.Id = net_id
-			var resp mrgnet.StatusResponse
-			mrgnet.DoAction("status", req, &resp)
-			if resp.Err != "" {
-				logging.Error("mrgnet.DoAction returned an error response", "err", resp.Err)
-				gameStartChan <- fmt.Errorf("gameStart failure: %s", resp.Err)
+			resp, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Game_key: game_key, Id: net_id})
+			if err != nil {
+				logging.Error("couldn't get game status", "err", err)
+				gameStartChan <- fmt.Errorf("gameStart failure: %w", err)
 				return
 			}
 
@@ -193,8 +258,7 @@ func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[
 					req.Id = net_id
 					req.Game_key = game_key
 					req.Script = prog
-					var resp mrgnet.UpdateGameResponse
-					err := mrgnet.DoAction("update", req, &resp)
+					_, err := mrgnet.UpdateGame(ctx, req)
 					if err != nil {
 						gameStartChan <- fmt.Errorf("unable to make initial update: %w", err)
 						return
@@ -231,6 +295,8 @@ func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[
 
 					gp.game.net.game = resp.Game
 					gp.game.net.key = game_key
+					gp.game.net.script = scenario.Script
+					gp.game.net.latest_state = states
 					gp.game.Turn = len(resp.Game.Execs) + 1
 
 					if net_id == resp.Game.Denizens_id {
@@ -262,6 +328,7 @@ func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[
 			gp.game = makeGameTheWrongWay(scenario)
 			gameStartChan <- nil
 			gp.game.script = gp.script
+			gp.game.tally = gp.tally
 			gp.ClearCanvas()
 			gp.AddChild(gp.game.viewer, gui.Anchor{Wx: 0.5, Wy: 0.5, Bx: 0.5, By: 0.5})
 			gp.AddChild(MakeOverlay(gp.game), gui.Anchor{Wx: 0.5, Wy: 0.5, Bx: 0.5, By: 0.5})
@@ -297,26 +364,28 @@ func startGameScript(gp *GamePanel, scenario Scenario, player *Player, data map[
 			logging.Error("script failed to load a house during Init()")
 		} else {
 			gp.game.net.key = game_key
-			gp.game.comm.script_to_game <- nil
+			gp.game.net.script = scenario.Script
+			gp.script.toGame(gp.game, nil)
 		}
-	}()
+	})
 
 	// On success cases, nil will get sent on the channel.
 	select {
 	case gameStartErr := <-gameStartChan:
 		if gameStartErr != nil {
-			panic(fmt.Errorf("couldnt' create a game: %w", gameStartErr))
+			return gameStartErr
 		}
 		logging.Debug("game started")
-	case <-time.After(1 * time.Second):
-		panic(fmt.Errorf("game startup deadline exceeded"))
+	case <-time.After(startupDeadline):
+		return fmt.Errorf("game startup deadline exceeded")
 	}
+	return nil
 }
 
 func (gs *gameScript) OnRoundWaiting(g *Game) {
 	g.Side = g.net.side
 	g.Turn--
-	go func() {
+	gs.goRun(func() {
 		// // round begins automatically
 		// <-round_middle
 		// for
@@ -331,11 +400,11 @@ func (gs *gameScript) OnRoundWaiting(g *Game) {
 		// gs.L.DoString(cmd)
 
 		// signals to the game that we're done with the startup stuff
-		g.comm.script_to_game <- nil
+		gs.toGame(g, nil)
 		// base.Log().Printf("ScriptComm: Done with RoundStart")
 
 		g.player_inactive = true
-		_exec := <-g.comm.game_to_script
+		_exec := gs.fromGame(g)
 		if _exec != nil {
 			panic("Got an exec when we shouldn't have gotten one.")
 		}
@@ -343,16 +412,17 @@ func (gs *gameScript) OnRoundWaiting(g *Game) {
 		gs.L.SetExecutionLimit(250000)
 		base.DeprecatedLog().Printf("Doing RoundEnd(%t, %d)", g.Side == SideExplorers, (g.Turn+1)/2)
 		gs.mustRunString(fmt.Sprintf("RoundEnd(%t, %d)", g.Side == SideExplorers, (g.Turn+1)/2))
+		gs.checkPlaybackChecksum(g)
 
 		base.DeprecatedLog().Printf("ScriptComm: Starting the RoundEnd phase out")
-		g.comm.script_to_game <- nil
+		gs.toGame(g, nil)
 		base.DeprecatedLog().Printf("ScriptComm: Starting the RoundEnd phase in")
 
 		// Signal that we're done with the round end
 		base.DeprecatedLog().Printf("ScriptComm: Done with the RoundEnd phase in")
-		g.comm.script_to_game <- nil
+		gs.toGame(g, nil)
 		base.DeprecatedLog().Printf("ScriptComm: Done with the RoundEnd phase out")
-	}()
+	})
 }
 
 // Runs RoundStart
@@ -370,28 +440,38 @@ func (gs *gameScript) OnRound(g *Game) {
 		panic(fmt.Errorf("gameScript.OnRound called on nil gameScript!"))
 	}
 	if gs.L == nil {
-		panic(fmt.Errorf("gameScript.OnRound called on invalid gameScript: %v", *gs))
+		panic(fmt.Errorf("gameScript.OnRound called on invalid gameScript: %+v", gs))
 	}
 
-	go func() {
+	gs.goRun(func() {
 		// // round begins automatically
 		// <-round_middle
 		// for
 		//   <-action stuff
 		// <- round end
 		// <- round end done
+		gs.replay.setInitial(func() []byte { return gs.saveState(g) })
 		cmd := fmt.Sprintf("RoundStart(%t, %d)", g.Side == SideExplorers, (g.Turn+1)/2)
 		logging.Debug("gameScript.OnRound", "script", gs, "state", gs.L, "cmd", cmd)
 		gs.L.SetExecutionLimit(250000)
 		gs.mustRunString(cmd)
+		if g.net.resume != nil {
+			gs.resumeTurn(g)
+		}
+		if gs.replay != nil {
+			gs.replay.startTurn(g, gs.saveState(g))
+		}
+		if gs.autosaver != nil {
+			gs.autosaver()
+		}
 
 		// signals to the game that we're done with the startup stuff
-		g.comm.script_to_game <- nil
+		gs.toGame(g, nil)
 		base.DeprecatedLog().Printf("ScriptComm: Done with RoundStart")
 
 		for {
 			logging.Debug("ScriptComm", "state", "waiting to verify action")
-			_exec := <-g.comm.game_to_script
+			_exec := gs.fromGame(g)
 			logging.Debug("ScriptComm", "state", "got exec", "_exec", _exec)
 			if _exec == nil {
 				logging.Debug("ScriptComm", "state", "no more exec")
@@ -426,14 +506,20 @@ func (gs *gameScript) OnRound(g *Game) {
 				}()
 			}
 
-			g.comm.script_to_game <- nil
+			gs.toGame(g, nil)
 
 			// The action is sent when it happens, and a nil is sent when it is done
 			// being executed, we want to wait until then so that the game is in a
 			// stable state before we do anything.
-			<-g.comm.game_to_script
+			gs.fromGame(g)
 			logging.Debug("ScriptComm", "state", "got action secondary")
 			// Run OnAction here
+			if g.net.journal != nil {
+				if err := g.net.journal.append(exec); err != nil {
+					logging.Error("couldn't journal exec", "err", err)
+				}
+			}
+			gs.replay.exec(exec)
 			gs.L.SetExecutionLimit(250000)
 			exec.Push(gs.L, g)
 			str, err := base.ToGobToBase64([]ActionExec{exec})
@@ -450,28 +536,33 @@ func (gs *gameScript) OnRound(g *Game) {
 			cmd = fmt.Sprintf("OnAction(%t, %d, %s)", g.Side == SideExplorers, (g.Turn+1)/2, "__exec")
 			logging.Debug("sending lua cmd", "cmd", cmd)
 			gs.mustRunString(cmd)
-			g.comm.script_to_game <- nil
+			gs.toGame(g, nil)
 			logging.Debug("ScriptComm", "state", "done with OnAction")
 		}
 
+		if gs.replay != nil {
+			gs.replay.endTurn(gs.saveState(g))
+		}
+
 		gs.L.SetExecutionLimit(250000)
 		gs.L.DoString(fmt.Sprintf("RoundEnd(%t, %d)", g.Side == SideExplorers, (g.Turn+1)/2))
+		gs.checkPlaybackChecksum(g)
 
 		logging.Debug("ScriptComm", "state", "starting the RoundEnd phase out")
-		g.comm.script_to_game <- nil
+		gs.toGame(g, nil)
 		logging.Debug("ScriptComm", "state", "starting the RoundEnd phase in")
 
 		// Signal that we're done with the round end
 		logging.Debug("ScriptComm", "state", "finishing the RoundEnd phase in")
-		g.comm.script_to_game <- nil
+		gs.toGame(g, nil)
 		logging.Debug("ScriptComm", "state", "finishing the RoundEnd phase out")
-	}()
+	})
 }
 
 // Can be called occassionally and will allow a script to progress whenever
 // it is ready
 func (gp *GamePanel) scriptThinkOnce() {
-	if gp.script.L == nil {
+	if gp.script == nil || gp.script.sync == nil {
 		return
 	}
 	done := false
@@ -489,6 +580,44 @@ func (gp *GamePanel) scriptThinkOnce() {
 	}
 }
 
+// How long stopScript gives the script to get to somewhere it can stop.
+const scriptStopTimeout = 5 * time.Second
+
+// Stops the script's goroutines and closes its Lua state. A goroutine could
+// be partway through something that needs the game, so the script keeps
+// getting its turn at it until they've all stopped.
+func (gp *GamePanel) stopScript() {
+	gs := gp.script
+	if gs == nil || gs.done == nil {
+		return
+	}
+	select {
+	case <-gs.done:
+		return
+	default:
+	}
+	close(gs.done)
+	stopped := make(chan struct{})
+	go func() {
+		gs.running.Wait()
+		close(stopped)
+	}()
+	timeout := time.After(scriptStopTimeout)
+	for {
+		select {
+		case gs.sync <- struct{}{}:
+			<-gs.sync
+		case <-stopped:
+			gs.L.Close()
+			return
+		case <-timeout:
+			// Closing the state out from under it would be worse than leaking it.
+			logging.Warn("game script didn't stop, leaving its Lua state open")
+			return
+		}
+	}
+}
+
 // TODO(tmckee:#34): I don't think this is actually used; it's referenced in a
 // .lua script that isn't itself referenced.
 func startScript(gp *GamePanel, player *Player) lua.LuaGoFunction {
@@ -510,8 +639,13 @@ func startScript(gp *GamePanel, player *Player) lua.LuaGoFunction {
 		scenario := Scenario{
 			Script:    script,
 			HouseName: gp.game.House.Name,
+			Side:      gp.scenario.Side,
+			Seed:      gp.scenario.Seed,
+		}
+		err := startGameScript(gp, scenario, player, nil, gp.game.net.key)
+		if err != nil {
+			logging.Error("StartScript failed", "script", script, "err", err)
 		}
-		startGameScript(gp, scenario, player, nil, gp.game.net.key)
 		return 0
 	}
 }
@@ -589,9 +723,52 @@ func doGameOnRound(gp *GamePanel) lua.LuaGoFunction {
 
 // TODO(tmckee:#24): writing to 'gp' is code smelly
 func loadGameStateRaw(gp *GamePanel, L *lua.State, state string) {
+	err := gp.loadGameState(state, func(store []byte) {
+		LuaDecodeValue(bytes.NewBuffer(store), L, gp.game)
+		if false {
+			L.GetGlobal("store")
+			// Other side's store on the stack, with our store on top, we're going to
+			// take every key/value pair from our store and put it into theirs, then
+			// that one becomes ours.
+			L.PushNil()
+			for L.Next(-2) != 0 {
+				// Stack: RemoteStore LocalStore K V
+				L.Pop(1)
+				// Stack: RemoteStore LocalStore K
+				L.PushValue(-1)
+				// Stack: RemoteStore LocalStore K K
+				L.PushValue(-1)
+				// Stack: RemoteStore LocalStore K K K
+				L.GetTable(-4)
+				// Stack: RemoteStore LocalStore K K V
+				L.SetTable(-5)
+				// Stack: RemoteStore LocalStore K
+				// So we can call next and repeat this process
+			}
+			// Stack: UpdateRemoteStore LocalStore
+			L.Pop(1)
+		}
+		L.SetGlobal("store")
+	})
+	if err != nil {
+		base.DeprecatedError().Printf("Error decoding game state: %v", err)
+	}
+}
+
+// Replaces the panel's game with the one in 'state', as produced by
+// Script.SaveGameState, keeping the player's view of the house where it was.
+// 'withStore' gets the script's store once the game has been decoded; it can
+// be nil if there's no script to give it to.
+func (gp *GamePanel) loadGameState(state string, withStore func(store []byte)) error {
+	return gp.replaceGame(state, withStore, true)
+}
+
+// Like loadGameState, but the current side's entities only get their
+// OnRound if 'onRound' is set.
+func (gp *GamePanel) replaceGame(state string, withStore func(store []byte), onRound bool) error {
 	var viewer gui.Widget
 	var hv_state house.HouseViewerState
-	if gp.game != nil {
+	if gp.game != nil && gp.game.viewer != nil {
 		viewer = gp.game.viewer
 		hv_state = gp.game.viewer.GetState()
 	}
@@ -599,40 +776,19 @@ func loadGameStateRaw(gp *GamePanel, L *lua.State, state string) {
 	ts.Game = &gp.game
 	err := base.FromBase64FromGob(&ts, state)
 	if err != nil {
-		base.DeprecatedError().Printf("Error decoding game state: %v", err)
-		return
+		return err
 	}
-	// gp.game = ts.Game
 	gp.game.script = gp.script
-	LuaDecodeValue(bytes.NewBuffer(ts.Store), L, gp.game)
-	if false {
-		L.GetGlobal("store")
-		// Other side's store on the stack, with our store on top, we're going to
-		// take every key/value pair from our store and put it into theirs, then
-		// that one becomes ours.
-		L.PushNil()
-		for L.Next(-2) != 0 {
-			// Stack: RemoteStore LocalStore K V
-			L.Pop(1)
-			// Stack: RemoteStore LocalStore K
-			L.PushValue(-1)
-			// Stack: RemoteStore LocalStore K K
-			L.PushValue(-1)
-			// Stack: RemoteStore LocalStore K K K
-			L.GetTable(-4)
-			// Stack: RemoteStore LocalStore K K V
-			L.SetTable(-5)
-			// Stack: RemoteStore LocalStore K
-			// So we can call next and repeat this process
-		}
-		// Stack: UpdateRemoteStore LocalStore
-		L.Pop(1)
+	gp.game.tally = gp.tally
+	if withStore != nil {
+		withStore(ts.Store)
 	}
-	L.SetGlobal("store")
 
 	gp.RemoveChild(viewer)
 	base.DeprecatedLog().Printf("LoadGameStateRaw: Turn = %d, Side = %d", gp.game.Turn, gp.game.Side)
-	gp.game.OnRound(false)
+	if onRound {
+		gp.game.OnRound(false)
+	}
 
 	for _, child := range gp.GetChildren() {
 		if o, ok := child.(*Overlay); ok {
@@ -646,6 +802,7 @@ func loadGameStateRaw(gp *GamePanel, L *lua.State, state string) {
 	logging.Trace("loadGameStateRaw>abox-addchild>gameviewer+makeoverlay(game)")
 	gp.AddChild(gp.game.viewer, gui.Anchor{0.5, 0.5, 0.5, 0.5})
 	gp.AddChild(MakeOverlay(gp.game), gui.Anchor{0.5, 0.5, 0.5, 0.5})
+	return nil
 }
 
 func loadGameState(gp *GamePanel) lua.LuaGoFunction {
@@ -690,6 +847,7 @@ func doExec(gp *GamePanel) lua.LuaGoFunction {
 			base.DeprecatedError().Printf("Error decoding exec: Found %d execs instead of exactly 1.", len(execs))
 			return 0
 		}
+		gp.script.recordPlaybackExec(gp.game, execs[0])
 		base.DeprecatedLog().Printf("ScriptComm: Exec: %v", execs[0])
 		gp.game.comm.script_to_game <- execs[0]
 		base.DeprecatedLog().Printf("ScriptComm: Sent exec")
@@ -763,6 +921,24 @@ func chooserFromFile(gp *GamePanel) lua.LuaGoFunction {
 		gp.script.syncStart()
 		defer gp.script.syncEnd()
 		path := filepath.Join(base.GetDataDir(), L.ToString(-1))
+		if gp.scenario.Side != "" && filepath.Clean(L.ToString(-1)) == filepath.Join("ui", "start", "versus", "side.json") {
+			luaPushStrings(L, []string{gp.scenario.Side})
+			return 1
+		}
+		if gp.prompter != nil {
+			var bops []OptionBasic
+			err := base.LoadAndProcessObject(path, "json", &bops)
+			if err != nil {
+				logging.Error("chooserFromFile: loading options failed", "err", err)
+				return 0
+			}
+			var ids []string
+			for _, ob := range bops {
+				ids = append(ids, ob.Id)
+			}
+			luaPushStrings(L, gp.prompter.Choose(L.ToString(-1), ids))
+			return 1
+		}
 		chooser, done, err := makeChooserFromOptionBasicsFile(path)
 		if err != nil {
 			logging.Error("chooserFromFile: making chooser failed", "err", err)
@@ -798,6 +974,9 @@ func loadHouse(gp *GamePanel) lua.LuaGoFunction {
 		defer gp.script.syncEnd()
 
 		name := L.ToString(-1)
+		if gp.scenario.HouseOverride != "" {
+			name = gp.scenario.HouseOverride
+		}
 		logging.Debug("in ur loadHouse", "loadin ur house", name)
 		def := house.MakeHouseFromName(name)
 		if def == nil || len(def.Floors) == 0 {
@@ -806,9 +985,12 @@ func loadHouse(gp *GamePanel) lua.LuaGoFunction {
 		}
 		// TODO(tmckee): this is a bug; we will get a nil sprite manager from
 		// GetSpriteManager because gp.game isn't initialized ... right?
-		gp.game = MakeGame(def, gp.game.GetSpriteManager())
-		gp.game.viewer.Edit_mode = true
+		gp.game = makeGame(def, gp.game.GetSpriteManager(), true)
 		gp.game.script = gp.script
+		gp.game.tally = gp.tally
+		if gp.scenario.Seed != 0 {
+			gp.game.Rand = gobbableRand(rand.NewSource(gp.scenario.Seed))
+		}
 
 		logging.Trace("loadHouse>abox-addchild>gameviewer+makeoverlay(game)")
 		gp.ClearCanvas()
@@ -844,6 +1026,8 @@ func showMainBar(gp *GamePanel, player *Player) lua.LuaGoFunction {
 				LuaDoError(L, err.Error())
 				return 0
 			}
+			gp.main_bar.layout.Undo.f = func(interface{}) { gp.undoExec() }
+			gp.main_bar.layout.Undo.valid_func = gp.canUndo
 			logging.Trace("showMainBar>abox-addchild>mainbar")
 			gp.AddChild(gp.main_bar, gui.Anchor{0.5, 0, 0.5, 0})
 			system, err := MakeSystemMenu(gp, player)
@@ -1012,6 +1196,16 @@ func placeEntities(gp *GamePanel) lua.LuaGoFunction {
 			costs = append(costs, L.ToInteger(-1))
 			L.Pop(2)
 		}
+		if gp.prompter != nil {
+			ents := gp.prompter.PlaceEntities(gp.game, L.ToString(-4), names, costs, L.ToInteger(-2), L.ToInteger(-1))
+			L.NewTable()
+			for i := range ents {
+				L.PushInteger(int64(i) + 1)
+				LuaPushEntity(L, ents[i])
+				L.SetTable(-3)
+			}
+			return 1
+		}
 		ep, done, err := MakeEntityPlacer(gp.game, names, costs, L.ToInteger(-2), L.ToInteger(-1), L.ToString(-4))
 		if err != nil {
 			logging.Error("placeEntities: MakeEntityPlacer failed", "err", err)
@@ -1104,6 +1298,12 @@ func dialogBox(gp *GamePanel) lua.LuaGoFunction {
 			logging.Error("couldn't MakeDialogBox", "err", err)
 			return 0
 		}
+		if gp.prompter != nil {
+			luaPushStrings(L, box.answer(func(ids []string) int {
+				return gp.prompter.DialogChoice(path, ids)
+			}))
+			return 1
+		}
 		logging.Trace("dialogBox>abox-addchild>dialogBox")
 		gp.AddChild(box, gui.Anchor{Wx: 0.5, Wy: 0.5, Bx: 0.5, By: 0.5})
 		gp.script.syncEnd()
@@ -1206,6 +1406,10 @@ func pickFromN(gp *GamePanel) lua.LuaGoFunction {
 		} else {
 			selector = hui.SelectInRange(min, max)
 		}
+		if gp.prompter != nil {
+			luaPushStrings(L, gp.prompter.PickFromN(min, max, option_names))
+			return 1
+		}
 		var chooser *hui.RosterChooser
 		done := make(chan struct{})
 		on_complete := func(m map[int]bool) {
@@ -1280,6 +1484,9 @@ func bindAi(gp *GamePanel) lua.LuaGoFunction {
 			return 0
 		}
 		target := L.ToString(-2)
+		if source == "human" && gp.prompter != nil {
+			source = gp.standIn(target)
+		}
 		switch target {
 		case "denizen":
 			switch source {
@@ -1751,29 +1958,86 @@ func sleepFunc(gp *GamePanel) lua.LuaGoFunction {
 		if !LuaCheckParamsOk(L, "Sleep", LuaFloat) {
 			return 0
 		}
+		if headless {
+			return 1
+		}
 		seconds := L.ToNumber(-1)
 		time.Sleep(time.Microsecond * time.Duration(1000000*seconds))
 		return 1
 	}
 }
 
+// Script.EndGame(winner) ends the game, 'winner' being "intruders" or
+// "denizens". Scripts that don't say who won get Game.likelyWinner.
 func endGameFunc(gp *GamePanel) lua.LuaGoFunction {
 	return func(L *lua.State) int {
-		if !LuaCheckParamsOk(L, "EndGame") {
-			return 0
+		var winner Side
+		if L.GetTop() == 0 {
+			if !LuaCheckParamsOk(L, "EndGame") {
+				return 0
+			}
+			winner = gp.game.likelyWinner()
+		} else {
+			if !LuaCheckParamsOk(L, "EndGame", LuaString) {
+				return 0
+			}
+			switch side_str := L.ToString(-1); side_str {
+			case "intruders":
+				winner = SideExplorers
+			case "denizens":
+				winner = SideHaunt
+			default:
+				LuaDoError(L, fmt.Sprintf("Specified '%s' for the winner in EndGame, must be 'intruders' or 'denizens'.", side_str))
+				return 0
+			}
 		}
+		gp.game.ended = true
+		gp.game.winner = winner
+		reportWinner(gp, winner)
 		gp.game.Ents = nil
 		gp.game.Think(1) // This should clean things up
+		if headless {
+			// There's no menu to go back to.
+			return 1
+		}
 		Restart()
 		return 1
 	}
 }
 
+// Tells the server who won an online game so that it stops being listed as
+// active. Both players' clients end the game, so if this one can't get
+// through the other one still might.
+func reportWinner(gp *GamePanel, winner Side) {
+	if gp.game.net.key == "" || gp.hotseat != nil || gp.spectating != nil {
+		return
+	}
+	var net_id mrgnet.NetId
+	fmt.Sscanf(base.GetStoreVal("netid"), "%d", &net_id)
+	var req mrgnet.UpdateGameRequest
+	req.Id = net_id
+	req.Game_key = gp.game.net.key
+	req.Winner = "denizens"
+	if winner == SideExplorers {
+		req.Winner = "intruders"
+	}
+	ctx, cancel := onlineContext()
+	defer cancel()
+	_, err := mrgnet.UpdateGame(ctx, req)
+	if err != nil {
+		gp.netFailure("EndGame", err)
+	}
+}
+
 func netSideFunc(gp *GamePanel) lua.LuaGoFunction {
 	return func(L *lua.State) int {
 		if !LuaCheckParamsOk(L, "Side") {
 			return 0
 		}
+		if gp.hotseat != nil {
+			L.PushString(gp.hotseat.sideName())
+			return 1
+		}
 		if gp.game.net.game == nil {
 			// If we haven't gotten the game yet that is because it is the first
 			// turn, so it must be the Denizens turn.
@@ -1800,6 +2064,9 @@ func updateStateFunc(gp *GamePanel) lua.LuaGoFunction {
 		if !LuaCheckParamsOk(L, "UpdateState", LuaString) {
 			return 0
 		}
+		if gp.hotseat != nil {
+			return hotseatUpdateState(gp, L)
+		}
 		if gp.game.net.key == "" {
 			base.DeprecatedError().Printf("Tried to UpdateState in a non-Net game.")
 			return 0
@@ -1814,14 +2081,34 @@ func updateStateFunc(gp *GamePanel) lua.LuaGoFunction {
 		req.Round = (gp.game.Turn+1)/2 - 1 // Server is base-0, lua is base-1
 		req.Intruders = gp.game.Side == SideExplorers
 		req.Before = []byte(L.ToString(-1))
-		var resp mrgnet.UpdateGameResponse
-		mrgnet.DoAction("update", req, &resp)
-		if resp.Err != "" {
-			base.DeprecatedError().Printf("Error updating game state: %v", resp.Err)
-			return 0
+		req.Desync = gp.game.net.desync_report
+		ctx, cancel := onlineContext()
+		defer cancel()
+		_, err := mrgnet.UpdateGameWithDelta(ctx, req, gp.game.net.latest_state)
+		if err != nil {
+			L.PushBoolean(false)
+			L.PushString(gp.netFailure("UpdateState", err))
+			return 2
+		}
+		gp.game.net.err = ""
+		gp.game.net.latest_state = req.Before
+		gp.game.net.desync_report = ""
+		if gp.game.net.journal != nil {
+			gp.game.net.journal.close()
+		}
+		gp.game.net.journal, err = startTurnJournal(turnJournalHeader{
+			Key:       req.Game_key,
+			Script:    gp.game.net.script,
+			Round:     req.Round,
+			Intruders: req.Intruders,
+			Before:    req.Before,
+		})
+		if err != nil {
+			logging.Error("couldn't start a turn journal", "err", err)
 		}
 		base.DeprecatedLog().Printf("UpdateState: Turn = %d, Side = %d", gp.game.Turn, gp.game.Side)
-		return 0
+		L.PushBoolean(true)
+		return 1
 	}
 }
 
@@ -1830,6 +2117,9 @@ func updateExecsFunc(gp *GamePanel) lua.LuaGoFunction {
 		if !LuaCheckParamsOk(L, "UpdateExecs", LuaString, LuaArray) {
 			return 0
 		}
+		if gp.hotseat != nil {
+			return hotseatUpdateExecs(gp, L)
+		}
 		if gp.game.net.key == "" {
 			base.DeprecatedError().Printf("Tried to UpdateExecs in a non-Net game.")
 			return 0
@@ -1851,14 +2141,26 @@ func updateExecsFunc(gp *GamePanel) lua.LuaGoFunction {
 		req.Intruders = gp.game.Side == SideExplorers
 		req.Execs = buf.Bytes()
 		req.After = []byte(L.ToString(-2))
-		var resp mrgnet.UpdateGameResponse
-		mrgnet.DoAction("update", req, &resp)
-		if resp.Err != "" {
-			base.DeprecatedError().Printf("Error updating game execs: %v", resp.Err)
-			return 0
+		req.Checksum = gp.game.StateChecksum()
+		req.Desync = gp.game.net.desync_report
+		ctx, cancel := onlineContext()
+		defer cancel()
+		_, err = mrgnet.UpdateGameWithDelta(ctx, req, gp.game.net.latest_state)
+		if err != nil {
+			L.PushBoolean(false)
+			L.PushString(gp.netFailure("UpdateExecs", err))
+			return 2
+		}
+		gp.game.net.err = ""
+		gp.game.net.latest_state = req.After
+		gp.game.net.desync_report = ""
+		if gp.game.net.journal != nil {
+			gp.game.net.journal.finish()
+			gp.game.net.journal = nil
 		}
 		base.DeprecatedLog().Printf("Successfully update game execs: %v", gp.game.net.key)
-		return 0
+		L.PushBoolean(true)
+		return 1
 	}
 }
 
@@ -1867,6 +2169,9 @@ func netWaitFunc(gp *GamePanel) lua.LuaGoFunction {
 		if !LuaCheckParamsOk(L, "Wait") {
 			return 0
 		}
+		if gp.hotseat != nil {
+			return hotseatWait(gp, L)
+		}
 		if gp.game.net.key == "" {
 			base.DeprecatedError().Printf("Tried to Wait in a non-net game.")
 			return 0
@@ -1878,27 +2183,32 @@ func netWaitFunc(gp *GamePanel) lua.LuaGoFunction {
 		req.Id = net_id
 		req.Sizes_only = true
 		for {
-			var resp mrgnet.StatusResponse
-			mrgnet.DoAction("status", req, &resp)
-			if resp.Err != "" {
-				base.DeprecatedError().Printf("%s", resp.Err)
-				return 0
+			// Waiting on the other player can take as long as it takes, but each
+			// individual request is bounded.
+			ctx, cancel := onlineContext()
+			resp, err := mrgnet.Status(ctx, req)
+			cancel()
+			if err != nil {
+				L.PushBoolean(false)
+				L.PushString(gp.netFailure("Wait", err))
+				return 2
 			}
 			expect := gp.game.Turn + 1
 			if len(resp.Game.Before) == len(resp.Game.Execs) && len(resp.Game.Before) == expect {
 				base.DeprecatedLog().Printf("Found the expected %d states", expect)
-				req.Sizes_only = false
-				mrgnet.DoAction("status", req, &resp)
-				if resp.Err != "" {
-					base.DeprecatedError().Printf("%s", resp.Err)
-					return 0
-				}
 				break
 			}
 			base.DeprecatedLog().Printf("Found %d instead of %d states", len(resp.Game.Execs), expect)
-			time.Sleep(time.Second * 5)
+			err = waitForChange(context.Background(), net_id, req.Game_key, resp.Revision)
+			if err != nil {
+				L.PushBoolean(false)
+				L.PushString(gp.netFailure("Wait", err))
+				return 2
+			}
 		}
-		return 0
+		gp.game.net.err = ""
+		L.PushBoolean(true)
+		return 1
 	}
 }
 
@@ -1907,6 +2217,9 @@ func netLatestStateAndExecsFunc(gp *GamePanel) lua.LuaGoFunction {
 		if !LuaCheckParamsOk(L, "LatestStateAndExecs") {
 			return 0
 		}
+		if gp.hotseat != nil {
+			return hotseatLatestStateAndExecs(gp, L)
+		}
 		if gp.game.net.key == "" {
 			base.DeprecatedError().Printf("Tried to get LatestStateAndExecs in a non-net game.")
 			return 0
@@ -1916,26 +2229,51 @@ func netLatestStateAndExecsFunc(gp *GamePanel) lua.LuaGoFunction {
 		var req mrgnet.StatusRequest
 		req.Game_key = gp.game.net.key
 		req.Id = net_id
-		var resp mrgnet.StatusResponse
-		mrgnet.DoAction("status", req, &resp)
-		if resp.Err != "" {
-			base.DeprecatedError().Printf("%s", resp.Err)
-			return 0
+		ctx, cancel := onlineContext()
+		defer cancel()
+		resp, err := mrgnet.Status(ctx, req)
+		if err != nil {
+			L.PushNil()
+			L.PushNil()
+			L.PushString(gp.netFailure("LatestStateAndExecs", err))
+			return 3
 		}
-		if len(resp.Game.Before) != len(resp.Game.Execs) {
-			base.DeprecatedError().Printf("Not the same number of States and Execss")
-			return 0
+		if len(resp.Game.Before) != len(resp.Game.Execs) || len(resp.Game.Execs) == 0 {
+			logging.Warn("incomplete game on the server", "key", req.Game_key, "states", len(resp.Game.Before), "execs", len(resp.Game.Execs))
+			err = errors.New("The server's copy of the game is incomplete.")
+			L.PushNil()
+			L.PushNil()
+			L.PushString(gp.netFailure("LatestStateAndExecs", err))
+			return 3
 		}
 		state := resp.Game.Before[len(resp.Game.Before)-1]
+		gp.game.net.latest_state = resp.Game.After[len(resp.Game.After)-1]
 		L.PushString(string(state))
 		buf := bytes.NewBuffer(resp.Game.Execs[len(resp.Game.Execs)-1])
 		gp.script.syncStart()
 		LuaDecodeValue(buf, L, gp.game)
+		gp.game.net.expected_checksum = ""
+		if len(resp.Game.Checksums) == len(resp.Game.Execs) {
+			gp.game.net.expected_checksum = resp.Game.Checksums[len(resp.Game.Checksums)-1]
+		}
+		if resp.Game.Desync != "" {
+			gp.game.net.desync = resp.Game.Desync
+		}
 		gp.script.syncEnd()
 		return 2
 	}
 }
 
+// Network trouble shouldn't bring the game down. We log it and let the
+// player know through the overlay; the message returned is handed back to the
+// script so that it can decide what to do.
+func (gp *GamePanel) netFailure(function string, err error) string {
+	logging.Error("Net function failed", "function", function, "err", err)
+	msg := mrgnet.UserMessage(err)
+	gp.game.net.err = msg
+	return msg
+}
+
 // Ripped from game/ai/ai.go - should probably sync up with it
 func registerUtilityFunctions(L *lua.State) {
 	L.Register("print", func(L *lua.State) int {
@@ -0,0 +1,98 @@
+package game_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/MobRulesGames/haunts/mrgnet/server"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNetBindings(t *testing.T) {
+	Convey("The Net bindings", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		store, err := server.OpenStore(t.TempDir())
+		So(err, ShouldBeNil)
+		old := mrgnet.SetTransport(&mrgnet.LoopbackTransport{Handler: server.New(store)})
+		defer mrgnet.SetTransport(old)
+
+		// The bindings play as whoever the store says this client is.
+		storePath := filepath.Join(base.GetDataDir(), "store")
+		if _, err := os.Stat(storePath); os.IsNotExist(err) {
+			defer os.Remove(storePath)
+		}
+		defer base.SetStoreVal("netid", base.GetStoreVal("netid"))
+		base.SetStoreVal("netid", "1")
+
+		ctx := context.Background()
+		ng, err := mrgnet.NewGame(ctx, mrgnet.NewGameRequest{Id: 1})
+		So(err, ShouldBeNil)
+		join, err := mrgnet.JoinGame(ctx, mrgnet.JoinGameRequest{Id: 2, Game_key: ng.Game_key})
+		So(err, ShouldBeNil)
+		So(join.Successful, ShouldBeTrue)
+		defer os.Remove(filepath.Dir(game.TurnJournalPath(ng.Game_key)))
+		defer os.Remove(game.TurnJournalPath(ng.Game_key))
+
+		g := givenAGame()
+		g.Turn = 1
+		g.Side = game.SideHaunt
+		before, err := game.EncodeGameState(g)
+		So(err, ShouldBeNil)
+		_, L, stop := game.GivenAnOnlinePanel(g, ng.Game_key)
+		defer stop()
+
+		Convey("play a turn on the server and get it back", func() {
+			So(L.DoString(fmt.Sprintf(`
+				active = Net.Active()
+				side = Net.Side()
+				sent_state = Net.UpdateState(%q)
+				sent_execs = Net.UpdateExecs(%q, {{script_spawn = true, name = "Teen"}})
+				state, execs = Net.LatestStateAndExecs()
+			`, before, before)), ShouldBeNil)
+
+			for _, global := range []string{"active", "sent_state", "sent_execs"} {
+				L.GetGlobal(global)
+				So(L.ToBoolean(-1), ShouldBeTrue)
+				L.Pop(1)
+			}
+			L.GetGlobal("side")
+			So(L.ToString(-1), ShouldEqual, "Denizens")
+			L.Pop(1)
+			L.GetGlobal("state")
+			So(L.ToString(-1), ShouldEqual, string(before))
+			L.Pop(1)
+			So(L.DoString(`spawned = execs[1].name`), ShouldBeNil)
+			L.GetGlobal("spawned")
+			So(L.ToString(-1), ShouldEqual, "Teen")
+			L.Pop(1)
+
+			status, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Id: 2, Game_key: ng.Game_key})
+			So(err, ShouldBeNil)
+			So(status.Game.Before, ShouldResemble, [][]byte{before})
+			So(status.Game.After, ShouldResemble, [][]byte{before})
+			So(status.Game.Checksums, ShouldResemble, []string{g.StateChecksum()})
+		})
+
+		Convey("report what the server says is wrong", func() {
+			So(L.DoString(`state, execs, err = Net.LatestStateAndExecs()`), ShouldBeNil)
+			L.GetGlobal("state")
+			So(L.IsNil(-1), ShouldBeTrue)
+			L.Pop(1)
+			L.GetGlobal("err")
+			So(L.ToString(-1), ShouldNotBeEmpty)
+			L.Pop(1)
+		})
+	})
+}
@@ -157,6 +157,60 @@ func LuaDecodeTable(r io.Reader, L *lua.State, g *Game) error {
 	return nil
 }
 
+// Like LuaDecodeValue but decodes into go values rather than onto a lua
+// stack, which is handy when there's no lua.State around. Tables are returned
+// as map[interface{}]interface{}, numbers as float64 and entities as their
+// EntityId.
+func luaDecodeValueToGo(r io.Reader) (interface{}, error) {
+	var le luaEncodable
+	err := binary.Read(r, binary.LittleEndian, &le)
+	if err != nil {
+		return nil, err
+	}
+	switch le {
+	case luaEncBool:
+		var v byte
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return v == 1, err
+	case luaEncNumber:
+		var f float64
+		err = binary.Read(r, binary.LittleEndian, &f)
+		return f, err
+	case luaEncNil:
+		return nil, nil
+	case luaEncEntity:
+		var id uint64
+		err = binary.Read(r, binary.LittleEndian, &id)
+		return EntityId(id), err
+	case luaEncTable:
+		table := make(map[interface{}]interface{})
+		var cont byte
+		err = binary.Read(r, binary.LittleEndian, &cont)
+		for cont != 0 && err == nil {
+			var k, v interface{}
+			k, err = luaDecodeValueToGo(r)
+			if err == nil {
+				v, err = luaDecodeValueToGo(r)
+			}
+			if err == nil {
+				table[k] = v
+				err = binary.Read(r, binary.LittleEndian, &cont)
+			}
+		}
+		return table, err
+	case luaEncString:
+		var length uint32
+		err = binary.Read(r, binary.LittleEndian, &length)
+		if err != nil {
+			return nil, err
+		}
+		sb := make([]byte, length)
+		err = binary.Read(r, binary.LittleEndian, &sb)
+		return string(sb), err
+	}
+	return nil, fmt.Errorf("Unknown lua value id == %d.", le)
+}
+
 func LuaIsEntity(L *lua.State, index int) bool {
 	L.PushString("type")
 	L.GetTable(index - 1)
@@ -363,6 +417,16 @@ func LuaPushEntity(L *lua.State, _ent *Entity) {
 	L.SetMetaTable(-2)
 }
 
+// Pushes 'ss' as an array.
+func luaPushStrings(L *lua.State, ss []string) {
+	L.NewTable()
+	for i, s := range ss {
+		L.PushInteger(int64(i) + 1)
+		L.PushString(s)
+		L.SetTable(-3)
+	}
+}
+
 func LuaPushPoint(L *lua.State, x, y int) {
 	L.NewTable()
 	L.PushString("X")
@@ -720,12 +784,30 @@ func LuaCheckParamsOk(L *lua.State, name string, params ...LuaType) bool {
 	return true
 }
 
+// LuaDoError stops the script with the same error as running out of
+// instructions does, so it leaves its message in the registry under this for
+// LuaTakeError.
+const luaErrorKey = "haunts_lua_error"
+
 func LuaDoError(L *lua.State, err_str string) {
 	logging.Error("LuaDoError", "err_str", err_str)
 	L.PushString(err_str)
+	L.SetField(lua.LUA_REGISTRYINDEX, luaErrorKey)
+	L.PushString(err_str)
 	L.SetExecutionLimit(1)
 }
 
+// Returns the message of the most recent LuaDoError on L, if there's been one
+// since the last call, and forgets it.
+func LuaTakeError(L *lua.State) string {
+	L.GetField(lua.LUA_REGISTRYINDEX, luaErrorKey)
+	msg := L.ToString(-1)
+	L.Pop(1)
+	L.PushNil()
+	L.SetField(lua.LUA_REGISTRYINDEX, luaErrorKey)
+	return msg
+}
+
 func LuaNumParamsOk(L *lua.State, num_params int, name string) bool {
 	n := L.GetTop()
 	if n != num_params {
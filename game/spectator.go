@@ -0,0 +1,266 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/caffeine-storm/glop/gin"
+	"github.com/caffeine-storm/glop/gui"
+)
+
+var errNothingToWatch = errors.New("That game hasn't started yet.")
+
+// Watches the online game with the given key without taking part in it. The
+// panel starts out showing the latest state on the server and then plays
+// each turn back as it comes in. Spectators see what one side can see at a
+// time and can switch between the two with the "spectator view" key.
+//
+// There's no script involved; everything is driven by the states and execs
+// that the players send to the server.
+func StartSpectatorPanel(key mrgnet.GameKey) (*GamePanel, error) {
+	var net_id mrgnet.NetId
+	fmt.Sscanf(base.GetStoreVal("netid"), "%d", &net_id)
+	ctx, cancel := onlineContext()
+	defer cancel()
+	resp, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Id: net_id, Game_key: key})
+	if err != nil {
+		return nil, err
+	}
+
+	// Start from the end of the last turn that was played, or the start of
+	// the first one if there hasn't been one yet.
+	game := resp.Game
+	next := len(game.Execs)
+	var state []byte
+	switch {
+	case next > 0:
+		state = game.After[next-1]
+	case len(game.Before) > 0:
+		state = game.Before[0]
+	default:
+		return nil, errNothingToWatch
+	}
+
+	var gp GamePanel
+	gp.ClearCanvas()
+	gp.script = &gameScript{sync: make(chan struct{})}
+	err = gp.loadSpectatedState(state, SideHaunt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the game: %w", err)
+	}
+	gp.game.net.key = key
+
+	gp.startSpectating(net_id, key, next, resp.Revision)
+	return &gp, nil
+}
+
+// Keeps track of the goroutine that plays back turns for a spectator.
+type spectating struct {
+	stop context.CancelFunc
+
+	// Closed once the goroutine is done.
+	done chan struct{}
+}
+
+func (gp *GamePanel) startSpectating(id mrgnet.NetId, key mrgnet.GameKey, next int, revision uint64) {
+	ctx, stop := context.WithCancel(context.Background())
+	sp := &spectating{stop: stop, done: make(chan struct{})}
+	gp.spectating = sp
+	go func() {
+		defer close(sp.done)
+		gp.spectate(ctx, id, key, next, revision)
+	}()
+}
+
+// Stops watching for new turns. Whatever is being played back right now gets
+// to finish first, Think leaves the panel once it has.
+func (gp *GamePanel) StopSpectating() {
+	if gp.spectating != nil {
+		gp.spectating.stop()
+	}
+}
+
+// Called from Think, goes back to the menus once a spectator has stopped
+// watching.
+func (gp *GamePanel) thinkAsSpectator() {
+	if gp.spectating == nil {
+		return
+	}
+	select {
+	case <-gp.spectating.done:
+		gp.spectating = nil
+		Restart()
+	default:
+	}
+}
+
+// Adds a panel to 'ui' that watches the game with the given key.
+func InsertSpectatorPanel(ui gui.WidgetParent, key mrgnet.GameKey) error {
+	gp, err := StartSpectatorPanel(key)
+	if err != nil {
+		return err
+	}
+	ui.AddChild(gp)
+	return nil
+}
+
+// Must be called while synced with the game's Think.
+func (gp *GamePanel) loadSpectatedState(state []byte, view Side) error {
+	if gp.game == nil {
+		// Nothing has made a game for the state to be loaded into, which is
+		// where its entities get their sprites from.
+		gp.game = &Game{spriteManager: makeSpriteManager()}
+	}
+	err := gp.loadGameState(string(state), nil)
+	if err != nil {
+		return err
+	}
+	g := gp.game
+	g.spectator.active = true
+	// Execs get handed to Think the same way Script.DoExec does once the main
+	// phase of a turn is over, that way nothing waits on a script to move
+	// things along.
+	g.Turn_state = turnStateMainPhaseOver
+	g.SetLosMode(SideHaunt, LosModeEntities, nil)
+	g.SetLosMode(SideExplorers, LosModeEntities, nil)
+	g.setSpectatorView(view)
+	return nil
+}
+
+// Plays back turns of the game, starting with turn 'next', as the server gets
+// them. Stops once 'ctx' is done or the game is gone.
+func (gp *GamePanel) spectate(ctx context.Context, id mrgnet.NetId, key mrgnet.GameKey, next int, revision uint64) {
+	for {
+		err := waitForChange(ctx, id, key, revision)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			reqCtx, cancel := context.WithTimeout(ctx, onlineRequestTimeout)
+			var resp *mrgnet.StatusResponse
+			resp, err = mrgnet.Status(reqCtx, mrgnet.StatusRequest{Id: id, Game_key: key})
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				revision = resp.Revision
+				for ; next < len(resp.Game.Execs); next++ {
+					if ctx.Err() != nil {
+						return
+					}
+					err = gp.spectateTurn(resp.Game, next)
+					if err != nil {
+						logging.Error("Couldn't play back turn", "key", key, "turn", next, "err", err)
+						gp.setSpectatorError(fmt.Sprintf("Couldn't show turn %d.", next))
+						return
+					}
+				}
+				gp.setSpectatorError("")
+				continue
+			}
+		}
+
+		var serr *mrgnet.ServerError
+		if errors.As(err, &serr) {
+			// The game was probably deleted, there's nothing left to watch.
+			logging.Warn("Stopped watching game", "key", key, "err", err)
+			gp.setSpectatorError(mrgnet.UserMessage(err))
+			return
+		}
+		logging.Warn("Couldn't check for new turns", "key", key, "err", err)
+		gp.setSpectatorError(mrgnet.UserMessage(err))
+		// Don't keep hammering a server that's having trouble.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(mrgnet.PollInterval):
+		}
+	}
+}
+
+func (gp *GamePanel) setSpectatorError(msg string) {
+	gp.script.syncStart()
+	defer gp.script.syncEnd()
+	gp.game.net.err = msg
+}
+
+func (gp *GamePanel) spectateTurn(game *mrgnet.Game, turn int) error {
+	execs, err := DecodeTurnExecs(game.Execs[turn])
+	if err != nil {
+		return fmt.Errorf("couldn't decode execs: %w", err)
+	}
+	err = gp.syncLoadSpectatedState(game.Before[turn])
+	if err != nil {
+		return fmt.Errorf("couldn't load the state at the start of the turn: %w", err)
+	}
+	for _, exec := range execs {
+		gp.spectateExec(exec)
+	}
+	// Script execs, e.g. spawns, can't be played back, so the state the
+	// player ended up in is the only way to be sure of what things look like
+	// now.
+	err = gp.syncLoadSpectatedState(game.After[turn])
+	if err != nil {
+		return fmt.Errorf("couldn't load the state at the end of the turn: %w", err)
+	}
+	return nil
+}
+
+func (gp *GamePanel) syncLoadSpectatedState(state []byte) error {
+	gp.script.syncStart()
+	defer gp.script.syncEnd()
+	return gp.loadSpectatedState(state, gp.game.spectator.view)
+}
+
+// Plays 'exec' out on screen and waits for everyone to settle down after it.
+func (gp *GamePanel) spectateExec(exec ActionExec) {
+	gp.script.syncStart()
+	ent := gp.game.EntityById(exec.EntityId())
+	ok := ent != nil && exec.ActionIndex() >= 0 && exec.ActionIndex() < len(ent.Actions) && ent.Actions[exec.ActionIndex()].IsExec(exec)
+	ents := slices.Clone(gp.game.Ents)
+	gp.script.syncEnd()
+	if !ok {
+		logging.Warn("Skipping exec that doesn't fit the game", "exec", exec)
+		return
+	}
+
+	gp.game.comm.script_to_game <- exec
+	<-gp.game.comm.game_to_script
+	for _, ent := range ents {
+		ent.Sprite().Wait([]string{"ready", "killed"})
+	}
+}
+
+func (g *Game) setSpectatorView(side Side) {
+	g.spectator.view = side
+	g.SetVisibility(side)
+}
+
+// Spectators can look around but mustn't touch anything, all they get to do
+// is switch whose eyes they're looking through, stop watching an online game
+// and, when watching a replay, move around in it.
+func (gp *GamePanel) respondAsSpectator(group gui.EventGroup) bool {
+	if gp.replay != nil && gp.respondToReplay(group) {
+		return true
+	}
+	if gp.spectating != nil && group.IsPressed(gin.AnyEscape) {
+		gp.StopSpectating()
+		return true
+	}
+	if !group.IsPressed(base.GetDefaultKeyMap()["spectator view"].Id()) {
+		return false
+	}
+	if gp.game.spectator.view == SideHaunt {
+		gp.game.setSpectatorView(SideExplorers)
+	} else {
+		gp.game.setSpectatorView(SideHaunt)
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package game_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/MobRulesGames/haunts/mrgnet/server"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpectating(t *testing.T) {
+	Convey("Spectating an online game", t, func() {
+		store, err := server.OpenStore(t.TempDir())
+		So(err, ShouldBeNil)
+		old := mrgnet.SetTransport(&mrgnet.LoopbackTransport{Handler: server.New(store)})
+		defer mrgnet.SetTransport(old)
+
+		ctx := context.Background()
+		ng, err := mrgnet.NewGame(ctx, mrgnet.NewGameRequest{Id: 1})
+		So(err, ShouldBeNil)
+		status, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Id: 2, Game_key: ng.Game_key})
+		So(err, ShouldBeNil)
+
+		gp, done := game.SpectateOnBlankPanel(2, ng.Game_key, status.Revision)
+
+		Convey("keeps watching while nothing happens", func() {
+			select {
+			case <-done:
+				t.Error("stopped watching by itself")
+			case <-time.After(100 * time.Millisecond):
+			}
+			gp.StopSpectating()
+			<-done
+		})
+
+		Convey("plays back turns as they're posted", func() {
+			base.SetDatadir("../data")
+			texture.Init(rendertest.MakeStubbedRenderQueue())
+			registry.LoadAllRegistries()
+			defer func() {
+				gp.StopSpectating()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						game.SpectatedChecksum(gp)
+					}
+				}
+			}()
+
+			before := givenAGame()
+			after := givenAGame()
+			after.Turn = before.Turn + 1
+			after.Side = game.SideExplorers
+			So(after.StateChecksum(), ShouldNotEqual, before.StateChecksum())
+			beforeState, err := game.EncodeGameState(before)
+			So(err, ShouldBeNil)
+			afterState, err := game.EncodeGameState(after)
+			So(err, ShouldBeNil)
+
+			_, err = mrgnet.UpdateGame(ctx, mrgnet.UpdateGameRequest{Id: 1, Game_key: ng.Game_key, Before: beforeState})
+			So(err, ShouldBeNil)
+			_, err = mrgnet.UpdateGame(ctx, mrgnet.UpdateGameRequest{Id: 1, Game_key: ng.Game_key, Execs: encodeLua(`{}`), After: afterState})
+			So(err, ShouldBeNil)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for game.SpectatedChecksum(gp) != after.StateChecksum() && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(game.SpectatedChecksum(gp), ShouldEqual, after.StateChecksum())
+		})
+
+		Convey("stops once told to", func() {
+			gp.StopSpectating()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Error("still watching")
+			}
+		})
+	})
+}
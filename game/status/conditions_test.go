@@ -3,6 +3,7 @@ package status_test
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"path/filepath"
 	"testing"
 
@@ -54,6 +55,23 @@ func ConditionsSpec() {
 		So(ok, ShouldEqual, true)
 	})
 
+	Convey("Insts can be jsoned without losing their conditions.", func() {
+		var s status.Inst
+		s.ApplyCondition(status.MakeCondition("Fire Debuff Attack"))
+		s.OnRound()
+
+		data, err := json.Marshal(s)
+		So(err, ShouldEqual, nil)
+
+		var s2 status.Inst
+		So(json.Unmarshal(data, &s2), ShouldEqual, nil)
+		So(s2.ConditionNames(), ShouldResemble, s.ConditionNames())
+		s.OnRound()
+		s2.OnRound()
+		So(s2.HpCur(), ShouldEqual, s.HpCur())
+		So(s2.ConditionNames(), ShouldResemble, s.ConditionNames())
+	})
+
 	Convey("Conditions stack properly", func() {
 		var s status.Inst
 		fd := status.MakeCondition("Fire Debuff Attack")
@@ -290,8 +290,30 @@ func (si Inst) MarshalJSON() ([]byte, error) {
 	return json.Marshal(si.inst)
 }
 
+// Conditions can't be unmarshaled into directly since they're interfaces, so
+// each one is remade from its Defname and only its progress is taken from the
+// json.
 func (si *Inst) UnmarshalJSON(data []byte) error {
-	return json.Unmarshal(data, &si.inst)
+	var raw struct {
+		Base       Base
+		Dynamic    Dynamic
+		Conditions []struct {
+			Defname string
+			Time    int
+		}
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	si.inst = inst{Base: raw.Base, Dynamic: raw.Dynamic}
+	for _, c := range raw.Conditions {
+		cond := MakeCondition(c.Defname)
+		if bc, ok := cond.(*BasicCondition); ok {
+			bc.Time = c.Time
+		}
+		si.inst.Conditions = append(si.inst.Conditions, cond)
+	}
+	return nil
 }
 
 func (si Inst) GobEncode() ([]byte, error) {
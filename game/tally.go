@@ -0,0 +1,81 @@
+package game
+
+// Keeps count of the damage done in a game, for balancing levels. Rather
+// than have every Action report what it did, the hp of everything on the
+// board is noted when an action starts and compared once it's complete, so
+// whatever an action does, conditions and area attacks included, gets
+// counted against the entity that did it.
+type Tally struct {
+	// One for each action that was carried out, in order.
+	Actions []ActionTally
+
+	hp_before map[EntityId]int
+	acting    *Entity
+	action    Action
+}
+
+type ActionTally struct {
+	Round  int
+	Side   Side
+	Ent    string
+	Action string
+
+	// Hp taken from the other side's entities.
+	Damage int
+
+	// Hp taken from entities on the same side.
+	Friendly_damage int
+
+	// How many entities on the other side were taken down to 0 hp.
+	Kills int
+}
+
+func (t *Tally) startAction(g *Game) {
+	if t == nil || t.acting != nil || g.current_exec == nil {
+		return
+	}
+	t.acting = g.EntityById(g.current_exec.EntityId())
+	t.action = g.current_action
+	t.hp_before = make(map[EntityId]int, len(g.Ents))
+	for _, ent := range g.Ents {
+		if ent.Stats != nil {
+			t.hp_before[ent.Id] = ent.Stats.HpCur()
+		}
+	}
+}
+
+func (t *Tally) completeAction(g *Game) {
+	if t == nil || t.acting == nil {
+		return
+	}
+	at := ActionTally{
+		Round: (g.Turn + 1) / 2,
+		Side:  t.acting.Side(),
+		Ent:   t.acting.Name,
+	}
+	if t.action != nil {
+		at.Action = t.action.String()
+	}
+	for _, ent := range g.Ents {
+		before, ok := t.hp_before[ent.Id]
+		if !ok || ent.Stats == nil {
+			continue
+		}
+		hp := ent.Stats.HpCur()
+		if hp >= before {
+			continue
+		}
+		if ent.Side() == at.Side {
+			at.Friendly_damage += before - hp
+			continue
+		}
+		at.Damage += before - hp
+		if before > 0 && hp <= 0 {
+			at.Kills++
+		}
+	}
+	t.Actions = append(t.Actions, at)
+	t.acting = nil
+	t.action = nil
+	t.hp_before = nil
+}
@@ -0,0 +1,84 @@
+package game_test
+
+import (
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTally(t *testing.T) {
+	Convey("Tally", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		g := givenAGame()
+		teen := givenAnEntityWithHp(g, 1, "Teen", 5)
+		teen.ExplorerEnt = &game.ExplorerEnt{}
+		other := givenAnEntityWithHp(g, 2, "Other Teen", 6)
+		other.ExplorerEnt = &game.ExplorerEnt{}
+		ghost := givenAnEntityWithHp(g, 3, "Ghost", 8)
+		ghost.HauntEnt = &game.HauntEnt{Level: game.LevelMinion}
+		g.Turn = 3
+
+		var tally game.Tally
+		teenExec := &setHpExec{BasicActionExec: game.BasicActionExec{Ent: 1}}
+		act := func(exec game.ActionExec, f func()) {
+			ent := g.EntityById(exec.EntityId())
+			game.TallyAction(&tally, g, exec, ent.Actions[0], f)
+		}
+
+		Convey("counts damage to the other side against whoever acted", func() {
+			act(teenExec, func() { ghost.Stats.SetHp(5) })
+			So(tally.Actions, ShouldResemble, []game.ActionTally{{
+				Round:  2,
+				Side:   game.SideExplorers,
+				Ent:    "Teen",
+				Action: "Set Hp",
+				Damage: 3,
+			}})
+		})
+
+		Convey("counts kills once", func() {
+			act(teenExec, func() { ghost.Stats.SetHp(0) })
+			act(teenExec, func() {})
+			So(len(tally.Actions), ShouldEqual, 2)
+			So(tally.Actions[0].Kills, ShouldEqual, 1)
+			So(tally.Actions[0].Damage, ShouldEqual, 8)
+			So(tally.Actions[1].Kills, ShouldEqual, 0)
+			So(tally.Actions[1].Damage, ShouldEqual, 0)
+		})
+
+		Convey("keeps damage to the same side apart", func() {
+			act(teenExec, func() {
+				other.Stats.SetHp(2)
+				teen.Stats.SetHp(4)
+				ghost.Stats.SetHp(7)
+			})
+			So(tally.Actions[0].Friendly_damage, ShouldEqual, 5)
+			So(tally.Actions[0].Damage, ShouldEqual, 1)
+			So(tally.Actions[0].Kills, ShouldEqual, 0)
+		})
+
+		Convey("doesn't count healing", func() {
+			act(&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 3}}, func() { teen.Stats.SetHp(7) })
+			So(tally.Actions[0].Side, ShouldEqual, game.SideHaunt)
+			So(tally.Actions[0].Damage, ShouldEqual, 0)
+			So(tally.Actions[0].Friendly_damage, ShouldEqual, 0)
+		})
+
+		Convey("ignores actions that nothing's carrying out", func() {
+			game.TallyAction(&tally, g, nil, nil, func() { ghost.Stats.SetHp(1) })
+			So(tally.Actions, ShouldBeEmpty)
+		})
+
+		Convey("can be left off", func() {
+			So(func() { game.TallyAction(nil, g, teenExec, teen.Actions[0], func() {}) }, ShouldNotPanic)
+		})
+	})
+}
@@ -165,8 +165,8 @@ type OptionBasic struct {
 
 func (ob *OptionBasic) Scenario() Scenario {
 	return Scenario{
-		ob.Id,
-		ob.HouseName,
+		Script:    ob.Id,
+		HouseName: ob.HouseName,
 	}
 }
 
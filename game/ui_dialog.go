@@ -181,6 +181,35 @@ func MakeDialogBox(source string, args map[string]string) (*MediumDialogBox, <-c
 	return &mdb, mdb.result, nil
 }
 
+// Goes through the dialog without showing it, letting 'choose' pick a
+// section whenever a page offers a choice. Returns the ids of the picked
+// sections, the same as the dialog would have sent.
+func (mdb *MediumDialogBox) answer(choose func(ids []string) int) []string {
+	var choices []string
+	page := mdb.data.cur_page
+	for steps := 0; page != "" && steps <= len(mdb.data.Pages); steps++ {
+		sections := mdb.data.Pages[page].Sections
+		if len(sections) == 0 {
+			break
+		}
+		if len(sections) == 1 {
+			page = sections[0].Next
+			continue
+		}
+		var ids []string
+		for _, section := range sections {
+			ids = append(ids, section.Id)
+		}
+		i := choose(ids)
+		if i < 0 || i >= len(sections) {
+			i = 0
+		}
+		choices = append(choices, sections[i].Id)
+		page = sections[i].Next
+	}
+	return choices
+}
+
 func (mdb *MediumDialogBox) Requested() gui.Dims {
 	return gui.Dims{
 		Dx: mdb.layout.Background.Data().Dx(),
@@ -0,0 +1,125 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/globals"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/MobRulesGames/haunts/sound"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/gui"
+	"github.com/caffeine-storm/glop/render"
+)
+
+// One of the saves in the load menu. Its Scenario is only used to tell which
+// save was chosen, the path of a save is as good an id as any.
+type saveOption struct {
+	info         *SaveInfo
+	thumbnail    texture.Object
+	alpha        byte
+	was_over     bool
+	was_selected bool
+}
+
+const saveOptionTextSize = 15
+
+func makeSaveOption(info *SaveInfo) *saveOption {
+	return &saveOption{
+		info:      info,
+		thumbnail: texture.Object{Path: base.Path(info.ThumbnailPath())},
+	}
+}
+
+func (so *saveOption) Scenario() Scenario {
+	return Scenario{Script: so.info.Path()}
+}
+
+func (so *saveOption) Draw(x, y, dx int) {
+	shaderBank := globals.RenderQueueState().Shaders()
+	render.WithColour(1, 1, 1, float32(so.alpha)/255.0, func() {
+		d := base.GetDictionary(saveOptionTextSize)
+		d.RenderString(so.info.Name, gui.Point{X: x, Y: y}, d.MaxHeight(), gui.Left, shaderBank)
+	})
+}
+
+func (so *saveOption) DrawInfo(x, y, dx, dy int) {
+	shaderBank := globals.RenderQueueState().Shaders()
+	render.WithColour(1, 1, 1, 1, func() {
+		thumb := so.thumbnail.Data()
+		tx := x + (dx-thumb.Dx())/2
+		ty := y + dy - thumb.Dy()
+		thumb.RenderNatural(tx, ty)
+		side := "Denizens"
+		if so.info.Side == SideExplorers {
+			side = "Intruders"
+		}
+		text := fmt.Sprintf("%s\n%s\nRound %d, %s to play\nSaved %s",
+			so.info.Name, so.info.Scenario.Script, so.info.Round(), side,
+			so.info.Time.Format("Jan 2 2006 15:04"))
+		d := base.GetDictionary(saveOptionTextSize)
+		d.RenderParagraph(text, x, ty-d.MaxHeight(), dx, d.MaxHeight(), gui.Left, gui.Top, shaderBank)
+	})
+}
+
+func (so *saveOption) Height() int {
+	return base.GetDictionary(saveOptionTextSize).MaxHeight()
+}
+
+func (so *saveOption) Think(hovered, selected, selectable bool, dt int64) {
+	if selectable && hovered && !so.was_over {
+		sound.PlaySound("Haunts/SFX/UI/Tick", 0.75)
+	}
+	so.was_over = hovered
+	if so.was_selected != selected {
+		sound.PlaySound("Haunts/SFX/UI/Select", 0.75)
+	}
+	so.was_selected = selected
+	switch {
+	case selected:
+		so.alpha = 255
+	case selectable && hovered:
+		so.alpha = 200
+	case selectable && !hovered:
+		so.alpha = 150
+	default:
+		so.alpha = 50
+	}
+}
+
+// Lists every save, newest first, and starts whichever one is chosen.
+func insertLoadMenu(ui gui.WidgetParent, replace replacer) error {
+	return insertSavesMenu(ui, GetAllSaves(), replace)
+}
+
+func insertSavesMenu(ui gui.WidgetParent, saves []*SaveInfo, replace replacer) error {
+	opts := make([]Option, len(saves))
+	byPath := make(map[string]*SaveInfo, len(saves))
+	for i, info := range saves {
+		opts[i] = makeSaveOption(info)
+		byPath[info.Path()] = info
+	}
+	chooser, done, err := MakeChooser(opts)
+	if err != nil {
+		return err
+	}
+	ui.AddChild(chooser)
+	go func() {
+		m := <-done
+		ui.RemoveChild(chooser)
+		if len(m) == 1 {
+			info := byPath[m[0].Script]
+			gp, err := StartSavedGamePanel(info)
+			if err == nil {
+				ui.AddChild(gp)
+				return
+			}
+			logging.Error("Couldn't load saved game", "save", info.Name, "err", err)
+		}
+		err := replace(ui)
+		if err != nil {
+			logging.Error("insertLoadMenu", "replacing failed", err)
+		}
+	}()
+	return nil
+}
@@ -49,6 +49,9 @@ type MainBarLayout struct {
 	ActionLeft  Button
 	ActionRight Button
 
+	// Only shown while there's something to undo.
+	Undo Button
+
 	CenterStillFrame Center
 
 	Background texture.Object
@@ -222,6 +225,9 @@ func MakeMainBar(game *Game) (*MainBar, error) {
 	mb.layout.UnitLeft.key = gin.AnyLeftShift
 	mb.layout.ActionLeft.f = buttonFuncActionLeft
 	mb.layout.ActionRight.f = buttonFuncActionRight
+	if k, ok := base.GetDefaultKeyMap()["undo"]; ok {
+		mb.layout.Undo.key = k.Id()
+	}
 	mb.game = game
 	return &mb, nil
 }
@@ -351,6 +357,9 @@ func (m *MainBar) Think(g *gui.Gui, t int64) {
 	for _, button := range buttons {
 		button.Think(m.region.X, m.region.Y, m.mx, m.my, t)
 	}
+	if m.layout.Undo.f != nil {
+		m.layout.Undo.Think(m.region.X, m.region.Y, m.mx, m.my, t)
+	}
 }
 
 // Returns the index of the action the point is over, or -1 if none
@@ -396,6 +405,15 @@ func (m *MainBar) Respond(g *gui.Gui, group gui.EventGroup) bool {
 			return true
 		}
 	}
+	if undo := &m.layout.Undo; undo.f != nil {
+		if undo.Respond(group, m) {
+			return true
+		}
+		// Not drawn while it's not valid, so it shouldn't eat clicks then.
+		if undo.valid && group.IsPressed(gin.AnyMouseLButton) && undo.handleClick(m.mx, m.my, m) {
+			return true
+		}
+	}
 
 	if group.IsPressed(gin.AnyMouseLButton) {
 		for _, button := range buttons {
@@ -436,6 +454,9 @@ func (m *MainBar) Draw(region gui.Region, ctx gui.DrawingContext) {
 	for _, button := range buttons {
 		button.RenderAt(region.X, region.Y)
 	}
+	if m.layout.Undo.f != nil && m.layout.Undo.valid {
+		m.layout.Undo.RenderAt(region.X, region.Y)
+	}
 
 	ent := m.game.HoveredEnt()
 	if ent == nil {
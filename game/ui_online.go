@@ -1,12 +1,15 @@
 package game
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"time"
 
 	"github.com/MobRulesGames/haunts/base"
 	"github.com/MobRulesGames/haunts/globals"
+	"github.com/MobRulesGames/haunts/logging"
 	"github.com/MobRulesGames/haunts/mrgnet"
 	"github.com/MobRulesGames/haunts/texture"
 	"github.com/caffeine-storm/gl"
@@ -87,20 +90,57 @@ type OnlineMenu struct {
 	ui gui.WidgetParent
 
 	hover_game *gameField
+
+	// Stops the goroutine that keeps the game lists up to date.
+	stopWatching context.CancelFunc
 }
 
 var net_id mrgnet.NetId
 
+// How long the online menu waits on the server before telling the player
+// that something went wrong.
+const onlineRequestTimeout = 15 * time.Second
+
+func onlineContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), onlineRequestTimeout)
+}
+
+// Blocks until the server says that the game with the given key, or any game
+// if key is empty, has changed since 'revision'. Also returns if the server
+// doesn't see any change for a while, so callers should check for themselves
+// what, if anything, is new.
+func waitForChange(ctx context.Context, id mrgnet.NetId, key mrgnet.GameKey, revision uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, mrgnet.DefaultWaitTimeout+onlineRequestTimeout)
+	defer cancel()
+	_, err := mrgnet.Wait(ctx, mrgnet.WaitRequest{Id: id, Game_key: key, Revision: revision})
+	return err
+}
+
 func InsertOnlineMenu(ui gui.WidgetParent) error {
+	_, err := insertOnlineMenu(ui)
+	return err
+}
+
+// Goes back to the online menu and tells the player why.
+func returnToOnlineMenu(ui gui.WidgetParent, err error) {
+	sm, menuErr := insertOnlineMenu(ui)
+	if menuErr != nil {
+		logging.Error("Unable to make Online Menu", "err", menuErr)
+		return
+	}
+	sm.layout.Error.err = mrgnet.UserMessage(err)
+}
+
+func insertOnlineMenu(ui gui.WidgetParent) (*OnlineMenu, error) {
 	var sm OnlineMenu
 	datadir := base.GetDataDir()
 	err := base.LoadAndProcessObject(filepath.Join(datadir, "ui", "start", "online", "layout.json"), "json", &sm.layout)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	layout, err := LoadStartLayoutFromDatadir(datadir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	sm.buttons = []ButtonLike{
 		&sm.layout.Back,
@@ -114,7 +154,7 @@ func InsertOnlineMenu(ui gui.WidgetParent) error {
 	sm.control.in = make(chan struct{})
 	sm.control.out = make(chan struct{})
 	sm.layout.Back.f = func(interface{}) {
-		ui.RemoveChild(&sm)
+		sm.leave()
 		InsertStartMenu(ui, *layout)
 	}
 	sm.ui = ui
@@ -132,34 +172,30 @@ func InsertOnlineMenu(ui gui.WidgetParent) error {
 		}
 		in_newgame = true
 		go func() {
-			var req mrgnet.NewGameRequest
-			req.Id = net_id
-			var resp mrgnet.NewGameResponse
-			done := make(chan bool, 1)
-			go func() {
-				mrgnet.DoAction("new", req, &resp)
-				done <- true
-			}()
-			select {
-			case <-done:
-			case <-time.After(5 * time.Second):
-				resp.Err = "Couldn't connect to server."
-			}
+			ctx, cancel := onlineContext()
+			defer cancel()
+			resp, err := mrgnet.NewGame(ctx, mrgnet.NewGameRequest{Id: net_id})
 			<-sm.control.in
 			defer func() {
 				in_newgame = false
 				sm.control.out <- struct{}{}
 			}()
-			if resp.Err != "" {
-				sm.layout.Error.err = resp.Err
-				base.DeprecatedError().Printf("Couldn't make new game: %v", resp.Err)
+			if err != nil {
+				sm.layout.Error.err = mrgnet.UserMessage(err)
+				logging.Error("Couldn't make new game", "err", err)
 				return
 			}
-			ui.RemoveChild(&sm)
-			err := InsertMapChooser(
+			sm.leave()
+			err = InsertMapChooser(
 				ui,
 				func(scenario Scenario) {
-					ui.AddChild(MakeGamePanel(scenario, nil, nil, resp.Game_key))
+					gp, err := StartGamePanel(scenario, nil, nil, resp.Game_key)
+					if err != nil {
+						logging.Error("Couldn't start online game", "err", err)
+						returnToOnlineMenu(ui, err)
+						return
+					}
+					ui.AddChild(gp)
 				},
 				InsertOnlineMenu,
 			)
@@ -186,43 +222,91 @@ func InsertOnlineMenu(ui gui.WidgetParent) error {
 
 		glb.update = make(chan mrgnet.ListGamesResponse)
 	}
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	sm.stopWatching = stopWatching
+	// Fills 'glb' with every game that matches any of 'reqs'.
+	listGames := func(glb *gameListBox, reqs ...mrgnet.ListGamesRequest) (uint64, error) {
+		ctx, cancel := onlineContext()
+		defer cancel()
+		var list mrgnet.ListGamesResponse
+		var errs []error
+		for _, req := range reqs {
+			req.Id = net_id
+			resp, err := mrgnet.ListGames(ctx, req)
+			if err != nil {
+				logging.Error("Couldn't list games", "req", req, "err", err)
+				list.Err = mrgnet.UserMessage(err)
+				errs = append(errs, err)
+				continue
+			}
+			list.Games = append(list.Games, resp.Games...)
+			list.Game_keys = append(list.Game_keys, resp.Game_keys...)
+			list.Revision = max(list.Revision, resp.Revision)
+		}
+		select {
+		case glb.update <- list:
+		case <-watchCtx.Done():
+		}
+		return list.Revision, errors.Join(errs...)
+	}
+	// Lists the games, then lists them again whenever the server tells us that
+	// something changed, for as long as the menu is up. Games that other people
+	// are playing go in with the open ones so that they can be watched.
 	go func() {
-		var resp mrgnet.ListGamesResponse
-		mrgnet.DoAction("list", mrgnet.ListGamesRequest{Id: net_id, Unstarted: true}, &resp)
-		sm.layout.Unstarted.update <- resp
-	}()
-	go func() {
-		var resp mrgnet.ListGamesResponse
-		mrgnet.DoAction("list", mrgnet.ListGamesRequest{Id: net_id, Unstarted: false}, &resp)
-		sm.layout.Active.update <- resp
+		for watchCtx.Err() == nil {
+			revision, err1 := listGames(&sm.layout.Unstarted,
+				mrgnet.ListGamesRequest{Unstarted: true},
+				mrgnet.ListGamesRequest{Watchable: true})
+			_, err2 := listGames(&sm.layout.Active, mrgnet.ListGamesRequest{})
+			err := errors.Join(err1, err2)
+			if err == nil {
+				err = waitForChange(watchCtx, net_id, "", revision)
+			}
+			if err != nil && watchCtx.Err() == nil {
+				logging.Warn("Couldn't wait for changes to the game lists", "err", err)
+				// Don't keep hammering a server that's having trouble.
+				select {
+				case <-time.After(mrgnet.PollInterval):
+				case <-watchCtx.Done():
+				}
+			}
+		}
 	}()
 
-	sm.layout.User.Button.f = func(interface{}) {
-		var req mrgnet.UpdateUserRequest
-		req.Name = sm.layout.User.Entry.text
-		req.Id = net_id
-		var resp mrgnet.UpdateUserResponse
-		go func() {
-			mrgnet.DoAction("user", req, &resp)
-			<-sm.control.in
-			sm.layout.User.SetText(resp.Name)
-			sm.update_alpha = 1.0
-			sm.update_time = time.Now()
+	updateUser := func(req mrgnet.UpdateUserRequest) {
+		ctx, cancel := onlineContext()
+		defer cancel()
+		resp, err := mrgnet.UpdateUser(ctx, req)
+		<-sm.control.in
+		defer func() {
 			sm.control.out <- struct{}{}
 		}()
-	}
-	go func() {
-		var resp mrgnet.UpdateUserResponse
-		mrgnet.DoAction("user", mrgnet.UpdateUserRequest{Id: net_id}, &resp)
-		<-sm.control.in
+		if err != nil {
+			sm.layout.Error.err = mrgnet.UserMessage(err)
+			logging.Error("Couldn't update user", "err", err)
+			return
+		}
 		sm.layout.User.SetText(resp.Name)
 		sm.update_alpha = 1.0
 		sm.update_time = time.Now()
-		sm.control.out <- struct{}{}
-	}()
+	}
+	sm.layout.User.Button.f = func(interface{}) {
+		var req mrgnet.UpdateUserRequest
+		req.Name = sm.layout.User.Entry.text
+		req.Id = net_id
+		go updateUser(req)
+	}
+	go updateUser(mrgnet.UpdateUserRequest{Id: net_id})
 
 	ui.AddChild(&sm)
-	return nil
+	return &sm, nil
+}
+
+// Takes the menu out of the ui and stops it from keeping track of the games
+// on the server.
+func (sm *OnlineMenu) leave() {
+	sm.stopWatching()
+	sm.ui.RemoveChild(sm)
 }
 
 func (sm *OnlineMenu) Requested() gui.Dims {
@@ -274,6 +358,9 @@ func (sm *OnlineMenu) Think(g *gui.Gui, t int64) {
 		glb := []*gameListBox{&sm.layout.Active, &sm.layout.Unstarted}[i]
 		select {
 		case list := <-glb.update:
+			if list.Err != "" {
+				sm.layout.Error.err = list.Err
+			}
 			glb.games = glb.games[0:0]
 			for j := range list.Games {
 				var b Button
@@ -289,75 +376,107 @@ func (sm *OnlineMenu) Think(g *gui.Gui, t int64) {
 				b.Text.String = "Join!"
 				game_key := list.Game_keys[j]
 				active := (glb == &sm.layout.Active)
+				watch := !active && isWatchable(list.Games[j], net_id)
+				if watch {
+					b.Text.String = "Watch!"
+				}
+				// We went down partway through a turn in this game, so the player
+				// gets to pick it up where they left off.
+				resume := active && hasTurnJournal(game_key)
+				if resume {
+					b.Text.String = "Resume!"
+				}
 				in_joingame := false
 				b.f = func(interface{}) {
 					if in_joingame {
 						return
 					}
 					in_joingame = true
-					if active {
+					if watch {
 						go func() {
-							var req mrgnet.StatusRequest
-							req.Id = net_id
-							req.Game_key = game_key
-							var resp mrgnet.StatusResponse
-							done := make(chan bool, 1)
-							go func() {
-								mrgnet.DoAction("status", req, &resp)
-								done <- true
+							gp, err := StartSpectatorPanel(game_key)
+							<-sm.control.in
+							defer func() {
+								in_joingame = false
+								sm.control.out <- struct{}{}
 							}()
-							select {
-							case <-done:
-							case <-time.After(5 * time.Second):
-								resp.Err = "Couldn't connect to server."
+							if err != nil {
+								sm.layout.Error.err = mrgnet.UserMessage(err)
+								logging.Error("Couldn't watch game", "err", err)
+								return
 							}
+							sm.leave()
+							sm.ui.AddChild(gp)
+						}()
+					} else if resume {
+						go func() {
+							gp, err := ResumeOnlineGame(game_key)
 							<-sm.control.in
 							defer func() {
 								in_joingame = false
 								sm.control.out <- struct{}{}
 							}()
-							if resp.Err != "" || resp.Game == nil {
-								sm.layout.Error.err = resp.Err
-								base.DeprecatedError().Printf("Couldn't join game: %v", resp.Err)
+							if err != nil {
+								sm.layout.Error.err = mrgnet.UserMessage(err)
+								logging.Error("Couldn't resume game", "err", err)
 								return
 							}
-							sm.ui.RemoveChild(sm)
+							sm.leave()
+							sm.ui.AddChild(gp)
+						}()
+					} else if active {
+						go func() {
+							ctx, cancel := onlineContext()
+							defer cancel()
+							_, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Id: net_id, Game_key: game_key})
+							<-sm.control.in
+							defer func() {
+								in_joingame = false
+								sm.control.out <- struct{}{}
+							}()
+							if err != nil {
+								sm.layout.Error.err = mrgnet.UserMessage(err)
+								logging.Error("Couldn't join game", "err", err)
+								return
+							}
+							sm.leave()
 							// TODO(tmckee:#37): we're panicking to help us rememeber we
 							// haven't done the work yet; we should do the work.
 							panic(fmt.Errorf("#37: we need to verify/test that a 'game_key' is enough context"))
-							sm.ui.AddChild(MakeGamePanel(Scenario{}, nil, nil, game_key))
+							gp, err := StartGamePanel(Scenario{}, nil, nil, game_key)
+							if err != nil {
+								logging.Error("Couldn't start online game", "err", err)
+								returnToOnlineMenu(sm.ui, err)
+								return
+							}
+							sm.ui.AddChild(gp)
 						}()
 					} else {
 						go func() {
-							var req mrgnet.JoinGameRequest
-							req.Id = net_id
-							req.Game_key = game_key
-							var resp mrgnet.JoinGameResponse
-							done := make(chan bool, 1)
-							go func() {
-								mrgnet.DoAction("join", req, &resp)
-								done <- true
-							}()
-							select {
-							case <-done:
-							case <-time.After(5 * time.Second):
-								resp.Err = "Couldn't connect to server."
-							}
+							ctx, cancel := onlineContext()
+							defer cancel()
+							_, err := mrgnet.JoinGame(ctx, mrgnet.JoinGameRequest{Id: net_id, Game_key: game_key})
 							<-sm.control.in
 							defer func() {
 								in_joingame = false
 								sm.control.out <- struct{}{}
 							}()
-							if resp.Err != "" || !resp.Successful {
-								sm.layout.Error.err = resp.Err
-								base.DeprecatedError().Printf("Couldn't join game: %v", resp.Err)
+							if err != nil {
+								sm.layout.Error.err = mrgnet.UserMessage(err)
+								logging.Error("Couldn't join game", "err", err)
 								return
 							}
-							sm.ui.RemoveChild(sm)
+							sm.leave()
 							// TODO(tmckee:#37): we're panicking to help us rememeber we
 							// haven't done the work yet; we should do the work.
 							panic(fmt.Errorf("#37: we need to verify/test that a 'game_key' is enough context"))
-							sm.ui.AddChild(MakeGamePanel(Scenario{}, nil, nil, game_key))
+							gp, err := StartGamePanel(Scenario{}, nil, nil, game_key)
+							if err != nil {
+								logging.Error("Couldn't start online game", "err", err)
+								returnToOnlineMenu(sm.ui, err)
+								return
+							}
+							sm.ui.AddChild(gp)
 						}()
 					}
 				}
@@ -368,27 +487,16 @@ func (sm *OnlineMenu) Think(g *gui.Gui, t int64) {
 					d.Text.Size = sm.layout.Text.Size
 					d.f = func(interface{}) {
 						go func() {
-							var req mrgnet.KillRequest
-							req.Id = net_id
-							req.Game_key = game_key
-							var resp mrgnet.KillResponse
-							done := make(chan bool, 1)
-							go func() {
-								mrgnet.DoAction("kill", req, &resp)
-								done <- true
-							}()
-							select {
-							case <-done:
-							case <-time.After(5 * time.Second):
-								resp.Err = "Couldn't connect to server."
-							}
+							ctx, cancel := onlineContext()
+							defer cancel()
+							_, err := mrgnet.Kill(ctx, mrgnet.KillRequest{Id: net_id, Game_key: game_key})
 							<-sm.control.in
-							if resp.Err != "" {
-								sm.layout.Error.err = resp.Err
-								base.DeprecatedError().Printf("Couldn't kill game: %v", resp.Err)
+							if err != nil {
+								sm.layout.Error.err = mrgnet.UserMessage(err)
+								logging.Error("Couldn't kill game", "err", err)
 							} else {
 								algorithm.Choose(&glb.games, func(gf gameField) bool {
-									return gf.key != req.Game_key
+									return gf.key != game_key
 								})
 							}
 							sm.control.out <- struct{}{}
@@ -533,7 +641,9 @@ func (sm *OnlineMenu) Draw(region gui.Region, ctx gui.DrawingContext) {
 		sy := sm.layout.User.Button.Y
 		d.RenderString("Name Updated", gui.Point{X: sx, Y: sy}, d.MaxHeight(), gui.Left, shaderBank)
 
-		if sm.hover_game != nil {
+		if sm.hover_game != nil && isWatchable(sm.hover_game.game, net_id) {
+			sm.drawWatchableStats(sm.hover_game.game)
+		} else if sm.hover_game != nil {
 			game := sm.hover_game
 			gl.Disable(gl.TEXTURE_2D)
 			gl.Color4ub(255, 255, 255, 255)
@@ -575,6 +685,33 @@ func (sm *OnlineMenu) Draw(region gui.Region, ctx gui.DrawingContext) {
 	})
 }
 
+func (sm *OnlineMenu) drawWatchableStats(game mrgnet.Game) {
+	shaderBank := globals.RenderQueueState().Shaders()
+	gl.Disable(gl.TEXTURE_2D)
+	gl.Color4ub(255, 255, 255, 255)
+	d := base.GetDictionary(sm.layout.GameStats.Size)
+	x := sm.layout.GameStats.X + sm.layout.GameStats.Dx/2
+	y := sm.layout.GameStats.Y + sm.layout.GameStats.Dy - d.MaxHeight()
+	lines := []string{
+		fmt.Sprintf("Denizens: %s", game.Denizens_name),
+		fmt.Sprintf("Intruders: %s", game.Intruders_name),
+	}
+	if len(game.Execs)%2 == 0 {
+		lines = append(lines, "Denizens' move")
+	} else {
+		lines = append(lines, "Intruders' move")
+	}
+	for _, line := range lines {
+		d.RenderString(line, gui.Point{X: x, Y: y}, d.MaxHeight(), gui.Center, shaderBank)
+		y -= d.MaxHeight()
+	}
+}
+
+// Games that other people are playing can only be watched.
+func isWatchable(game mrgnet.Game, id mrgnet.NetId) bool {
+	return game.Intruders_id != 0 && game.Denizens_id != id && game.Intruders_id != id
+}
+
 func (sm *OnlineMenu) DrawFocused(region gui.Region, ctx gui.DrawingContext) {
 }
 
@@ -7,6 +7,8 @@ import (
 	"github.com/MobRulesGames/haunts/base"
 	"github.com/MobRulesGames/haunts/game"
 	"github.com/MobRulesGames/haunts/game/gametest"
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/MobRulesGames/haunts/mrgnet/server"
 	"github.com/caffeine-storm/glop/gui"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -26,6 +28,13 @@ func TestUiOnline(t *testing.T) {
 	Convey("UI for starting an online game", t, func(c C) {
 		base.SetDatadir("../data")
 
+		// Talk to an in-process server so that the test doesn't depend on one
+		// running on this machine.
+		store, err := server.OpenStore(t.TempDir())
+		So(err, ShouldBeNil)
+		old := mrgnet.SetTransport(&mrgnet.LoopbackTransport{Handler: server.New(store)})
+		defer mrgnet.SetTransport(old)
+
 		gametest.RunDrawingTest(c, givenAnOnlineMenu, "online")
 	})
 }
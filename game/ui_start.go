@@ -45,6 +45,9 @@ type StartMenu struct {
 	buttons []ButtonLike
 	mx, my  int
 	last_t  int64
+
+	// Opens the menu of saved games.
+	load func()
 }
 
 func (sm *StartMenu) PatchButtonForTest(buttonKey string, fn func()) {
@@ -94,7 +97,12 @@ func InsertStartMenu(ui gui.WidgetParent, layout StartLayout) error {
 			ui,
 			func(scenario Scenario) {
 				logging.Debug("MenuVersus buttonf", "scenario", scenario)
-				ui.AddChild(MakeGamePanel(scenario, nil, nil, ""))
+				err := insertPlayersMenu(ui, scenario, func(parent gui.WidgetParent) error {
+					return InsertStartMenu(parent, sm.Layout)
+				})
+				if err != nil {
+					logging.Error("Unable to make Players Menu", "err", err)
+				}
 			},
 			func(parent gui.WidgetParent) error {
 				return InsertStartMenu(parent, sm.Layout)
@@ -114,6 +122,16 @@ func InsertStartMenu(ui gui.WidgetParent, layout StartLayout) error {
 			return
 		}
 	}
+	sm.load = func() {
+		ui.RemoveChild(&sm)
+		err := insertLoadMenu(ui, func(parent gui.WidgetParent) error {
+			return InsertStartMenu(parent, sm.Layout)
+		})
+		if err != nil {
+			logging.Error("Unable to make Load Menu", "err", err)
+			return
+		}
+	}
 	ui.AddChild(&sm)
 	return nil
 }
@@ -158,6 +176,11 @@ func (sm *StartMenu) Respond(g *gui.Gui, group gui.EventGroup) bool {
 		sm.mx, sm.my = mpos.X, mpos.Y
 	}
 
+	if k, ok := base.GetDefaultKeyMap()["load game"]; ok && group.IsPressed(k.Id()) {
+		sm.load()
+		return true
+	}
+
 	hit := false
 	if group.IsPressed(gin.AnyMouseLButton) {
 		for _, button := range sm.buttons {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/MobRulesGames/haunts/base"
 	"github.com/MobRulesGames/haunts/globals"
+	"github.com/MobRulesGames/haunts/logging"
 	"github.com/MobRulesGames/haunts/texture"
 	"github.com/caffeine-storm/gl"
 	"github.com/caffeine-storm/glop/gin"
@@ -57,23 +58,13 @@ func MakeSystemMenu(gp *GamePanel, player *Player) (gui.Widget, error) {
 		Restart()
 	}
 
-	sm.layout.Sub.Save.Entry.text = player.Name
 	sm.layout.Sub.Save.Button.f = func(interface{}) {
-		UpdatePlayer(player, gp.script.L)
-		str, err := base.ToGobToBase64(gp.game)
+		info, err := SaveGame(gp, player.Name, sm.layout.Sub.Save.Text())
 		if err != nil {
-			base.DeprecatedError().Printf("Error gobbing game state: %v", err)
-			return
-		}
-		player.Game_state = str
-		player.Name = sm.layout.Sub.Save.Text()
-		player.No_init = true
-		base.DeprecatedLog().Printf("Saving player: %v", player)
-		err = SavePlayer(player)
-		if err != nil {
-			base.DeprecatedWarn().Printf("Unable to save player: %v", err)
+			logging.Warn("Unable to save game", "err", err)
 			return
 		}
+		logging.Info("Saved game", "name", info.Name, "path", info.Path())
 		sm.saved_time = time.Now()
 		sm.saved_alpha = 1.0
 	}
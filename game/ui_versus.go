@@ -45,6 +45,48 @@ func makeChooseVersusMetaMenu() (*Chooser, <-chan []Scenario, error) {
 	return makeChooserFromOptionBasicsFile(path)
 }
 
+func makeChoosePlayersMenu() (*Chooser, <-chan []Scenario, error) {
+	path := filepath.Join(base.GetDataDir(), "ui", "start", "versus", "players.json")
+	return makeChooserFromOptionBasicsFile(path)
+}
+
+// Asks whether 'scenario' should be played hotseat, with both sides sharing
+// this machine, or as a regular versus game and then starts it.
+func insertPlayersMenu(ui gui.WidgetParent, scenario Scenario, replace replacer) error {
+	chooser, done, err := makeChoosePlayersMenu()
+	if err != nil {
+		return err
+	}
+	ui.AddChild(chooser)
+	go func() {
+		m := <-done
+		ui.RemoveChild(chooser)
+		if len(m) != 1 {
+			err := replace(ui)
+			if err != nil {
+				logging.Error("insertPlayersMenu", "replacing failed", err)
+			}
+			return
+		}
+		logging.Debug("insertPlayersMenu", "chose", m)
+		if m[0].Script != "Hotseat" {
+			ui.AddChild(MakeGamePanel(scenario, nil, nil, ""))
+			return
+		}
+		gp, err := StartHotseatPanel(scenario)
+		if err != nil {
+			logging.Error("Couldn't start hotseat game", "err", err)
+			err = replace(ui)
+			if err != nil {
+				logging.Error("insertPlayersMenu", "replacing failed", err)
+			}
+			return
+		}
+		ui.AddChild(gp)
+	}()
+	return nil
+}
+
 type (
 	chooserMaker func() (*Chooser, <-chan []string, error)
 	replacer     func(gui.WidgetParent) error
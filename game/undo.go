@@ -0,0 +1,205 @@
+package game
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/caffeine-storm/glop/gui"
+)
+
+// Lets a player take back the execs they've made this turn, but only for as
+// long as that can't be used to learn anything. The whole game is
+// snapshotted before each exec the player makes, and the latest one can be
+// taken back as long as no dice have been rolled since and the player's side
+// can't see anywhere it couldn't see before.
+//
+// Online games don't get an undo, the turn journal would have to be rewound
+// along with everything else.
+
+type undoSnapshot struct {
+	// As made by Script.SaveGameState.
+	state string
+
+	side Side
+	rand gobbablePrng
+
+	// Everywhere 'side' could see.
+	seen []bool
+
+	// The entity that was selected, so that it can be again.
+	selected EntityId
+
+	// How many of this turn's execs the replay had.
+	replay_execs int
+}
+
+type undoStack struct {
+	turn      int
+	snapshots []undoSnapshot
+}
+
+// Snapshots the game just before the player commits to an exec.
+func (gp *GamePanel) pushUndo() {
+	g := gp.game
+	if gp.script == nil || gp.script.L == nil || g.net.key != "" {
+		return
+	}
+	if gp.undo.turn != g.Turn {
+		gp.undo = undoStack{turn: g.Turn}
+	}
+
+	gp.runSynced(func() {
+		store := bytes.NewBuffer(nil)
+		gp.script.L.GetGlobal("store")
+		err := LuaEncodeValue(store, gp.script.L, -1)
+		gp.script.L.Pop(1)
+		if err != nil {
+			logging.Warn("couldn't snapshot the script's store for undo", "err", err)
+			gp.undo.snapshots = nil
+			return
+		}
+		state, err := base.ToGobToBase64(totalState{Game: &gp.game, Store: store.Bytes()})
+		if err != nil {
+			logging.Warn("couldn't snapshot the game for undo", "err", err)
+			gp.undo.snapshots = nil
+			return
+		}
+		snap := makeUndoSnapshot(gp.game, state)
+		snap.replay_execs = gp.script.replay.turnExecs()
+		gp.undo.snapshots = append(gp.undo.snapshots, snap)
+	})
+}
+
+func makeUndoSnapshot(g *Game, state string) undoSnapshot {
+	snap := undoSnapshot{
+		state: state,
+		side:  g.Side,
+		rand:  cloneRand(g.Rand),
+		seen:  g.seenBy(g.Side),
+	}
+	if g.selected_ent != nil {
+		snap.selected = g.selected_ent.Id
+	}
+	return snap
+}
+
+// Runs 'f' the same way the script's own functions get at the game, between
+// syncStart and syncEnd, and waits for it to finish. This is for the
+// panel's goroutine, which is the one that would otherwise let 'f' in.
+func (gp *GamePanel) runSynced(f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gp.script.syncStart()
+		defer gp.script.syncEnd()
+		f()
+	}()
+	s := gp.script.sync
+	for {
+		select {
+		case s <- struct{}{}:
+			<-s
+		case <-done:
+			return
+		}
+	}
+}
+
+func (gp *GamePanel) canUndo() bool {
+	g := gp.game
+	if len(gp.undo.snapshots) == 0 || gp.undo.turn != g.Turn {
+		return false
+	}
+	// Only while the player could be making their next move.
+	if g.Turn_state != turnStateAiAction || g.Action_state != noAction || g.current_exec != nil || g.player_inactive {
+		return false
+	}
+	return !gp.undo.snapshots[len(gp.undo.snapshots)-1].revealed(g)
+}
+
+// Takes back the player's last exec.
+func (gp *GamePanel) undoExec() {
+	if !gp.canUndo() {
+		return
+	}
+	snap := gp.undo.snapshots[len(gp.undo.snapshots)-1]
+	gp.undo.snapshots = gp.undo.snapshots[:len(gp.undo.snapshots)-1]
+
+	L := gp.script.L
+	var err error
+	gp.runSynced(func() {
+		err = gp.replaceGame(snap.state, func(store []byte) {
+			LuaDecodeValue(bytes.NewBuffer(store), L, gp.game)
+			L.SetGlobal("store")
+		}, false)
+	})
+	if err != nil {
+		logging.Error("couldn't undo", "err", err)
+		gp.undo = undoStack{}
+		return
+	}
+	gp.script.replay.rewind(snap.replay_execs)
+	if ent := gp.game.EntityById(snap.selected); ent != nil {
+		gp.game.SelectEnt(ent)
+	}
+	gp.raiseHud()
+	logging.Info("undid an exec", "turn", gp.game.Turn, "left", len(gp.undo.snapshots))
+}
+
+// Whether anything has happened since the snapshot that the player
+// shouldn't be able to take back.
+func (snap *undoSnapshot) revealed(g *Game) bool {
+	if snap.rand != nil && (g.Rand == nil || !g.Rand.SameState(snap.rand)) {
+		return true
+	}
+	seen := g.seenBy(snap.side)
+	for i := range seen {
+		if seen[i] && !snap.seen[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneRand(r gobbablePrng) gobbablePrng {
+	if grs, ok := r.(*gobbableRandSource); ok {
+		return &gobbableRandSource{Buf: slices.Clone(grs.Buf)}
+	}
+	return nil
+}
+
+// Returns everywhere on the board that 'side' can see right now.
+func (g *Game) seenBy(side Side) []bool {
+	seen := make([]bool, house.LosTextureSizeSquared)
+	for _, ent := range g.Ents {
+		if ent.Side() != side || ent.los == nil {
+			continue
+		}
+		for i := range ent.los.grid {
+			for j, v := range ent.los.grid[i] {
+				if v {
+					seen[i*house.LosTextureSize+j] = true
+				}
+			}
+		}
+	}
+	return seen
+}
+
+// Swapping the game out puts its viewer on top of everything, so the main
+// bar and system menu have to go back on top of it.
+func (gp *GamePanel) raiseHud() {
+	for _, child := range slices.Clone(gp.GetChildren()) {
+		switch child.(type) {
+		case *MainBar:
+			gp.RemoveChild(child)
+			gp.AddChild(child, gui.Anchor{Wx: 0.5, Wy: 0, Bx: 0.5, By: 0})
+		case *SystemMenu:
+			gp.RemoveChild(child)
+			gp.AddChild(child, gui.Anchor{Wx: 1, Wy: 1, Bx: 1, By: 1})
+		}
+	}
+}
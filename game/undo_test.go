@@ -0,0 +1,78 @@
+package game_test
+
+import (
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUndo(t *testing.T) {
+	Convey("Undo", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		g := givenAGame()
+		g.Side = game.SideHaunt
+		ghost := givenAnEntityWithHp(g, 1, "Ghost", 5)
+		ghost.EntityDef.HauntEnt = &game.HauntEnt{Level: game.LevelMinion}
+		teen := givenAnEntityWithHp(g, 2, "Teen", 5)
+		teen.EntityDef.ExplorerEnt = &game.ExplorerEnt{}
+		game.SetLos(ghost, 10, 11)
+		game.SetLos(teen, 500)
+
+		Convey("sees everything a side's entities see and nothing else", func() {
+			seen := game.SeenBy(g, game.SideHaunt)
+			So(len(seen), ShouldEqual, house.LosTextureSizeSquared)
+			var cells []int
+			for i, v := range seen {
+				if v {
+					cells = append(cells, i)
+				}
+			}
+			So(cells, ShouldResemble, []int{10, 11})
+
+			// Seeing the same thing twice doesn't count twice.
+			other := givenAnEntityWithHp(g, 3, "Poltergeist", 5)
+			other.EntityDef.HauntEnt = &game.HauntEnt{Level: game.LevelMinion}
+			game.SetLos(other, 11, 12)
+			seen = game.SeenBy(g, game.SideHaunt)
+			So(seen[10] && seen[11] && seen[12], ShouldBeTrue)
+			So(seen[500], ShouldBeFalse)
+		})
+
+		Convey("snapshots", func() {
+			snap := game.MakeUndoSnapshot(g)
+
+			Convey("can be taken back to if nothing has changed", func() {
+				So(snap.Revealed(g), ShouldBeFalse)
+			})
+
+			Convey("can be taken back to if the side sees less", func() {
+				game.SetLos(ghost, 10)
+				So(snap.Revealed(g), ShouldBeFalse)
+			})
+
+			Convey("can be taken back to if only the other side sees more", func() {
+				game.SetLos(teen, 500, 501)
+				So(snap.Revealed(g), ShouldBeFalse)
+			})
+
+			Convey("can't be taken back to once the side sees somewhere new", func() {
+				game.SetLos(ghost, 10, 11, 12)
+				So(snap.Revealed(g), ShouldBeTrue)
+			})
+
+			Convey("can't be taken back to once dice have been rolled", func() {
+				g.Rand.Int63()
+				So(snap.Revealed(g), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,283 @@
+package game
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/MobRulesGames/haunts/base"
+)
+
+// Checks turns submitted to a game server by replaying them: applying a
+// turn's execs to the state it started in has to give the state the client
+// claims to have ended up in.
+//
+// ActionExecs get replayed in full. Execs that the level script records for
+// itself need the script to make sense of them, so only the ones whose
+// effects are known get replayed: damage is dealt, and entities that get
+// spawned or despawned are allowed to appear or disappear, as long as the
+// game's script declares that it can do so in its ScriptedExecs. Everything
+// else that a script exec might change has to match anyway.
+type TurnValidator struct {
+	// Used for the entities of every game that gets decoded.
+	Sprites SpriteLoader
+
+	// The level scripts that games can be running. Scripted changes in games
+	// running any other script are rejected.
+	Scripts LevelScripts
+}
+
+func (tv *TurnValidator) ValidateTurn(script, before, execs, after []byte) (err error) {
+	defer recoverTurn(&err)
+	g, err := decodeGameState(before, tv.Sprites)
+	if err != nil {
+		return fmt.Errorf("couldn't decode the state at the start of the turn: %w", err)
+	}
+	claimed, err := decodeGameState(after, tv.Sprites)
+	if err != nil {
+		return fmt.Errorf("couldn't decode the state at the end of the turn: %w", err)
+	}
+	return replayTurn(g, claimed, execs, tv.Scripts.scriptedExecs(script))
+}
+
+// Turns a panic while replaying a turn into an error, since whatever a client
+// sends mustn't be able to take the server down.
+func recoverTurn(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("replaying the turn panicked: %v", r)
+	}
+}
+
+// Applies 'execs', as passed to Net.UpdateExecs, to 'g' and checks that it
+// ends up matching 'claimed'. 'limits' is what the level script's own execs
+// can do, nil if they can't do anything.
+func replayTurn(g, claimed *Game, execs []byte, limits *ScriptedExecs) error {
+	turn, err := decodeTurnExecs(execs)
+	if err != nil {
+		return fmt.Errorf("couldn't decode the turn's execs: %w", err)
+	}
+	changes := scriptedChanges{
+		limits:    limits,
+		spawned:   make(map[string]int),
+		despawned: make(map[EntityId]bool),
+	}
+	for i, exec := range turn {
+		if exec.action != nil {
+			err = g.ApplyExec(exec.action)
+		} else {
+			err = changes.apply(g, exec.script)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't replay exec %d: %w", i+1, err)
+		}
+	}
+	return compareTurnOutcome(g, claimed, changes)
+}
+
+// Decodes a state produced by Script.SaveGameState, ignoring the script's
+// store.
+func decodeGameState(state []byte, sprites SpriteLoader) (*Game, error) {
+	g := &Game{spriteManager: sprites}
+	ts := totalState{Game: &g}
+	err := base.FromBase64FromGob(&ts, string(state))
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errors.New("no game in state")
+	}
+	return g, nil
+}
+
+// One exec of a turn, either an ActionExec or one of the level script's own,
+// which is left as the table the script recorded.
+type turnExec struct {
+	action ActionExec
+	script map[interface{}]interface{}
+}
+
+// Decodes the lua array of execs that a script passes to Net.UpdateExecs.
+func decodeTurnExecs(execs []byte) ([]turnExec, error) {
+	val, err := luaDecodeValueToGo(bytes.NewBuffer(execs))
+	if err != nil {
+		return nil, err
+	}
+	table, ok := val.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a table of execs, got %T", val)
+	}
+	var indices []float64
+	for k := range table {
+		index, ok := k.(float64)
+		if !ok {
+			return nil, fmt.Errorf("expected an array of execs, found key %v", k)
+		}
+		indices = append(indices, index)
+	}
+	sort.Float64s(indices)
+
+	var ret []turnExec
+	for _, index := range indices {
+		exec, ok := table[index].(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("exec %v isn't a table", index)
+		}
+		encoded, ok := exec["__encoded"].(string)
+		if !ok {
+			ret = append(ret, turnExec{script: exec})
+			continue
+		}
+		var decoded []ActionExec
+		err = base.FromBase64FromGob(&decoded, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("exec %v: %w", index, err)
+		}
+		if len(decoded) != 1 {
+			return nil, fmt.Errorf("exec %v: found %d execs instead of exactly 1", index, len(decoded))
+		}
+		ret = append(ret, turnExec{action: decoded[0]})
+	}
+	return ret, nil
+}
+
+// What the level script's own execs did during a turn that replaying the
+// turn can't do itself.
+type scriptedChanges struct {
+	limits *ScriptedExecs
+
+	// How many entities of each name the script spawned.
+	spawned map[string]int
+
+	despawned map[EntityId]bool
+}
+
+// Applies a script exec, see e.g. StoreSpawn, StoreDespawn and StoreDamage
+// in the level scripts. Execs of any other kind are ignored.
+func (sc scriptedChanges) apply(g *Game, exec map[interface{}]interface{}) error {
+	switch {
+	case exec["script_spawn"] == true:
+		name, ok := exec["name"].(string)
+		if !ok {
+			return errors.New("spawn without a name")
+		}
+		if !sc.limits.canSpawn(name) {
+			return fmt.Errorf("the level script can't spawn %q", name)
+		}
+		sc.spawned[name]++
+
+	case exec["script_despawn"] == true:
+		id, ok := exec["entity"].(EntityId)
+		if !ok {
+			return errors.New("despawn without an entity")
+		}
+		if !sc.limits.canDespawn() {
+			return errors.New("the level script can't despawn entities")
+		}
+		sc.despawned[id] = true
+
+	case exec["script_damage"] == true:
+		id, _ := exec["entity"].(EntityId)
+		ent := g.EntityById(id)
+		if ent == nil || ent.Stats == nil {
+			return fmt.Errorf("damage to unknown entity %d", id)
+		}
+		amount, ok := exec["amount"].(float64)
+		if !ok || amount < 0 {
+			return fmt.Errorf("damage of %v to %s (%d)", exec["amount"], ent.Name, ent.Id)
+		}
+		if !sc.limits.canDamage(amount) {
+			return fmt.Errorf("the level script can't deal %v damage", amount)
+		}
+		// The exec also has the hp that the client thought the entity had, but
+		// the replayed hp is the one that counts.
+		ent.Stats.SetHp(ent.Stats.HpCur() - int(amount))
+	}
+	return nil
+}
+
+// The parts of an entity that replaying a turn has to reproduce exactly.
+type entOutcome struct {
+	X, Y       int
+	Hp, Ap     int
+	Conditions []string
+}
+
+func (o entOutcome) equal(other entOutcome) bool {
+	return o.X == other.X && o.Y == other.Y && o.Hp == other.Hp && o.Ap == other.Ap && slices.Equal(o.Conditions, other.Conditions)
+}
+
+func (o entOutcome) String() string {
+	return fmt.Sprintf("pos (%d, %d), hp %d, ap %d, conditions %v", o.X, o.Y, o.Hp, o.Ap, o.Conditions)
+}
+
+func outcomeOf(ent *Entity) entOutcome {
+	var o entOutcome
+	x, y := ent.FloorPos()
+	o.X, o.Y = int(x), int(y)
+	if ent.Stats != nil {
+		o.Hp = ent.Stats.HpCur()
+		o.Ap = ent.Stats.ApCur()
+		o.Conditions = ent.Stats.ConditionNames()
+		sort.Strings(o.Conditions)
+	}
+	return o
+}
+
+// Level scripts draw from the game's PRNG, e.g. with Script.Rand, which
+// replaying a turn doesn't reproduce. Scripts can only ever move it forward
+// though, so the PRNG that a client claims to have ended up with has to be at
+// most this many draws ahead of the replayed one.
+const maxScriptedDraws = 10000
+
+func compareTurnOutcome(replayed, claimed *Game, changes scriptedChanges) error {
+	for _, ent := range replayed.Ents {
+		if changes.despawned[ent.Id] {
+			continue
+		}
+		other := claimed.EntityById(ent.Id)
+		if other == nil {
+			return fmt.Errorf("%s (%d) is missing from the end of the turn", ent.Name, ent.Id)
+		}
+		want := outcomeOf(ent)
+		got := outcomeOf(other)
+		if !want.equal(got) {
+			return fmt.Errorf("%s (%d) should have ended the turn with %v but the client claimed %v", ent.Name, ent.Id, want, got)
+		}
+	}
+	spawned := maps.Clone(changes.spawned)
+	for _, ent := range claimed.Ents {
+		if replayed.EntityById(ent.Id) != nil {
+			continue
+		}
+		if spawned[ent.Name] == 0 {
+			return fmt.Errorf("%s (%d) appeared during the turn without being spawned", ent.Name, ent.Id)
+		}
+		spawned[ent.Name]--
+	}
+	if !randAdvancedTo(replayed.Rand, claimed.Rand, maxScriptedDraws) {
+		return errors.New("the PRNG doesn't follow on from the replayed one")
+	}
+	return nil
+}
+
+// Whether drawing at most 'draws' numbers from 'from' gets it to the same
+// state as 'to'. Neither is changed.
+func randAdvancedTo(from, to gobbablePrng, draws int) bool {
+	if from == nil || to == nil {
+		return from == nil && to == nil
+	}
+	r := cloneRand(from)
+	if r == nil {
+		return from.SameState(to)
+	}
+	for i := 0; !r.SameState(to); i++ {
+		if i == draws {
+			return false
+		}
+		r.Int63()
+	}
+	return true
+}
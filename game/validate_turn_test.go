@@ -0,0 +1,240 @@
+package game_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/MobRulesGames/golua/lua"
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/status"
+	"github.com/MobRulesGames/haunts/registry"
+	"github.com/MobRulesGames/haunts/texture"
+	"github.com/caffeine-storm/glop/render/rendertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Sets its entity's hp to whatever its exec says, a few steps after it
+// starts. Only what ApplyExec needs is implemented.
+type setHpAction struct {
+	game.Action
+	ent   *game.Entity
+	exec  *setHpExec
+	steps int
+}
+
+type setHpExec struct {
+	game.BasicActionExec
+	Hp int
+}
+
+// An exec that no action makes.
+type otherExec struct {
+	game.BasicActionExec
+}
+
+func init() {
+	gob.Register(&setHpExec{})
+}
+
+func (a *setHpAction) String() string { return "Set Hp" }
+func (a *setHpAction) Cancel()        {}
+
+func (a *setHpAction) IsExec(exec game.ActionExec) bool {
+	_, ok := exec.(*setHpExec)
+	return ok
+}
+
+// Panics on a negative hp, like actions do on execs they can't make sense of.
+func (a *setHpAction) Maintain(dt int64, g *game.Game, exec game.ActionExec) game.MaintenanceStatus {
+	if exec != nil {
+		a.exec = exec.(*setHpExec)
+		a.steps = 0
+	}
+	a.steps++
+	if a.steps < 3 {
+		return game.InProgress
+	}
+	if a.exec.Hp < 0 {
+		panic("negative hp")
+	}
+	a.ent.Stats.SetHp(a.exec.Hp)
+	return game.Complete
+}
+
+func givenAnEntityWithHp(g *game.Game, id game.EntityId, name string, hp int) *game.Entity {
+	ent := &game.Entity{EntityDef: &game.EntityDef{Name: name}}
+	ent.Id = id
+	stats := status.MakeInst(status.Base{Hp_max: 10, Ap_max: 10})
+	stats.SetHp(hp)
+	ent.Stats = &stats
+	ent.Actions = []game.Action{&setHpAction{ent: ent}}
+	g.Ents = append(g.Ents, ent)
+	return ent
+}
+
+// Two games with the same Teen and Ghost in them, e.g. one for the start of
+// a turn and one for what a client claims happened during it.
+func givenTwoGames() (*game.Game, *game.Game) {
+	var games [2]*game.Game
+	for i := range games {
+		games[i] = givenAGame()
+		givenAnEntityWithHp(games[i], 1, "Teen", 5)
+		givenAnEntityWithHp(games[i], 2, "Ghost", 8)
+	}
+	return games[0], games[1]
+}
+
+// Encodes the lua expression 'src' the same way that a script's execs get
+// encoded for Net.UpdateExecs.
+func encodeLua(src string) []byte {
+	L := lua.NewState()
+	defer L.Close()
+	L.OpenLibs()
+	So(L.DoString("value = "+src), ShouldBeNil)
+	L.GetGlobal("value")
+	buf := bytes.NewBuffer(nil)
+	So(game.LuaEncodeValue(buf, L, -1), ShouldBeNil)
+	return buf.Bytes()
+}
+
+// An exec, in lua, that sets the hp of entity 'id'.
+func setHpExecLua(id game.EntityId, hp int) string {
+	exec := &setHpExec{BasicActionExec: game.BasicActionExec{Ent: id, Index: 0}, Hp: hp}
+	encoded, err := base.ToGobToBase64([]game.ActionExec{exec})
+	So(err, ShouldBeNil)
+	return fmt.Sprintf("{__encoded = %q}", encoded)
+}
+
+func TestTurnValidation(t *testing.T) {
+	Convey("Turn validation", t, func() {
+		base.SetDatadir("../data")
+		texture.Init(rendertest.MakeStubbedRenderQueue())
+		registry.LoadAllRegistries()
+
+		Convey("decodes lua values without a lua state", func() {
+			val, err := game.LuaDecodeValueToGo(bytes.NewBuffer(encodeLua(`{1, "two", true, {type = "Entity", id = 3}, nested = {x = 1}}`)))
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, map[interface{}]interface{}{
+				1.0:      1.0,
+				2.0:      "two",
+				3.0:      true,
+				4.0:      game.EntityId(3),
+				"nested": map[interface{}]interface{}{"x": 1.0},
+			})
+
+			encoded := encodeLua(`{"truncated"}`)
+			_, err = game.LuaDecodeValueToGo(bytes.NewBuffer(encoded[:len(encoded)-2]))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("only gets ActionExecs out of a turn's execs, in order", func() {
+			execs, err := game.DecodeTurnExecs(encodeLua(fmt.Sprintf(`{%s, {script_spawn = true, name = "Teen"}, %s}`, setHpExecLua(2, 3), setHpExecLua(1, 4))))
+			So(err, ShouldBeNil)
+			So(len(execs), ShouldEqual, 2)
+			So(execs[0].EntityId(), ShouldEqual, game.EntityId(2))
+			So(execs[1].EntityId(), ShouldEqual, game.EntityId(1))
+
+			_, err = game.DecodeTurnExecs(encodeLua(`{first = {script_spawn = true}}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("applies an exec until everything has settled", func() {
+			g, _ := givenTwoGames()
+			So(g.ApplyExec(&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 2}, Hp: 3}), ShouldBeNil)
+			So(g.EntityById(2).Stats.HpCur(), ShouldEqual, 3)
+
+			So(g.ApplyExec(&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 7}}), ShouldNotBeNil)
+			So(g.ApplyExec(&setHpExec{BasicActionExec: game.BasicActionExec{Ent: 2, Index: 1}}), ShouldNotBeNil)
+		})
+
+		Convey("doesn't apply an exec that its action doesn't make", func() {
+			g, _ := givenTwoGames()
+			So(g.ApplyExec(&otherExec{BasicActionExec: game.BasicActionExec{Ent: 2}}), ShouldNotBeNil)
+			So(g.EntityById(2).Stats.HpCur(), ShouldEqual, 8)
+		})
+
+		Convey("reads what level scripts declare that their execs can do", func() {
+			scripts, err := game.LoadLevelScripts("../data/scripts")
+			So(err, ShouldBeNil)
+			prog, err := os.ReadFile("../data/scripts/Lvl02.lua")
+			So(err, ShouldBeNil)
+			So(scripts.ScriptedExecs(prog), ShouldResemble, &game.ScriptedExecs{Spawns: []string{"Angry Shade"}, Damage: []int{25}})
+
+			So(scripts.ScriptedExecs(append(prog, "\nScriptedExecs = {despawns = true}\n"...)), ShouldBeNil)
+			So(scripts.ScriptedExecs(nil), ShouldBeNil)
+		})
+
+		Convey("replaying a turn", func() {
+			before, claimed := givenTwoGames()
+			limits := &game.ScriptedExecs{Spawns: []string{"Teen"}, Damage: []int{2}, Despawns: true}
+			replay := func(execs string) error {
+				return game.CheckTurnReplay(before, claimed, encodeLua(execs), limits)
+			}
+
+			Convey("accepts the outcome the execs lead to", func() {
+				claimed.EntityById(2).Stats.SetHp(3)
+				So(replay(fmt.Sprintf("{%s}", setHpExecLua(2, 3))), ShouldBeNil)
+			})
+
+			Convey("rejects any other outcome", func() {
+				claimed.EntityById(2).Stats.SetHp(1)
+				So(replay(fmt.Sprintf("{%s}", setHpExecLua(2, 3))), ShouldNotBeNil)
+			})
+
+			Convey("doesn't let script execs exempt the entities they mention", func() {
+				claimed.EntityById(2).Stats.SetHp(10)
+				So(replay(`{{script_waypoint = true, entity = {type = "Entity", id = 2}}}`), ShouldNotBeNil)
+			})
+
+			Convey("deals damage from script execs", func() {
+				claimed.EntityById(2).Stats.SetHp(6)
+				So(replay(`{{script_damage = true, entity = {type = "Entity", id = 2}, amount = 2, hpcur = 8}}`), ShouldBeNil)
+				So(replay(`{{script_damage = true, entity = {type = "Entity", id = 2}, amount = -2, hpcur = 4}}`), ShouldNotBeNil)
+			})
+
+			Convey("only deals damage that the level script can deal", func() {
+				claimed.EntityById(2).Stats.SetHp(5)
+				So(replay(`{{script_damage = true, entity = {type = "Entity", id = 2}, amount = 3, hpcur = 8}}`), ShouldNotBeNil)
+				limits = nil
+				claimed.EntityById(2).Stats.SetHp(6)
+				So(replay(`{{script_damage = true, entity = {type = "Entity", id = 2}, amount = 2, hpcur = 8}}`), ShouldNotBeNil)
+			})
+
+			Convey("lets despawned entities go", func() {
+				claimed.Ents = claimed.Ents[:1]
+				So(replay(`{}`), ShouldNotBeNil)
+				So(replay(`{{script_despawn = true, entity = {type = "Entity", id = 2}}}`), ShouldBeNil)
+				limits.Despawns = false
+				So(replay(`{{script_despawn = true, entity = {type = "Entity", id = 2}}}`), ShouldNotBeNil)
+			})
+
+			Convey("only lets spawned entities appear", func() {
+				givenAnEntityWithHp(claimed, 3, "Teen", 5)
+				So(replay(`{}`), ShouldNotBeNil)
+				So(replay(`{{script_spawn = true, name = "Ghost"}}`), ShouldNotBeNil)
+				So(replay(`{{script_spawn = true, name = "Teen"}}`), ShouldBeNil)
+				limits.Spawns = nil
+				So(replay(`{{script_spawn = true, name = "Teen"}}`), ShouldNotBeNil)
+			})
+
+			Convey("rejects execs that its actions panic on", func() {
+				So(replay(fmt.Sprintf("{%s}", setHpExecLua(2, -1))), ShouldNotBeNil)
+			})
+
+			Convey("lets scripts move the PRNG forward", func() {
+				claimed.Rand.Int63()
+				claimed.Rand.Int63()
+				So(replay(`{}`), ShouldBeNil)
+			})
+
+			Convey("doesn't let the PRNG be replaced", func() {
+				claimed.Rand.Seed(12345)
+				So(replay(`{}`), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -218,6 +218,15 @@ func (hv *HouseViewer) SetState(state HouseViewerState) {
 	hv.HouseViewerState = state
 }
 
+// The line-of-sight texture that the house is drawn with.
+func (hv *HouseViewer) LosTexture() *LosTexture {
+	return hv.Los_tex
+}
+
+func (hv *HouseViewer) SetLosTexture(lt *LosTexture) {
+	hv.Los_tex = lt
+}
+
 func (hv *HouseViewer) SetAngle(theta float32) {
 	hv.angle = theta
 }
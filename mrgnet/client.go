@@ -0,0 +1,245 @@
+package mrgnet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Governs how DoActionContext and friends deal with a flaky connection.
+type RetryPolicy struct {
+	// Total number of tries, including the first one.
+	Attempts int
+
+	// Time allowed for a single attempt. Zero means attempts are only bounded
+	// by the caller's context.
+	Timeout time.Duration
+
+	// Delay before the first retry; it doubles after every retry up to
+	// MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Timeout:    10 * time.Second,
+	Backoff:    250 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+}
+
+// Actions that create or append data on the server aren't safe to repeat
+// unless we know the first attempt never got there.
+var nonIdempotentActions = map[string]bool{
+	"new":    true,
+	"update": true,
+}
+
+func shouldRetry(action string, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		// Never reached the server, always safe to try again.
+		return true
+	}
+	if nonIdempotentActions[action] {
+		return false
+	}
+	var stErr *StatusError
+	if errors.As(err, &stErr) {
+		return stErr.Code >= 500 || stErr.Code == http.StatusTooManyRequests
+	}
+	// Malformed requests, or responses, won't get better by asking again.
+	var decodeErr *decodeError
+	return !errors.As(err, &decodeErr)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Performs the named action with the current Transport, retrying transient
+// failures according to 'policy'. Requests are stamped with ClientVersion().
+// A server that won't talk to this version of the client results in a
+// *VersionError, any other failure to complete the round trip is returned as
+// a *NetError.
+func DoActionWithPolicy(ctx context.Context, policy RetryPolicy, name string, input, output interface{}) error {
+	t := CurrentTransport()
+	input = withClientVersion(input)
+	attempts := max(policy.Attempts, 1)
+	backoff := policy.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		}
+		err = t.Do(attemptCtx, name, input, output)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		var stErr *StatusError
+		if errors.As(err, &stErr) && stErr.Code == http.StatusUpgradeRequired {
+			return &VersionError{Action: name, Msg: stErr.Body}
+		}
+		if attempt >= attempts || ctx.Err() != nil || !shouldRetry(name, err) {
+			return &NetError{Action: name, Attempts: attempt, Err: err}
+		}
+		if sleepContext(ctx, backoff) != nil {
+			return &NetError{Action: name, Attempts: attempt, Err: err}
+		}
+		backoff = min(2*backoff, policy.MaxBackoff)
+	}
+}
+
+func DoActionContext(ctx context.Context, name string, input, output interface{}) error {
+	return DoActionWithPolicy(ctx, DefaultRetryPolicy, name, input, output)
+}
+
+// The following wrap each action with its request and response types. On top
+// of the errors from DoActionContext, a response that carries an Err string
+// is reported as a *ServerError.
+
+func UpdateUser(ctx context.Context, req UpdateUserRequest) (*UpdateUserResponse, error) {
+	var resp UpdateUserResponse
+	if err := DoActionContext(ctx, "user", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, serverError("user", resp.Err)
+}
+
+func NewGame(ctx context.Context, req NewGameRequest) (*NewGameResponse, error) {
+	var resp NewGameResponse
+	if err := DoActionContext(ctx, "new", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, serverError("new", resp.Err)
+}
+
+func ListGames(ctx context.Context, req ListGamesRequest) (*ListGamesResponse, error) {
+	var resp ListGamesResponse
+	if err := DoActionContext(ctx, "list", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, serverError("list", resp.Err)
+}
+
+func JoinGame(ctx context.Context, req JoinGameRequest) (*JoinGameResponse, error) {
+	var resp JoinGameResponse
+	if err := DoActionContext(ctx, "join", req, &resp); err != nil {
+		return nil, err
+	}
+	if err := serverError("join", resp.Err); err != nil {
+		return &resp, err
+	}
+	if !resp.Successful {
+		return &resp, &ServerError{Action: "join", Msg: "Couldn't join game."}
+	}
+	return &resp, nil
+}
+
+func UpdateGame(ctx context.Context, req UpdateGameRequest) (*UpdateGameResponse, error) {
+	var resp UpdateGameResponse
+	if err := DoActionContext(ctx, "update", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, serverError("update", resp.Err)
+}
+
+// Like UpdateGame, but sends the Before or After state as a delta against
+// 'base', if that makes it smaller. 'base' has to be a state the server
+// already has for the game, usually the last one this client sent or
+// received. If the server can't use the delta the full state is sent
+// instead.
+func UpdateGameWithDelta(ctx context.Context, req UpdateGameRequest, base []byte) (*UpdateGameResponse, error) {
+	state := &req.Before
+	if req.After != nil {
+		state = &req.After
+	}
+	if base == nil || *state == nil || req.Script != nil {
+		return UpdateGame(ctx, req)
+	}
+	delta := EncodeDelta(base, *state)
+	if len(delta) >= len(*state) {
+		return UpdateGame(ctx, req)
+	}
+
+	deltaReq := req
+	deltaReq.Delta = true
+	if req.After != nil {
+		deltaReq.After = delta
+	} else {
+		deltaReq.Before = delta
+	}
+	resp, err := UpdateGame(ctx, deltaReq)
+	if err == nil || resp == nil || !resp.Need_full {
+		return resp, err
+	}
+	return UpdateGame(ctx, req)
+}
+
+func Status(ctx context.Context, req StatusRequest) (*StatusResponse, error) {
+	var resp StatusResponse
+	if err := DoActionContext(ctx, "status", req, &resp); err != nil {
+		return nil, err
+	}
+	if err := serverError("status", resp.Err); err != nil {
+		return &resp, err
+	}
+	if resp.Game == nil {
+		return &resp, &ServerError{Action: "status", Msg: "The server didn't send the game."}
+	}
+	return &resp, nil
+}
+
+// How long a WaitRequest asks the server to wait for if it doesn't say.
+var DefaultWaitTimeout = 30 * time.Second
+
+// How long Wait sleeps instead of waiting when the server doesn't support the
+// "wait" action.
+var PollInterval = 5 * time.Second
+
+// Unlike the other actions a wait is expected to take a while so the per
+// attempt timeout is stretched to cover it. Servers that don't know how to
+// wait get polled instead; after PollInterval Wait reports a change so that
+// the caller checks again.
+func Wait(ctx context.Context, req WaitRequest) (*WaitResponse, error) {
+	if req.Timeout == 0 {
+		req.Timeout = DefaultWaitTimeout
+	}
+	policy := DefaultRetryPolicy
+	policy.Timeout += req.Timeout
+	var resp WaitResponse
+	err := DoActionWithPolicy(ctx, policy, "wait", req, &resp)
+	var stErr *StatusError
+	if errors.As(err, &stErr) && stErr.Code == http.StatusNotFound {
+		if err := sleepContext(ctx, PollInterval); err != nil {
+			return nil, &NetError{Action: "wait", Attempts: 1, Err: err}
+		}
+		return &WaitResponse{Revision: req.Revision, Changed: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, serverError("wait", resp.Err)
+}
+
+func Kill(ctx context.Context, req KillRequest) (*KillResponse, error) {
+	var resp KillResponse
+	if err := DoActionContext(ctx, "kill", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, serverError("kill", resp.Err)
+}
@@ -0,0 +1,164 @@
+package mrgnet_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fails with each of 'errs' in turn, then succeeds.
+type flakyTransport struct {
+	errs  []error
+	calls int
+}
+
+func (ft *flakyTransport) Do(ctx context.Context, name string, input, output interface{}) error {
+	ft.calls++
+	if len(ft.errs) == 0 {
+		return nil
+	}
+	err := ft.errs[0]
+	ft.errs = ft.errs[1:]
+	return err
+}
+
+// Blocks until the context is done.
+type hangingTransport struct{}
+
+func (hangingTransport) Do(ctx context.Context, name string, input, output interface{}) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+var quickPolicy = mrgnet.RetryPolicy{
+	Attempts:   3,
+	Timeout:    50 * time.Millisecond,
+	Backoff:    time.Millisecond,
+	MaxBackoff: 2 * time.Millisecond,
+}
+
+func givenTransport(t *testing.T, transport mrgnet.Transport) {
+	old := mrgnet.SetTransport(transport)
+	t.Cleanup(func() {
+		mrgnet.SetTransport(old)
+	})
+}
+
+func dialError() error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+}
+
+func TestRetries(t *testing.T) {
+	t.Run("retries until success", func(t *testing.T) {
+		ft := &flakyTransport{errs: []error{dialError(), errors.New("reset")}}
+		givenTransport(t, ft)
+
+		err := mrgnet.DoActionWithPolicy(context.Background(), quickPolicy, "status", mrgnet.StatusRequest{}, &mrgnet.StatusResponse{})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, ft.calls)
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		ft := &flakyTransport{errs: []error{dialError(), dialError(), dialError(), dialError()}}
+		givenTransport(t, ft)
+
+		err := mrgnet.DoActionWithPolicy(context.Background(), quickPolicy, "status", mrgnet.StatusRequest{}, &mrgnet.StatusResponse{})
+		var nerr *mrgnet.NetError
+		require.ErrorAs(t, err, &nerr)
+		assert.Equal(t, 3, nerr.Attempts)
+		assert.Equal(t, 3, ft.calls)
+		assert.Equal(t, "Couldn't connect to server.", mrgnet.UserMessage(err))
+	})
+
+	t.Run("doesn't repeat updates that might have landed", func(t *testing.T) {
+		ft := &flakyTransport{errs: []error{&mrgnet.StatusError{Action: "update", Code: 503}}}
+		givenTransport(t, ft)
+
+		err := mrgnet.DoActionWithPolicy(context.Background(), quickPolicy, "update", mrgnet.UpdateGameRequest{}, &mrgnet.UpdateGameResponse{})
+		assert.Error(t, err)
+		assert.Equal(t, 1, ft.calls)
+	})
+
+	t.Run("does repeat updates that never connected", func(t *testing.T) {
+		ft := &flakyTransport{errs: []error{dialError()}}
+		givenTransport(t, ft)
+
+		err := mrgnet.DoActionWithPolicy(context.Background(), quickPolicy, "update", mrgnet.UpdateGameRequest{}, &mrgnet.UpdateGameResponse{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, ft.calls)
+	})
+
+	t.Run("client errors aren't retried", func(t *testing.T) {
+		ft := &flakyTransport{errs: []error{&mrgnet.StatusError{Action: "status", Code: 400}}}
+		givenTransport(t, ft)
+
+		err := mrgnet.DoActionWithPolicy(context.Background(), quickPolicy, "status", mrgnet.StatusRequest{}, &mrgnet.StatusResponse{})
+		assert.Error(t, err)
+		assert.Equal(t, 1, ft.calls)
+	})
+}
+
+func TestTimeouts(t *testing.T) {
+	givenTransport(t, hangingTransport{})
+
+	start := time.Now()
+	err := mrgnet.DoActionWithPolicy(context.Background(), quickPolicy, "status", mrgnet.StatusRequest{}, &mrgnet.StatusResponse{})
+	assert.Less(t, time.Since(start), time.Second)
+	var nerr *mrgnet.NetError
+	require.ErrorAs(t, err, &nerr)
+	assert.True(t, nerr.Timeout())
+	assert.Equal(t, "Timed out waiting for the server.", mrgnet.UserMessage(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = mrgnet.DoActionWithPolicy(ctx, quickPolicy, "status", mrgnet.StatusRequest{}, &mrgnet.StatusResponse{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTypedCalls(t *testing.T) {
+	givenTransport(t, &mrgnet.RecordingTransport{
+		Respond: func(name string, input interface{}) (interface{}, error) {
+			switch name {
+			case "status":
+				return mrgnet.StatusResponse{Err: "no such game"}, nil
+			case "join":
+				return mrgnet.JoinGameResponse{}, nil
+			}
+			return mrgnet.KillResponse{}, nil
+		},
+	})
+	ctx := context.Background()
+
+	_, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Game_key: "nope"})
+	var serr *mrgnet.ServerError
+	require.ErrorAs(t, err, &serr)
+	assert.Equal(t, "no such game", mrgnet.UserMessage(err))
+
+	_, err = mrgnet.JoinGame(ctx, mrgnet.JoinGameRequest{Game_key: "nope"})
+	assert.ErrorAs(t, err, &serr)
+
+	_, err = mrgnet.Kill(ctx, mrgnet.KillRequest{Game_key: "nope"})
+	assert.NoError(t, err)
+}
+
+func TestWaitFallsBackToPolling(t *testing.T) {
+	ft := &flakyTransport{errs: []error{&mrgnet.StatusError{Action: "wait", Code: 404}}}
+	givenTransport(t, ft)
+	old := mrgnet.PollInterval
+	mrgnet.PollInterval = time.Millisecond
+	defer func() {
+		mrgnet.PollInterval = old
+	}()
+
+	resp, err := mrgnet.Wait(context.Background(), mrgnet.WaitRequest{Game_key: "a", Revision: 7})
+	require.NoError(t, err)
+	assert.True(t, resp.Changed, "callers should check for themselves")
+	assert.Equal(t, uint64(7), resp.Revision)
+	assert.Equal(t, 1, ft.calls)
+}
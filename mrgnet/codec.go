@@ -0,0 +1,48 @@
+package mrgnet
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// Every payload exchanged with the game server, in either direction, is a
+// single gob-encoded value wrapped in a gzip stream. Requests are sent as the
+// 'data' field of a form post; responses are the raw body.
+
+func EncodePayload(w io.Writer, v interface{}) error {
+	gzw := gzip.NewWriter(w)
+	err := gob.NewEncoder(gzw).Encode(v)
+	if err != nil {
+		gzw.Close()
+		return fmt.Errorf("couldn't gob %T: %w", v, err)
+	}
+	return gzw.Close()
+}
+
+// Returned by DecodePayload when the payload is malformed.
+type decodeError struct {
+	err error
+}
+
+func (de *decodeError) Error() string {
+	return de.err.Error()
+}
+
+func (de *decodeError) Unwrap() error {
+	return de.err
+}
+
+func DecodePayload(r io.Reader, v interface{}) error {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return &decodeError{fmt.Errorf("couldn't open gzip stream: %w", err)}
+	}
+	defer gzr.Close()
+	err = gob.NewDecoder(gzr).Decode(v)
+	if err != nil {
+		return &decodeError{fmt.Errorf("couldn't ungob %T: %w", v, err)}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package mrgnet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Game states are a few hundred KB and hardly change from one to the next,
+// so rather than uploading each one in full a client can send a delta against
+// a state that the server already has.
+//
+// A delta is laid out as:
+//
+//	"HDLT"
+//	one byte saying what the delta is of, deltaOfBytes or deltaOfBase64
+//	the StateHash of the base
+//	the StateHash of the state the delta produces
+//	a list of ops, each starting with a uvarint n:
+//	  n&1 == 0: copy n>>1 bytes from the base, starting at the uvarint offset
+//	            that follows
+//	  n&1 == 1: append the n>>1 bytes that follow
+//
+// States made by Script.SaveGameState are base64, where inserting a single
+// byte into the underlying gob changes every character after it. So when both
+// states are base64 the delta is between the bytes they decode to.
+
+const deltaMagic = "HDLT"
+
+const (
+	deltaOfBytes  byte = 1
+	deltaOfBase64 byte = 2
+)
+
+// Matches between the base and the target have to be at least this long to
+// be worth a copy op.
+const deltaBlockSize = 16
+
+var deltaHeaderSize = len(deltaMagic) + 1 + 2*sha256.Size
+
+// Returned by ApplyDelta when the delta wasn't made against the given base.
+var ErrDeltaBase = errors.New("delta was made against a different state")
+
+func StateHash(state []byte) [sha256.Size]byte {
+	return sha256.Sum256(state)
+}
+
+// Returns a delta that turns 'base' into 'target'.
+func EncodeDelta(base, target []byte) []byte {
+	kind := deltaOfBytes
+	from, to := base, target
+	if b, ok := decodeCanonicalBase64(base); ok {
+		if t, ok := decodeCanonicalBase64(target); ok {
+			kind = deltaOfBase64
+			from, to = b, t
+		}
+	}
+
+	out := bytes.NewBuffer(nil)
+	out.WriteString(deltaMagic)
+	out.WriteByte(kind)
+	baseHash := StateHash(base)
+	targetHash := StateHash(target)
+	out.Write(baseHash[:])
+	out.Write(targetHash[:])
+	writeDeltaOps(out, from, to)
+	return out.Bytes()
+}
+
+// Returns the StateHash of the state that 'delta' was made against.
+func DeltaBase(delta []byte) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	if len(delta) < deltaHeaderSize || string(delta[:len(deltaMagic)]) != deltaMagic {
+		return hash, errors.New("not a delta")
+	}
+	copy(hash[:], delta[len(deltaMagic)+1:])
+	return hash, nil
+}
+
+// Rebuilds the state that 'delta' was made from using the 'base' it was made
+// against.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	baseHash, err := DeltaBase(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseHash != StateHash(base) {
+		return nil, ErrDeltaBase
+	}
+	kind := delta[len(deltaMagic)]
+	var targetHash [sha256.Size]byte
+	copy(targetHash[:], delta[len(deltaMagic)+1+sha256.Size:])
+
+	from := base
+	if kind == deltaOfBase64 {
+		from, err = base64.StdEncoding.DecodeString(string(base))
+		if err != nil {
+			return nil, fmt.Errorf("base isn't base64: %w", err)
+		}
+	} else if kind != deltaOfBytes {
+		return nil, fmt.Errorf("unknown kind of delta %d", kind)
+	}
+
+	to, err := readDeltaOps(delta[deltaHeaderSize:], from)
+	if err != nil {
+		return nil, err
+	}
+	if kind == deltaOfBase64 {
+		to = []byte(base64.StdEncoding.EncodeToString(to))
+	}
+	if StateHash(to) != targetHash {
+		return nil, errors.New("delta didn't reproduce the state it was made from")
+	}
+	return to, nil
+}
+
+// Only base64 that re-encodes to exactly the same text can be diffed in its
+// decoded form, otherwise ApplyDelta couldn't reproduce the original.
+func decodeCanonicalBase64(b []byte) ([]byte, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(string(b))
+	if err != nil || base64.StdEncoding.EncodeToString(decoded) != string(b) {
+		return nil, false
+	}
+	return decoded, true
+}
+
+func writeDeltaOps(out *bytes.Buffer, base, target []byte) {
+	// Where each block of the base first shows up. Only blocks that start on a
+	// multiple of deltaBlockSize are indexed, every offset in the target is
+	// looked up, so any match at least twice as long as a block gets found.
+	index := make(map[string]int)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		key := string(base[i : i+deltaBlockSize])
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+
+	var scratch [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(scratch[:], v)
+		out.Write(scratch[:n])
+	}
+	literal := func(lit []byte) {
+		if len(lit) == 0 {
+			return
+		}
+		putUvarint(uint64(len(lit))<<1 | 1)
+		out.Write(lit)
+	}
+
+	pending := 0
+	i := 0
+	for i+deltaBlockSize <= len(target) {
+		offset, ok := index[string(target[i:i+deltaBlockSize])]
+		if !ok {
+			i++
+			continue
+		}
+		// The match may well have started before the block it was found by.
+		for offset > 0 && i > pending && base[offset-1] == target[i-1] {
+			offset--
+			i--
+		}
+		n := 0
+		for offset+n < len(base) && i+n < len(target) && base[offset+n] == target[i+n] {
+			n++
+		}
+		literal(target[pending:i])
+		putUvarint(uint64(n) << 1)
+		putUvarint(uint64(offset))
+		i += n
+		pending = i
+	}
+	literal(target[pending:])
+}
+
+func readDeltaOps(ops, base []byte) ([]byte, error) {
+	var out []byte
+	for len(ops) > 0 {
+		op, n := binary.Uvarint(ops)
+		if n <= 0 {
+			return nil, errors.New("truncated delta")
+		}
+		ops = ops[n:]
+		length := op >> 1
+		if op&1 == 1 {
+			if length > uint64(len(ops)) {
+				return nil, errors.New("truncated delta")
+			}
+			out = append(out, ops[:length]...)
+			ops = ops[length:]
+			continue
+		}
+		offset, n := binary.Uvarint(ops)
+		if n <= 0 {
+			return nil, errors.New("truncated delta")
+		}
+		ops = ops[n:]
+		if offset > uint64(len(base)) || length > uint64(len(base))-offset {
+			return nil, fmt.Errorf("delta copies %d bytes from %d but the base only has %d", length, offset, len(base))
+		}
+		out = append(out, base[offset:offset+length]...)
+	}
+	return out, nil
+}
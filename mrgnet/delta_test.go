@@ -0,0 +1,87 @@
+package mrgnet_test
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A stand-in for a saved game: mostly the same from one round to the next.
+func givenAState(rng *rand.Rand, size int) []byte {
+	state := make([]byte, size)
+	rng.Read(state)
+	return state
+}
+
+// Overwrites, inserts and deletes a few runs of bytes.
+func edited(rng *rand.Rand, state []byte) []byte {
+	out := append([]byte(nil), state...)
+	for i := 0; i < 5; i++ {
+		at := rng.Intn(len(out))
+		switch i % 3 {
+		case 0:
+			rng.Read(out[at:min(at+7, len(out))])
+		case 1:
+			insert := make([]byte, 1+rng.Intn(20))
+			rng.Read(insert)
+			out = append(out[:at], append(insert, out[at:]...)...)
+		case 2:
+			out = append(out[:at], out[min(at+13, len(out)):]...)
+		}
+	}
+	return out
+}
+
+func TestDeltas(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	before := givenAState(rng, 50000)
+	after := edited(rng, before)
+
+	t.Run("of raw bytes", func(t *testing.T) {
+		delta := mrgnet.EncodeDelta(before, after)
+		assert.Less(t, len(delta), len(after)/10)
+		got, err := mrgnet.ApplyDelta(before, delta)
+		require.NoError(t, err)
+		assert.Equal(t, after, got)
+	})
+
+	t.Run("of base64 states", func(t *testing.T) {
+		b64Before := []byte(base64.StdEncoding.EncodeToString(before))
+		b64After := []byte(base64.StdEncoding.EncodeToString(after))
+		delta := mrgnet.EncodeDelta(b64Before, b64After)
+		assert.Less(t, len(delta), len(b64After)/10)
+		got, err := mrgnet.ApplyDelta(b64Before, delta)
+		require.NoError(t, err)
+		assert.Equal(t, b64After, got)
+	})
+
+	t.Run("of unrelated states", func(t *testing.T) {
+		other := givenAState(rng, 1000)
+		delta := mrgnet.EncodeDelta(before, other)
+		got, err := mrgnet.ApplyDelta(before, delta)
+		require.NoError(t, err)
+		assert.Equal(t, other, got)
+	})
+
+	t.Run("only apply to their base", func(t *testing.T) {
+		delta := mrgnet.EncodeDelta(before, after)
+		hash, err := mrgnet.DeltaBase(delta)
+		require.NoError(t, err)
+		assert.Equal(t, mrgnet.StateHash(before), hash)
+
+		_, err = mrgnet.ApplyDelta(after, delta)
+		assert.ErrorIs(t, err, mrgnet.ErrDeltaBase)
+	})
+
+	t.Run("that are damaged are rejected", func(t *testing.T) {
+		delta := mrgnet.EncodeDelta(before, after)
+		_, err := mrgnet.ApplyDelta(before, delta[:len(delta)-1])
+		assert.Error(t, err)
+		_, err = mrgnet.DeltaBase([]byte("nope"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,97 @@
+package mrgnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// The server answered, but with an HTTP status other than 200.
+type StatusError struct {
+	Action string
+	Code   int
+	Body   string
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("mrgnet %q: server responded with status %d: %s", se.Action, se.Code, se.Body)
+}
+
+// The server handled the request but refused it; Msg is the response's Err
+// field.
+type ServerError struct {
+	Action string
+	Msg    string
+}
+
+func (se *ServerError) Error() string {
+	return fmt.Sprintf("mrgnet %q: %s", se.Action, se.Msg)
+}
+
+// The server won't talk to this client because of its version.
+type VersionError struct {
+	Action string
+	Msg    string
+}
+
+func (ve *VersionError) Error() string {
+	return fmt.Sprintf("mrgnet %q: incompatible version: %s", ve.Action, ve.Msg)
+}
+
+// We couldn't complete a round trip with the server at all, even after
+// retrying.
+type NetError struct {
+	Action   string
+	Attempts int
+	Err      error
+}
+
+func (ne *NetError) Error() string {
+	return fmt.Sprintf("mrgnet %q failed after %d attempt(s): %v", ne.Action, ne.Attempts, ne.Err)
+}
+
+func (ne *NetError) Unwrap() error {
+	return ne.Err
+}
+
+func (ne *NetError) Timeout() bool {
+	if errors.Is(ne.Err, context.DeadlineExceeded) {
+		return true
+	}
+	var nerr net.Error
+	return errors.As(ne.Err, &nerr) && nerr.Timeout()
+}
+
+// Returns nil if msg is empty, otherwise a *ServerError.
+func serverError(action, msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return &ServerError{Action: action, Msg: msg}
+}
+
+// Describes 'err' in terms that make sense to a player.
+func UserMessage(err error) string {
+	var serr *ServerError
+	var verr *VersionError
+	var stErr *StatusError
+	var nerr *NetError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &serr):
+		return serr.Msg
+	case errors.As(err, &verr):
+		return verr.Msg
+	case errors.Is(err, context.Canceled):
+		return "Cancelled."
+	case errors.As(err, &nerr) && nerr.Timeout():
+		return "Timed out waiting for the server."
+	case errors.As(err, &stErr):
+		return fmt.Sprintf("The server had a problem (%d).", stErr.Code)
+	case errors.As(err, &nerr):
+		return "Couldn't connect to server."
+	}
+	return err.Error()
+}
@@ -1,15 +1,9 @@
 package mrgnet
 
 import (
-	"bytes"
-	"compress/gzip"
+	"context"
 	"crypto/rand"
-	"encoding/gob"
-	"fmt"
-	"io"
 	"math/big"
-	"net/http"
-	"net/url"
 	"time"
 )
 
@@ -22,43 +16,11 @@ type (
 
 const Host_url = "http://localhost:8080"
 
+// Performs the named action on the game server using the current Transport
+// and the DefaultRetryPolicy. Prefer DoActionContext, or one of the typed
+// wrappers like Status, where a context is available.
 func DoAction(name string, input, output interface{}) error {
-	zipit := true
-	buf := bytes.NewBuffer(nil)
-	var gzw io.Writer
-	if zipit {
-		gzw = gzip.NewWriter(buf)
-	} else {
-		gzw = buf
-	}
-	err := gob.NewEncoder(gzw).Encode(input)
-	if err != nil {
-		return err
-	}
-	if zipit {
-		gzw.(*gzip.Writer).Close()
-	}
-	host_url := fmt.Sprintf("%s/%s", Host_url, name)
-	r, err := http.PostForm(host_url, url.Values{"data": []string{string(buf.Bytes())}})
-	if err != nil {
-		return err
-	}
-
-	var gzr io.Reader
-	if zipit {
-		gzr, err = gzip.NewReader(r.Body)
-		if err != nil {
-			panic(err.Error())
-		}
-	} else {
-		gzr = r.Body
-	}
-	data, err := io.ReadAll(gzr)
-	if err != nil {
-		panic(err.Error())
-	}
-	dec := gob.NewDecoder(bytes.NewBuffer(data))
-	return dec.Decode(output)
+	return DoActionContext(context.Background(), name, input, output)
 }
 
 // Creates a random id that will be unique among all other engines with high
@@ -79,7 +41,11 @@ type User struct {
 }
 
 type (
-	UpdateUserRequest  User
+	UpdateUserRequest struct {
+		Version
+		Id   NetId
+		Name string
+	}
 	UpdateUserResponse struct {
 		User
 		Err string
@@ -87,6 +53,7 @@ type (
 )
 
 type NewGameRequest struct {
+	Version
 	Id NetId
 }
 
@@ -97,19 +64,29 @@ type NewGameResponse struct {
 }
 
 type ListGamesRequest struct {
+	Version
 	Id        NetId
 	Unstarted bool
+
+	// Lists games in progress that the requester isn't playing in, i.e. the
+	// ones they can watch, instead. Unstarted is ignored if this is set.
+	Watchable bool
 }
 
 type ListGamesResponse struct {
 	Err       string
 	Games     []Game
 	Game_keys []GameKey
+
+	// Pass this along in a WaitRequest with no Game_key to find out when the
+	// list might have changed.
+	Revision uint64
 }
 
 // Updates an active game by appending a Playback, or updating the last
 // playback, with either new State or new Execs
 type UpdateGameRequest struct {
+	Version
 	Id        NetId
 	Game_key  GameKey
 	Round     int
@@ -120,13 +97,36 @@ type UpdateGameRequest struct {
 	Execs  []byte
 	After  []byte
 	Script []byte
+
+	// "intruders" or "denizens": the side that won, sent by the client whose
+	// level script ended the game.
+	Winner string
+
+	// If set, Before or After is a delta, see EncodeDelta, against a state the
+	// server already has for this game rather than the state itself.
+	Delta bool
+
+	// Sent along with Execs and After: the client's checksum of the game at
+	// the end of the turn. Whoever plays the turn back should end up with the
+	// same one.
+	Checksum string
+
+	// Set by a client whose playback of the last turn didn't end up with the
+	// checksum that came with it. Describes what went wrong.
+	Desync string
 }
 
 type UpdateGameResponse struct {
 	Err string
+
+	// Set when the server couldn't make use of a delta, e.g. because it
+	// doesn't have the state it was made against. Sending the full state
+	// instead will work.
+	Need_full bool
 }
 
 type JoinGameRequest struct {
+	Version
 	Id       NetId
 	Game_key GameKey
 }
@@ -137,6 +137,7 @@ type JoinGameResponse struct {
 }
 
 type StatusRequest struct {
+	Version
 	Id         NetId
 	Game_key   GameKey
 	Sizes_only bool
@@ -145,9 +146,14 @@ type StatusRequest struct {
 type StatusResponse struct {
 	Err  string
 	Game *Game
+
+	// Pass this along in a WaitRequest for the same game to find out when it
+	// changes.
+	Revision uint64
 }
 
 type KillRequest struct {
+	Version
 	Id       NetId
 	Game_key GameKey
 }
@@ -156,11 +162,41 @@ type KillResponse struct {
 	Err string
 }
 
+// Blocks until something changes on the server so that clients don't have to
+// keep polling to find out when the other player has moved.
+type WaitRequest struct {
+	Version
+	Id NetId
+
+	// The game to watch. If empty the wait ends when any game changes.
+	Game_key GameKey
+
+	// The Revision from the last response the client saw; the wait ends as
+	// soon as the server's revision is different.
+	Revision uint64
+
+	// How long the server should wait for a change before giving up. The
+	// server picks a default if this is zero and caps it if it's too long.
+	Timeout time.Duration
+}
+
+type WaitResponse struct {
+	Err      string
+	Revision uint64
+
+	// False if the wait timed out without anything changing.
+	Changed bool
+}
+
 type Game struct {
 	Name string
 
 	Created time.Time
 
+	// The version of the client that created the game; everyone playing it
+	// needs a compatible one.
+	Version Version
+
 	Denizens_name  string
 	Denizens_id    NetId
 	Intruders_name string
@@ -176,4 +212,10 @@ type Game struct {
 	// If this is non-zero then the game is over and the winner is the player
 	// whose NetId matches this value
 	Winner NetId
+
+	// The Checksum sent along with each of After, empty if none was.
+	Checksums []string
+
+	// The most recent Desync that either player reported.
+	Desync string
 }
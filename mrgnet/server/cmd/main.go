@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/MobRulesGames/haunts/mrgnet/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dir := flag.String("dir", "mrgnet-data", "directory to keep users and games in")
+	data := flag.String("data", "", "game data directory; if set, submitted turns are replayed and rejected if they don't check out")
+	flag.Parse()
+
+	store, err := server.OpenStore(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't open store: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := server.New(store)
+	if *data != "" {
+		validator, err := makeTurnValidator(*data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't load game data: %v\n", err)
+			os.Exit(1)
+		}
+		srv.SetTurnValidator(validator)
+		logging.Info("validating turns", "data", *data)
+	}
+
+	logging.Info("mrgnet server listening", "addr", *addr, "dir", *dir)
+	err = http.ListenAndServe(*addr, srv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "server stopped: %v\n", err)
+		os.Exit(1)
+	}
+}
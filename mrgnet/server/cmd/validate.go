@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/actions"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/mrgnet/server"
+	"github.com/MobRulesGames/haunts/registry"
+)
+
+// Loads just enough of the game from 'datadir' to replay turns. The server
+// has no display so nothing is ever actually rendered.
+func makeTurnValidator(datadir string) (server.TurnValidator, error) {
+	base.SetDatadir(datadir)
+	err := house.SetDatadir(datadir)
+	if err != nil {
+		return nil, err
+	}
+	sprites := game.SetHeadless()
+	registry.LoadAllRegistries()
+	game.LoadAllEntities()
+	actions.Init()
+
+	// Ais never get to act during a replay.
+	game.SetAiMaker(func(path string, g *game.Game, ent *game.Entity, dst *game.Ai, kind game.AiKind) {})
+
+	scripts, err := game.LoadLevelScripts(filepath.Join(datadir, "scripts"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &game.TurnValidator{Sprites: sprites, Scripts: scripts}, nil
+}
@@ -0,0 +1,607 @@
+// Package server is a reference implementation of the game server that
+// mrgnet.DoAction talks to. It keeps its state on local disk so a handful of
+// players can host their own online games.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MobRulesGames/haunts/logging"
+	"github.com/MobRulesGames/haunts/mrgnet"
+)
+
+type handler struct {
+	do func(ctx context.Context, data io.Reader) (interface{}, error)
+
+	// Blocking handlers can take a long time to respond so they take care of
+	// their own locking rather than holding everyone else up.
+	blocking bool
+}
+
+// Returned by a handler when the client's protocol is one we can't talk to.
+type incompatibleError struct {
+	msg string
+}
+
+func (ie *incompatibleError) Error() string {
+	return ie.msg
+}
+
+func decodeRequest[Req any](data io.Reader) (*Req, error) {
+	var req Req
+	err := mrgnet.DecodePayload(data, &req)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := any(&req).(mrgnet.Versioned); ok {
+		if msg := mrgnet.CheckProtocol(v.RequestVersion()); msg != "" {
+			return nil, &incompatibleError{msg: msg}
+		}
+	}
+	return &req, nil
+}
+
+// Builds a handler that decodes a *Req from the request payload, runs 'do' on
+// it and hands back the response to be encoded.
+func action[Req any, Resp any](do func(*Req) Resp) handler {
+	return handler{
+		do: func(_ context.Context, data io.Reader) (interface{}, error) {
+			req, err := decodeRequest[Req](data)
+			if err != nil {
+				return nil, err
+			}
+			resp := do(req)
+			return &resp, nil
+		},
+	}
+}
+
+// Like action but for handlers that block; 'do' is run without holding the
+// server's lock and 'ctx' is done when the client goes away.
+func blockingAction[Req any, Resp any](do func(context.Context, *Req) Resp) handler {
+	return handler{
+		do: func(ctx context.Context, data io.Reader) (interface{}, error) {
+			req, err := decodeRequest[Req](data)
+			if err != nil {
+				return nil, err
+			}
+			resp := do(ctx, req)
+			return &resp, nil
+		},
+		blocking: true,
+	}
+}
+
+// Decides whether a turn really plays out the way a client says it did.
+// 'before' and 'after' are the states at the start and end of the turn and
+// 'execs' is what happened in between, all exactly as the client sent them.
+// 'script' is the game's level script, nil if it hasn't been set.
+type TurnValidator interface {
+	ValidateTurn(script, before, execs, after []byte) error
+}
+
+type Server struct {
+	store *Store
+
+	// If set, turns that don't pass validation are rejected.
+	validator TurnValidator
+
+	// Every action is a read-modify-write of the store so we just do one at a
+	// time.
+	mu sync.Mutex
+
+	changes changes
+
+	actions map[string]handler
+}
+
+var _ http.Handler = (*Server)(nil)
+
+func New(store *Store) *Server {
+	srv := &Server{store: store}
+	srv.changes.init()
+	// These names must match the ones the client passes to mrgnet.DoAction.
+	srv.actions = map[string]handler{
+		"user":   action(srv.updateUser),
+		"new":    action(srv.newGame),
+		"list":   action(srv.listGames),
+		"join":   action(srv.joinGame),
+		"update": action(srv.updateGame),
+		"status": action(srv.status),
+		"kill":   action(srv.kill),
+		"wait":   blockingAction(srv.wait),
+	}
+	return srv
+}
+
+func (srv *Server) SetTurnValidator(v TurnValidator) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.validator = v
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(r.URL.Path, "/")
+	do, ok := srv.actions[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "actions must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := strings.NewReader(r.FormValue("data"))
+	var resp interface{}
+	var err error
+	if do.blocking {
+		resp, err = do.do(r.Context(), data)
+	} else {
+		resp, err = srv.doLocked(r.Context(), do, data)
+	}
+	var incompatible *incompatibleError
+	if errors.As(err, &incompatible) {
+		logging.Info("mrgnet server: turned away incompatible client", "action", name, "err", err)
+		http.Error(w, incompatible.msg, http.StatusUpgradeRequired)
+		return
+	}
+	if err != nil {
+		logging.Warn("mrgnet server: bad request", "action", name, "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = mrgnet.EncodePayload(buf, resp)
+	if err != nil {
+		logging.Error("mrgnet server: couldn't encode response", "action", name, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(buf.Bytes())
+}
+
+// Runs a non-blocking handler. The lock has to be released even if the
+// handler panics, since http.Server recovers from it and carries on.
+func (srv *Server) doLocked(ctx context.Context, do handler, data io.Reader) (interface{}, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return do.do(ctx, data)
+}
+
+// Game keys sort by creation time, the random suffix keeps them unguessable.
+func makeGameKey(now time.Time) mrgnet.GameKey {
+	suffix := make([]byte, 8)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		panic(fmt.Errorf("couldn't read random bytes: %w", err))
+	}
+	return mrgnet.GameKey(fmt.Sprintf("%016x-%s", now.UnixNano(), hex.EncodeToString(suffix)))
+}
+
+func (srv *Server) lookupUser(id mrgnet.NetId) (mrgnet.User, error) {
+	user, err := srv.store.User(id)
+	if errors.Is(err, ErrNotFound) {
+		return mrgnet.User{Id: id}, nil
+	}
+	return user, err
+}
+
+func (srv *Server) userName(id mrgnet.NetId) string {
+	if id == 0 {
+		return ""
+	}
+	user, err := srv.lookupUser(id)
+	if err != nil || user.Name == "" {
+		return "Anonymous"
+	}
+	return user.Name
+}
+
+// Names can change after a game was created so we always report the current
+// ones.
+func (srv *Server) refreshNames(game *mrgnet.Game) {
+	game.Denizens_name = srv.userName(game.Denizens_id)
+	game.Intruders_name = srv.userName(game.Intruders_id)
+}
+
+func isPlayer(game *mrgnet.Game, id mrgnet.NetId) bool {
+	return id != 0 && (game.Denizens_id == id || game.Intruders_id == id)
+}
+
+// Returns a copy of 'game' with every blob emptied out. The number of blobs
+// is preserved since clients use it to work out whose turn it is.
+func sizesOnly(game *mrgnet.Game) *mrgnet.Game {
+	ret := *game
+	empty := func(blobs [][]byte) [][]byte {
+		if blobs == nil {
+			return nil
+		}
+		return make([][]byte, len(blobs))
+	}
+	ret.Before = empty(game.Before)
+	ret.Execs = empty(game.Execs)
+	ret.After = empty(game.After)
+	ret.Script = nil
+	return &ret
+}
+
+func (srv *Server) updateUser(req *mrgnet.UpdateUserRequest) mrgnet.UpdateUserResponse {
+	var resp mrgnet.UpdateUserResponse
+	if req.Id == 0 {
+		resp.Err = "no user id given"
+		return resp
+	}
+	user, err := srv.lookupUser(req.Id)
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	if req.Name != "" && req.Name != user.Name {
+		user.Name = req.Name
+		err = srv.store.PutUser(user)
+		if err != nil {
+			resp.Err = err.Error()
+			return resp
+		}
+		logging.Info("mrgnet server: updated user", "id", user.Id, "name", user.Name)
+	}
+	resp.User = user
+	return resp
+}
+
+func (srv *Server) newGame(req *mrgnet.NewGameRequest) mrgnet.NewGameResponse {
+	var resp mrgnet.NewGameResponse
+	if req.Id == 0 {
+		resp.Err = "no user id given"
+		return resp
+	}
+	now := time.Now()
+	game := mrgnet.Game{
+		Name:        fmt.Sprintf("%s's game", srv.userName(req.Id)),
+		Created:     now,
+		Version:     req.Version,
+		Denizens_id: req.Id,
+	}
+	key := makeGameKey(now)
+	err := srv.store.PutGame(key, &game)
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	srv.changes.note(key)
+	logging.Info("mrgnet server: new game", "key", key, "denizens", req.Id)
+	resp.Name = game.Name
+	resp.Game_key = key
+	return resp
+}
+
+// If req.Unstarted is set this lists games that are waiting for an opponent
+// other than the requester, otherwise it lists the unfinished games that the
+// requester is playing in.
+func (srv *Server) listGames(req *mrgnet.ListGamesRequest) mrgnet.ListGamesResponse {
+	var resp mrgnet.ListGamesResponse
+	resp.Revision = srv.changes.revision("")
+	keys, err := srv.store.GameKeys()
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	for _, key := range keys {
+		game, err := srv.store.Game(key)
+		if err != nil {
+			logging.Warn("mrgnet server: skipping unreadable game", "key", key, "err", err)
+			continue
+		}
+		if game.Winner != 0 {
+			continue
+		}
+		var match bool
+		switch {
+		case req.Watchable:
+			match = game.Intruders_id != 0 && !isPlayer(game, req.Id)
+		case req.Unstarted:
+			match = game.Intruders_id == 0 && game.Denizens_id != req.Id
+		default:
+			match = isPlayer(game, req.Id)
+		}
+		if !match {
+			continue
+		}
+		srv.refreshNames(game)
+		resp.Games = append(resp.Games, *sizesOnly(game))
+		resp.Game_keys = append(resp.Game_keys, key)
+	}
+	return resp
+}
+
+func (srv *Server) joinGame(req *mrgnet.JoinGameRequest) mrgnet.JoinGameResponse {
+	var resp mrgnet.JoinGameResponse
+	if req.Id == 0 {
+		resp.Err = "no user id given"
+		return resp
+	}
+	game, err := srv.store.Game(req.Game_key)
+	if err != nil {
+		resp.Err = fmt.Sprintf("couldn't find game: %v", err)
+		return resp
+	}
+	if msg := mrgnet.CheckGameVersion(game.Version, req.Version); msg != "" {
+		resp.Err = msg
+		return resp
+	}
+	switch {
+	case game.Intruders_id == req.Id:
+		// Already joined, joining again is harmless.
+	case game.Denizens_id == req.Id:
+		resp.Err = "you can't join your own game"
+		return resp
+	case game.Intruders_id != 0:
+		resp.Err = "that game already has two players"
+		return resp
+	default:
+		game.Intruders_id = req.Id
+		err = srv.store.PutGame(req.Game_key, game)
+		if err != nil {
+			resp.Err = err.Error()
+			return resp
+		}
+		srv.changes.note(req.Game_key)
+		logging.Info("mrgnet server: joined game", "key", req.Game_key, "intruders", req.Id)
+	}
+	resp.Successful = true
+	return resp
+}
+
+// Before, Execs and After are indexed by turn; the denizens play the even
+// turns and the intruders play the odd ones.
+func turnIndex(round int, intruders bool) int {
+	if intruders {
+		return 2*round + 1
+	}
+	return 2 * round
+}
+
+func (srv *Server) updateGame(req *mrgnet.UpdateGameRequest) mrgnet.UpdateGameResponse {
+	var resp mrgnet.UpdateGameResponse
+	game, err := srv.store.Game(req.Game_key)
+	if err != nil {
+		resp.Err = fmt.Sprintf("couldn't find game: %v", err)
+		return resp
+	}
+	if !isPlayer(game, req.Id) {
+		resp.Err = "you aren't playing in that game"
+		return resp
+	}
+	if req.Winner != "" {
+		return srv.endGame(req.Game_key, game, req)
+	}
+	if game.Winner != 0 {
+		resp.Err = "that game is already over"
+		return resp
+	}
+	if msg := mrgnet.CheckGameVersion(game.Version, req.Version); msg != "" {
+		resp.Err = msg
+		return resp
+	}
+
+	if req.Delta {
+		err = undelta(game, req)
+		if err != nil {
+			logging.Info("mrgnet server: couldn't use delta", "key", req.Game_key, "err", err)
+			resp.Err = fmt.Sprintf("couldn't use delta: %v", err)
+			resp.Need_full = true
+			return resp
+		}
+	}
+	err = applyUpdate(game, req, srv.validator)
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	if req.Desync != "" {
+		logging.Warn("mrgnet server: desync reported", "key", req.Game_key, "player", req.Id, "desync", req.Desync)
+		game.Desync = req.Desync
+	}
+	err = srv.store.PutGame(req.Game_key, game)
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	srv.changes.note(req.Game_key)
+	return resp
+}
+
+// Records the winner of a game. Both players' clients see the game end, so
+// hearing about it again is fine as long as the winner is the same.
+func (srv *Server) endGame(key mrgnet.GameKey, game *mrgnet.Game, req *mrgnet.UpdateGameRequest) mrgnet.UpdateGameResponse {
+	var resp mrgnet.UpdateGameResponse
+	if req.Before != nil || req.Execs != nil || req.After != nil || req.Script != nil {
+		resp.Err = "the winner can't be sent along with anything else"
+		return resp
+	}
+	if game.Intruders_id == 0 {
+		resp.Err = "that game hasn't started"
+		return resp
+	}
+	var winner mrgnet.NetId
+	switch req.Winner {
+	case "intruders":
+		winner = game.Intruders_id
+	case "denizens":
+		winner = game.Denizens_id
+	default:
+		resp.Err = fmt.Sprintf("unknown winner %q", req.Winner)
+		return resp
+	}
+	if game.Winner != 0 {
+		if game.Winner != winner {
+			resp.Err = "that game is already over"
+		}
+		return resp
+	}
+	game.Winner = winner
+	err := srv.store.PutGame(key, game)
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	srv.changes.note(key)
+	logging.Info("mrgnet server: game over", "key", key, "winner", winner)
+	return resp
+}
+
+// Replaces the delta in 'req' with the state it was made from. Deltas are
+// made against whatever state the client last knew about, so every state the
+// game has is a candidate base, most recent first.
+func undelta(game *mrgnet.Game, req *mrgnet.UpdateGameRequest) error {
+	state := &req.Before
+	if req.After != nil {
+		state = &req.After
+	}
+	if *state == nil {
+		return errors.New("no state to apply the delta to")
+	}
+	hash, err := mrgnet.DeltaBase(*state)
+	if err != nil {
+		return err
+	}
+	for i := len(game.Before) - 1; i >= 0; i-- {
+		for _, base := range [][]byte{safeIndex(game.After, i), game.Before[i]} {
+			if base == nil || mrgnet.StateHash(base) != hash {
+				continue
+			}
+			full, err := mrgnet.ApplyDelta(base, *state)
+			if err != nil {
+				return err
+			}
+			*state = full
+			req.Delta = false
+			return nil
+		}
+	}
+	return mrgnet.ErrDeltaBase
+}
+
+func safeIndex(states [][]byte, i int) []byte {
+	if i < len(states) {
+		return states[i]
+	}
+	return nil
+}
+
+func applyUpdate(game *mrgnet.Game, req *mrgnet.UpdateGameRequest, validator TurnValidator) error {
+	if req.Script != nil {
+		if req.Before != nil || req.Execs != nil || req.After != nil {
+			return errors.New("a script update can't carry any state")
+		}
+		if game.Script != nil {
+			return errors.New("the game script has already been set")
+		}
+		game.Script = req.Script
+		return nil
+	}
+
+	if req.Round < 0 {
+		return fmt.Errorf("invalid round %d", req.Round)
+	}
+	// Players may only submit turns for their own side.
+	if req.Intruders != (req.Id == game.Intruders_id) {
+		return errors.New("that isn't your side")
+	}
+	turn := turnIndex(req.Round, req.Intruders)
+	if turn != len(game.Execs) {
+		return fmt.Errorf("it isn't turn %d, it's turn %d", turn, len(game.Execs))
+	}
+
+	switch {
+	case req.Before != nil:
+		if req.Execs != nil || req.After != nil {
+			return errors.New("can't update Before along with Execs or After")
+		}
+		switch len(game.Before) {
+		case turn:
+			game.Before = append(game.Before, req.Before)
+		case turn + 1:
+			game.Before[turn] = req.Before
+		default:
+			return fmt.Errorf("turn %d has no prior state", turn)
+		}
+
+	case req.Execs != nil:
+		if len(game.Before) != turn+1 {
+			return fmt.Errorf("turn %d has no Before state to apply execs to", turn)
+		}
+		if validator != nil {
+			err := validator.ValidateTurn(game.Script, game.Before[turn], req.Execs, req.After)
+			if err != nil {
+				logging.Warn("mrgnet server: rejected turn", "turn", turn, "player", req.Id, "err", err)
+				return fmt.Errorf("turn %d was rejected: %w", turn, err)
+			}
+		}
+		game.Execs = append(game.Execs, req.Execs)
+		game.After = append(game.After, req.After)
+		// Games from before checksums existed don't have one for every turn.
+		for len(game.Checksums) < turn {
+			game.Checksums = append(game.Checksums, "")
+		}
+		game.Checksums = append(game.Checksums, req.Checksum)
+
+	default:
+		return errors.New("nothing to update")
+	}
+	return nil
+}
+
+func (srv *Server) status(req *mrgnet.StatusRequest) mrgnet.StatusResponse {
+	var resp mrgnet.StatusResponse
+	resp.Revision = srv.changes.revision(req.Game_key)
+	game, err := srv.store.Game(req.Game_key)
+	if err != nil {
+		resp.Err = fmt.Sprintf("couldn't find game: %v", err)
+		return resp
+	}
+	if msg := mrgnet.CheckGameVersion(game.Version, req.Version); msg != "" {
+		resp.Err = msg
+		return resp
+	}
+	srv.refreshNames(game)
+	if req.Sizes_only {
+		game = sizesOnly(game)
+	}
+	resp.Game = game
+	return resp
+}
+
+func (srv *Server) kill(req *mrgnet.KillRequest) mrgnet.KillResponse {
+	var resp mrgnet.KillResponse
+	game, err := srv.store.Game(req.Game_key)
+	if err != nil {
+		resp.Err = fmt.Sprintf("couldn't find game: %v", err)
+		return resp
+	}
+	if !isPlayer(game, req.Id) {
+		resp.Err = "you aren't playing in that game"
+		return resp
+	}
+	err = srv.store.DeleteGame(req.Game_key)
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	srv.changes.note(req.Game_key)
+	logging.Info("mrgnet server: killed game", "key", req.Game_key, "by", req.Id)
+	return resp
+}
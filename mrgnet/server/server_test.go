@@ -0,0 +1,449 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/MobRulesGames/haunts/mrgnet/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type client struct {
+	t         *testing.T
+	transport mrgnet.Transport
+}
+
+func givenAServer(t *testing.T) *client {
+	store, err := server.OpenStore(t.TempDir())
+	require.NoError(t, err)
+	srv := httptest.NewServer(server.New(store))
+	t.Cleanup(srv.Close)
+	c := &client{t: t, transport: &mrgnet.HTTPTransport{URL: srv.URL}}
+	old := mrgnet.SetTransport(c.transport)
+	t.Cleanup(func() {
+		mrgnet.SetTransport(old)
+	})
+	return c
+}
+
+// Goes through mrgnet.DoActionWithPolicy so that requests carry the client's
+// version like they do in the game.
+func (c *client) do(name string, input, output interface{}) {
+	err := mrgnet.DoActionWithPolicy(context.Background(), mrgnet.RetryPolicy{Attempts: 1}, name, input, output)
+	require.NoError(c.t, err)
+}
+
+func (c *client) newGame(id mrgnet.NetId) mrgnet.GameKey {
+	var resp mrgnet.NewGameResponse
+	c.do("new", mrgnet.NewGameRequest{Id: id}, &resp)
+	require.Empty(c.t, resp.Err)
+	require.NotEmpty(c.t, resp.Game_key)
+	return resp.Game_key
+}
+
+func (c *client) status(id mrgnet.NetId, key mrgnet.GameKey, sizesOnly bool) *mrgnet.Game {
+	var resp mrgnet.StatusResponse
+	c.do("status", mrgnet.StatusRequest{Id: id, Game_key: key, Sizes_only: sizesOnly}, &resp)
+	require.Empty(c.t, resp.Err)
+	require.NotNil(c.t, resp.Game)
+	return resp.Game
+}
+
+func (c *client) update(req mrgnet.UpdateGameRequest) string {
+	var resp mrgnet.UpdateGameResponse
+	c.do("update", req, &resp)
+	return resp.Err
+}
+
+const (
+	alice = mrgnet.NetId(1001)
+	bob   = mrgnet.NetId(2002)
+	carol = mrgnet.NetId(3003)
+)
+
+func TestUsers(t *testing.T) {
+	c := givenAServer(t)
+
+	var resp mrgnet.UpdateUserResponse
+	c.do("user", mrgnet.UpdateUserRequest{Id: alice}, &resp)
+	assert.Empty(t, resp.Err)
+	assert.Equal(t, alice, resp.Id)
+	assert.Equal(t, "", resp.Name)
+
+	c.do("user", mrgnet.UpdateUserRequest{Id: alice, Name: "alice"}, &resp)
+	assert.Equal(t, "alice", resp.Name)
+
+	// An empty name is a lookup, not a rename.
+	resp = mrgnet.UpdateUserResponse{}
+	c.do("user", mrgnet.UpdateUserRequest{Id: alice}, &resp)
+	assert.Equal(t, "alice", resp.Name)
+}
+
+func TestListingAndJoining(t *testing.T) {
+	c := givenAServer(t)
+	var user mrgnet.UpdateUserResponse
+	c.do("user", mrgnet.UpdateUserRequest{Id: alice, Name: "alice"}, &user)
+	key := c.newGame(alice)
+
+	var list mrgnet.ListGamesResponse
+	c.do("list", mrgnet.ListGamesRequest{Id: bob, Unstarted: true}, &list)
+	require.Equal(t, []mrgnet.GameKey{key}, list.Game_keys)
+	assert.Equal(t, "alice's game", list.Games[0].Name)
+	assert.Equal(t, "alice", list.Games[0].Denizens_name)
+
+	// Nobody is offered their own game to join.
+	list = mrgnet.ListGamesResponse{}
+	c.do("list", mrgnet.ListGamesRequest{Id: alice, Unstarted: true}, &list)
+	assert.Empty(t, list.Game_keys)
+
+	var join mrgnet.JoinGameResponse
+	c.do("join", mrgnet.JoinGameRequest{Id: bob, Game_key: key}, &join)
+	assert.True(t, join.Successful)
+	assert.Empty(t, join.Err)
+
+	join = mrgnet.JoinGameResponse{}
+	c.do("join", mrgnet.JoinGameRequest{Id: carol, Game_key: key}, &join)
+	assert.False(t, join.Successful)
+	assert.NotEmpty(t, join.Err)
+
+	for _, id := range []mrgnet.NetId{alice, bob} {
+		list = mrgnet.ListGamesResponse{}
+		c.do("list", mrgnet.ListGamesRequest{Id: id, Unstarted: false}, &list)
+		assert.Equal(t, []mrgnet.GameKey{key}, list.Game_keys)
+	}
+	list = mrgnet.ListGamesResponse{}
+	c.do("list", mrgnet.ListGamesRequest{Id: carol, Unstarted: true}, &list)
+	assert.Empty(t, list.Game_keys)
+
+	// Anyone who isn't playing can watch.
+	list = mrgnet.ListGamesResponse{}
+	c.do("list", mrgnet.ListGamesRequest{Id: carol, Watchable: true}, &list)
+	assert.Equal(t, []mrgnet.GameKey{key}, list.Game_keys)
+	list = mrgnet.ListGamesResponse{}
+	c.do("list", mrgnet.ListGamesRequest{Id: bob, Watchable: true}, &list)
+	assert.Empty(t, list.Game_keys)
+}
+
+func TestPlayingTurns(t *testing.T) {
+	c := givenAServer(t)
+	key := c.newGame(alice)
+	var join mrgnet.JoinGameResponse
+	c.do("join", mrgnet.JoinGameRequest{Id: bob, Game_key: key}, &join)
+	require.True(t, join.Successful)
+
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Script: []byte("script")}))
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Script: []byte("other")}))
+
+	// Intruders can't go first.
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Intruders: true, Before: []byte("b0")}))
+	// Nor can anyone play for the other side.
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Before: []byte("b0")}))
+	// Execs need a state to apply to.
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("e0"), After: []byte("a0")}))
+
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Before: []byte("b0")}))
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("e0"), After: []byte("a0")}))
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Intruders: true, Before: []byte("b1")}))
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Intruders: true, Execs: []byte("e1"), After: []byte("a1")}))
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Round: 1, Before: []byte("b2")}))
+
+	game := c.status(carol, key, false)
+	assert.Equal(t, []byte("script"), game.Script)
+	assert.Equal(t, [][]byte{[]byte("b0"), []byte("b1"), []byte("b2")}, game.Before)
+	assert.Equal(t, [][]byte{[]byte("e0"), []byte("e1")}, game.Execs)
+	assert.Equal(t, [][]byte{[]byte("a0"), []byte("a1")}, game.After)
+
+	sizes := c.status(alice, key, true)
+	assert.Len(t, sizes.Before, 3)
+	assert.Len(t, sizes.Execs, 2)
+	assert.Empty(t, sizes.Execs[0])
+	assert.Nil(t, sizes.Script)
+}
+
+func TestEndingGames(t *testing.T) {
+	c := givenAServer(t)
+	key := c.newGame(alice)
+
+	// Nobody can win a game that hasn't started.
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Winner: "denizens"}))
+
+	var join mrgnet.JoinGameResponse
+	c.do("join", mrgnet.JoinGameRequest{Id: bob, Game_key: key}, &join)
+	require.True(t, join.Successful)
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Before: []byte("b0")}))
+
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: carol, Game_key: key, Winner: "intruders"}))
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Winner: "ghosts"}))
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Winner: "intruders", Before: []byte("b0")}))
+
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Winner: "intruders"}))
+	assert.Equal(t, bob, c.status(alice, key, true).Winner)
+
+	// The other player's client sees the same ending, but can't change it.
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Winner: "intruders"}))
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Winner: "denizens"}))
+	assert.NotEmpty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("e0"), After: []byte("a0")}))
+
+	for _, req := range []mrgnet.ListGamesRequest{{Id: alice}, {Id: bob}, {Id: carol, Watchable: true}} {
+		var list mrgnet.ListGamesResponse
+		c.do("list", req, &list)
+		assert.Empty(t, list.Game_keys)
+	}
+}
+
+func TestChecksumsAndDesyncs(t *testing.T) {
+	c := givenAServer(t)
+	key := c.newGame(alice)
+	var join mrgnet.JoinGameResponse
+	c.do("join", mrgnet.JoinGameRequest{Id: bob, Game_key: key}, &join)
+	require.True(t, join.Successful)
+
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Before: []byte("b0")}))
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("e0"), After: []byte("a0"), Checksum: "c0"}))
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Intruders: true, Before: []byte("b1"), Desync: "bob doesn't agree"}))
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Intruders: true, Execs: []byte("e1"), After: []byte("a1")}))
+
+	game := c.status(alice, key, false)
+	assert.Equal(t, []string{"c0", ""}, game.Checksums)
+	assert.Equal(t, "bob doesn't agree", game.Desync)
+
+	sizes := c.status(alice, key, true)
+	assert.Equal(t, []string{"c0", ""}, sizes.Checksums)
+}
+
+func TestDeltaUpdates(t *testing.T) {
+	c := givenAServer(t)
+	key := c.newGame(alice)
+	var join mrgnet.JoinGameResponse
+	c.do("join", mrgnet.JoinGameRequest{Id: bob, Game_key: key}, &join)
+	require.True(t, join.Successful)
+	ctx := context.Background()
+
+	state := func(round int) []byte {
+		return []byte(strings.Repeat("the house is haunted, ", 200) + fmt.Sprintf("round %d", round))
+	}
+	_, err := mrgnet.UpdateGame(ctx, mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Before: state(0)})
+	require.NoError(t, err)
+
+	// The end of the turn goes up as a delta against its start.
+	updates := &updateRecorder{next: c.transport}
+	mrgnet.SetTransport(updates)
+	_, err = mrgnet.UpdateGameWithDelta(ctx, mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("e0"), After: state(1)}, state(0))
+	require.NoError(t, err)
+	require.Len(t, updates.sent, 1)
+	assert.True(t, updates.sent[0].Delta)
+	assert.Less(t, len(updates.sent[0].After), len(state(1)))
+
+	// A delta against something the server never saw gets sent again in full.
+	_, err = mrgnet.UpdateGameWithDelta(ctx, mrgnet.UpdateGameRequest{Id: bob, Game_key: key, Intruders: true, Before: state(2)}, state(99))
+	require.NoError(t, err)
+	require.Len(t, updates.sent, 3)
+	assert.True(t, updates.sent[1].Delta)
+	assert.False(t, updates.sent[2].Delta)
+
+	game := c.status(carol, key, false)
+	assert.Equal(t, [][]byte{state(0), state(2)}, game.Before)
+	assert.Equal(t, [][]byte{state(1)}, game.After)
+}
+
+// Keeps track of the updates sent through it.
+type updateRecorder struct {
+	next mrgnet.Transport
+	sent []mrgnet.UpdateGameRequest
+}
+
+func (ur *updateRecorder) Do(ctx context.Context, name string, input, output interface{}) error {
+	if req, ok := input.(mrgnet.UpdateGameRequest); ok {
+		ur.sent = append(ur.sent, req)
+	}
+	return ur.next.Do(ctx, name, input, output)
+}
+
+// Rejects any turn whose execs aren't "ok", and panics on "panic".
+type pickyValidator struct {
+	calls int
+}
+
+func (pv *pickyValidator) ValidateTurn(script, before, execs, after []byte) error {
+	pv.calls++
+	if string(execs) == "panic" {
+		panic("the dice fell off the table")
+	}
+	if string(execs) != "ok" {
+		return errors.New("the dice didn't say that")
+	}
+	return nil
+}
+
+func TestTurnValidation(t *testing.T) {
+	store, err := server.OpenStore(t.TempDir())
+	require.NoError(t, err)
+	srv := server.New(store)
+	validator := &pickyValidator{}
+	srv.SetTurnValidator(validator)
+	httpSrv := httptest.NewServer(srv)
+	defer httpSrv.Close()
+	c := &client{t: t, transport: &mrgnet.HTTPTransport{URL: httpSrv.URL}}
+	old := mrgnet.SetTransport(c.transport)
+	defer mrgnet.SetTransport(old)
+
+	key := c.newGame(alice)
+	require.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Before: []byte("b0")}))
+
+	msg := c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("cheat"), After: []byte("a0")})
+	assert.Contains(t, msg, "rejected")
+	assert.Contains(t, msg, "the dice didn't say that")
+	assert.Empty(t, c.status(alice, key, false).Execs)
+
+	// A validator that panics mustn't leave the server locked up.
+	var resp mrgnet.UpdateGameResponse
+	err = mrgnet.DoActionWithPolicy(context.Background(), mrgnet.RetryPolicy{Attempts: 1}, "update", mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("panic"), After: []byte("a0")}, &resp)
+	assert.Error(t, err)
+
+	assert.Empty(t, c.update(mrgnet.UpdateGameRequest{Id: alice, Game_key: key, Execs: []byte("ok"), After: []byte("a0")}))
+	assert.Equal(t, [][]byte{[]byte("ok")}, c.status(alice, key, false).Execs)
+	assert.Equal(t, 3, validator.calls)
+}
+
+func TestWaiting(t *testing.T) {
+	c := givenAServer(t)
+	ctx := context.Background()
+	key := c.newGame(alice)
+
+	status, err := mrgnet.Status(ctx, mrgnet.StatusRequest{Id: alice, Game_key: key, Sizes_only: true})
+	require.NoError(t, err)
+
+	t.Run("times out if nothing changes", func(t *testing.T) {
+		resp, err := mrgnet.Wait(ctx, mrgnet.WaitRequest{Id: alice, Game_key: key, Revision: status.Revision, Timeout: 10 * time.Millisecond})
+		require.NoError(t, err)
+		assert.False(t, resp.Changed)
+		assert.Equal(t, status.Revision, resp.Revision)
+	})
+
+	t.Run("returns as soon as the game changes", func(t *testing.T) {
+		done := make(chan *mrgnet.WaitResponse)
+		go func() {
+			resp, err := mrgnet.Wait(ctx, mrgnet.WaitRequest{Id: alice, Game_key: key, Revision: status.Revision, Timeout: time.Minute})
+			assert.NoError(t, err)
+			done <- resp
+		}()
+		var join mrgnet.JoinGameResponse
+		c.do("join", mrgnet.JoinGameRequest{Id: bob, Game_key: key}, &join)
+		select {
+		case resp := <-done:
+			assert.True(t, resp.Changed)
+			assert.NotEqual(t, status.Revision, resp.Revision)
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait didn't notice the game changing")
+		}
+	})
+
+	t.Run("a stale revision returns immediately", func(t *testing.T) {
+		resp, err := mrgnet.Wait(ctx, mrgnet.WaitRequest{Id: alice, Game_key: key, Revision: status.Revision, Timeout: time.Minute})
+		require.NoError(t, err)
+		assert.True(t, resp.Changed)
+	})
+
+	t.Run("an empty key waits on every game", func(t *testing.T) {
+		var list mrgnet.ListGamesResponse
+		c.do("list", mrgnet.ListGamesRequest{Id: carol, Unstarted: true}, &list)
+		c.newGame(carol)
+		resp, err := mrgnet.Wait(ctx, mrgnet.WaitRequest{Id: carol, Revision: list.Revision, Timeout: time.Minute})
+		require.NoError(t, err)
+		assert.True(t, resp.Changed)
+	})
+}
+
+func TestKill(t *testing.T) {
+	c := givenAServer(t)
+	key := c.newGame(alice)
+
+	var kill mrgnet.KillResponse
+	c.do("kill", mrgnet.KillRequest{Id: carol, Game_key: key}, &kill)
+	assert.NotEmpty(t, kill.Err)
+
+	kill = mrgnet.KillResponse{}
+	c.do("kill", mrgnet.KillRequest{Id: alice, Game_key: key}, &kill)
+	assert.Empty(t, kill.Err)
+
+	var status mrgnet.StatusResponse
+	c.do("status", mrgnet.StatusRequest{Id: alice, Game_key: key}, &status)
+	assert.NotEmpty(t, status.Err)
+}
+
+func TestGameKeysCannotEscapeTheStore(t *testing.T) {
+	c := givenAServer(t)
+
+	var status mrgnet.StatusResponse
+	c.do("status", mrgnet.StatusRequest{Id: alice, Game_key: "../users/1001"}, &status)
+	assert.NotEmpty(t, status.Err)
+	assert.Nil(t, status.Game)
+}
+
+func TestVersions(t *testing.T) {
+	c := givenAServer(t)
+	defer mrgnet.SetBuild("")
+
+	t.Run("requests without a protocol are turned away", func(t *testing.T) {
+		var resp mrgnet.UpdateUserResponse
+		err := c.transport.Do(context.Background(), "user", mrgnet.UpdateUserRequest{Id: alice}, &resp)
+		var stErr *mrgnet.StatusError
+		require.ErrorAs(t, err, &stErr)
+		assert.Equal(t, http.StatusUpgradeRequired, stErr.Code)
+	})
+
+	t.Run("old clients are told they're too old", func(t *testing.T) {
+		_, err := mrgnet.UpdateUser(context.Background(), mrgnet.UpdateUserRequest{Id: alice})
+		require.NoError(t, err)
+
+		old := mrgnet.Version{Protocol: mrgnet.MinProtocolVersion - 1}
+		err = mrgnet.DoActionWithPolicy(context.Background(), mrgnet.RetryPolicy{Attempts: 1}, "user", &fixedVersionUser{old, alice}, &mrgnet.UpdateUserResponse{})
+		var verr *mrgnet.VersionError
+		require.ErrorAs(t, err, &verr)
+		assert.Contains(t, mrgnet.UserMessage(err), "too old")
+	})
+
+	t.Run("games can only be played with the build that made them", func(t *testing.T) {
+		mrgnet.SetBuild("c0ffee")
+		key := c.newGame(alice)
+		game := c.status(alice, key, true)
+		assert.Equal(t, mrgnet.Version{Protocol: mrgnet.ProtocolVersion, Build: "c0ffee"}, game.Version)
+
+		mrgnet.SetBuild("decaf")
+		_, err := mrgnet.JoinGame(context.Background(), mrgnet.JoinGameRequest{Id: bob, Game_key: key})
+		var serr *mrgnet.ServerError
+		require.ErrorAs(t, err, &serr)
+		assert.Contains(t, serr.Msg, "different version")
+
+		mrgnet.SetBuild("c0ffee")
+		_, err = mrgnet.JoinGame(context.Background(), mrgnet.JoinGameRequest{Id: bob, Game_key: key})
+		assert.NoError(t, err)
+	})
+
+	t.Run("games started with an older protocol can still be played", func(t *testing.T) {
+		mrgnet.SetBuild("")
+		older := mrgnet.Version{Protocol: mrgnet.MinProtocolVersion}
+		var resp mrgnet.NewGameResponse
+		err := mrgnet.DoActionWithPolicy(context.Background(), mrgnet.RetryPolicy{Attempts: 1}, "new", &fixedVersionUser{older, alice}, &resp)
+		require.NoError(t, err)
+		require.Empty(t, resp.Err)
+
+		_, err = mrgnet.JoinGame(context.Background(), mrgnet.JoinGameRequest{Id: bob, Game_key: resp.Game_key})
+		assert.NoError(t, err)
+	})
+}
+
+// Stands in for a client that doesn't know about the current protocol; it
+// isn't Versioned so DoActionWithPolicy leaves it alone.
+type fixedVersionUser struct {
+	Version mrgnet.Version
+	Id      mrgnet.NetId
+}
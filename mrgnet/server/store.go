@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MobRulesGames/haunts/mrgnet"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Store keeps users and games as individual gob files beneath a root
+// directory:
+//
+//	<root>/users/<NetId>.gob
+//	<root>/games/<GameKey>.gob
+//
+// A Store does no locking of its own; the Server serializes access to it.
+type Store struct {
+	root string
+}
+
+func OpenStore(root string) (*Store, error) {
+	for _, sub := range []string{"users", "games"} {
+		dir := filepath.Join(root, sub)
+		err := os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create store dir %q: %w", dir, err)
+		}
+	}
+	return &Store{root: root}, nil
+}
+
+func (s *Store) userPath(id mrgnet.NetId) string {
+	return filepath.Join(s.root, "users", fmt.Sprintf("%d.gob", id))
+}
+
+func (s *Store) gamePath(key mrgnet.GameKey) string {
+	return filepath.Join(s.root, "games", string(key)+".gob")
+}
+
+func (s *Store) User(id mrgnet.NetId) (mrgnet.User, error) {
+	var user mrgnet.User
+	err := readGob(s.userPath(id), &user)
+	return user, err
+}
+
+func (s *Store) PutUser(user mrgnet.User) error {
+	return writeGob(s.userPath(user.Id), user)
+}
+
+func (s *Store) Game(key mrgnet.GameKey) (*mrgnet.Game, error) {
+	if !validKey(key) {
+		return nil, ErrNotFound
+	}
+	var game mrgnet.Game
+	err := readGob(s.gamePath(key), &game)
+	if err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+func (s *Store) PutGame(key mrgnet.GameKey, game *mrgnet.Game) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid game key %q", key)
+	}
+	return writeGob(s.gamePath(key), game)
+}
+
+func (s *Store) DeleteGame(key mrgnet.GameKey) error {
+	if !validKey(key) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.gamePath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Returns the keys of every stored game, oldest game first.
+func (s *Store) GameKeys() ([]mrgnet.GameKey, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, "games"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []mrgnet.GameKey
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".gob") {
+			continue
+		}
+		keys = append(keys, mrgnet.GameKey(strings.TrimSuffix(name, ".gob")))
+	}
+	// Keys begin with their creation time so lexical order is creation order.
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys, nil
+}
+
+// Game keys come from clients so make sure they can't be used to wander
+// around the filesystem.
+func validKey(key mrgnet.GameKey) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		ok := (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || c == '-'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func readGob(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = gob.NewDecoder(f).Decode(v)
+	if err != nil {
+		return fmt.Errorf("couldn't decode %q: %w", path, err)
+	}
+	return nil
+}
+
+// Writes to a temporary file first so that a crash mid-write never leaves a
+// truncated record behind.
+func writeGob(path string, v interface{}) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(v)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("couldn't encode %q: %w", path, err)
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MobRulesGames/haunts/mrgnet"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 2 * time.Minute
+)
+
+// Keeps track of which games have changed so that "wait" requests can block
+// until there's something new to see. Revisions only live in memory; after a
+// restart clients will see a different revision than the one they had, which
+// just ends their wait early.
+type changes struct {
+	mu     sync.Mutex
+	latest uint64
+	games  map[mrgnet.GameKey]uint64
+
+	// Closed, and replaced, every time anything changes.
+	changed chan struct{}
+}
+
+func (c *changes) init() {
+	c.games = make(map[mrgnet.GameKey]uint64)
+	c.changed = make(chan struct{})
+}
+
+func (c *changes) note(key mrgnet.GameKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latest++
+	c.games[key] = c.latest
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Returns the revision of the game with the given key, or of the server as a
+// whole if key is empty, along with a channel that's closed on the next
+// change.
+func (c *changes) current(key mrgnet.GameKey) (uint64, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key == "" {
+		return c.latest, c.changed
+	}
+	return c.games[key], c.changed
+}
+
+func (c *changes) revision(key mrgnet.GameKey) uint64 {
+	rev, _ := c.current(key)
+	return rev
+}
+
+func (srv *Server) wait(ctx context.Context, req *mrgnet.WaitRequest) mrgnet.WaitResponse {
+	var resp mrgnet.WaitResponse
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = defaultWaitTimeout
+	}
+	timer := time.NewTimer(min(timeout, maxWaitTimeout))
+	defer timer.Stop()
+	for {
+		rev, changed := srv.changes.current(req.Game_key)
+		resp.Revision = rev
+		if rev != req.Revision {
+			resp.Changed = true
+			return resp
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return resp
+		case <-ctx.Done():
+			resp.Err = "stopped waiting"
+			return resp
+		}
+	}
+}
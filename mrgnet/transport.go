@@ -0,0 +1,182 @@
+package mrgnet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// A Transport carries a single action to the game server and back. It
+// encodes 'input', delivers it to the action called 'name' and decodes the
+// reply into 'output'.
+type Transport interface {
+	Do(ctx context.Context, name string, input, output interface{}) error
+}
+
+var (
+	transportMutex sync.Mutex
+	transport      Transport = &HTTPTransport{URL: Host_url}
+)
+
+// Sets the Transport used by DoAction. Returns the previously installed
+// Transport so that callers, tests in particular, can restore it.
+func SetTransport(t Transport) Transport {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	old := transport
+	transport = t
+	return old
+}
+
+func CurrentTransport() Transport {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	return transport
+}
+
+func encodeForm(input interface{}) (url.Values, error) {
+	buf := bytes.NewBuffer(nil)
+	err := EncodePayload(buf, input)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{"data": []string{buf.String()}}, nil
+}
+
+// Talks to a game server over HTTP.
+type HTTPTransport struct {
+	// Base url of the server, e.g. "http://localhost:8080".
+	URL string
+
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (ht *HTTPTransport) Do(ctx context.Context, name string, input, output interface{}) error {
+	form, err := encodeForm(input)
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("%s/%s", strings.TrimSuffix(ht.URL, "/"), name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := ht.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("couldn't read response to %q: %w", name, err)
+	}
+	if r.StatusCode != http.StatusOK {
+		return &StatusError{Action: name, Code: r.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	return DecodePayload(bytes.NewBuffer(data), output)
+}
+
+// Hands requests straight to an in-process http.Handler, typically a
+// server.Server, so that games can be played without opening any sockets.
+// Payloads still go through the same encoding as they would on the wire.
+type LoopbackTransport struct {
+	Handler http.Handler
+}
+
+type loopbackResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (lr *loopbackResponse) Header() http.Header {
+	return lr.header
+}
+
+func (lr *loopbackResponse) Write(b []byte) (int, error) {
+	if lr.status == 0 {
+		lr.status = http.StatusOK
+	}
+	return lr.body.Write(b)
+}
+
+func (lr *loopbackResponse) WriteHeader(status int) {
+	if lr.status == 0 {
+		lr.status = status
+	}
+}
+
+func (lt *LoopbackTransport) Do(ctx context.Context, name string, input, output interface{}) error {
+	form, err := encodeForm(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/"+name, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp := &loopbackResponse{header: http.Header{}}
+	lt.Handler.ServeHTTP(resp, req)
+	if resp.status != 0 && resp.status != http.StatusOK {
+		return &StatusError{Action: name, Code: resp.status, Body: strings.TrimSpace(resp.body.String())}
+	}
+	return DecodePayload(&resp.body, output)
+}
+
+// A single action as seen by a RecordingTransport.
+type Call struct {
+	Name  string
+	Input interface{}
+}
+
+// A fake Transport that remembers every action it was asked to perform. If
+// Respond is set, its result is passed through the wire encoding into the
+// caller's output; otherwise the output is left untouched.
+type RecordingTransport struct {
+	Respond func(name string, input interface{}) (interface{}, error)
+
+	mutex sync.Mutex
+	calls []Call
+}
+
+func (rt *RecordingTransport) Do(ctx context.Context, name string, input, output interface{}) error {
+	rt.mutex.Lock()
+	rt.calls = append(rt.calls, Call{Name: name, Input: input})
+	rt.mutex.Unlock()
+
+	if rt.Respond == nil {
+		return nil
+	}
+	resp, err := rt.Respond(name, input)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(nil)
+	err = EncodePayload(buf, resp)
+	if err != nil {
+		return err
+	}
+	return DecodePayload(buf, output)
+}
+
+// Returns a copy of every call made so far, in order.
+func (rt *RecordingTransport) Calls() []Call {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	return append([]Call(nil), rt.calls...)
+}
@@ -0,0 +1,72 @@
+package mrgnet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/MobRulesGames/haunts/mrgnet/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoopbackTransport(t *testing.T) {
+	store, err := server.OpenStore(t.TempDir())
+	require.NoError(t, err)
+	old := mrgnet.SetTransport(&mrgnet.LoopbackTransport{Handler: server.New(store)})
+	defer mrgnet.SetTransport(old)
+
+	var user mrgnet.UpdateUserResponse
+	err = mrgnet.DoAction("user", mrgnet.UpdateUserRequest{Id: 12, Name: "loopy"}, &user)
+	require.NoError(t, err)
+	assert.Equal(t, "loopy", user.Name)
+
+	var game mrgnet.NewGameResponse
+	err = mrgnet.DoAction("new", mrgnet.NewGameRequest{Id: 12}, &game)
+	require.NoError(t, err)
+	assert.Equal(t, "loopy's game", game.Name)
+
+	err = mrgnet.DoAction("no-such-action", mrgnet.NewGameRequest{Id: 12}, &game)
+	assert.Error(t, err)
+}
+
+func TestRecordingTransport(t *testing.T) {
+	t.Run("records calls in order", func(t *testing.T) {
+		rt := &mrgnet.RecordingTransport{}
+		ctx := context.Background()
+		var resp mrgnet.StatusResponse
+		require.NoError(t, rt.Do(ctx, "status", mrgnet.StatusRequest{Game_key: "a"}, &resp))
+		require.NoError(t, rt.Do(ctx, "kill", mrgnet.KillRequest{Game_key: "a"}, &resp))
+
+		calls := rt.Calls()
+		require.Len(t, calls, 2)
+		assert.Equal(t, "status", calls[0].Name)
+		assert.Equal(t, mrgnet.StatusRequest{Game_key: "a"}, calls[0].Input)
+		assert.Equal(t, "kill", calls[1].Name)
+	})
+
+	t.Run("responds through the wire encoding", func(t *testing.T) {
+		rt := &mrgnet.RecordingTransport{
+			Respond: func(name string, input interface{}) (interface{}, error) {
+				req := input.(mrgnet.StatusRequest)
+				return mrgnet.StatusResponse{Game: &mrgnet.Game{Name: string(req.Game_key)}}, nil
+			},
+		}
+		var resp mrgnet.StatusResponse
+		require.NoError(t, rt.Do(context.Background(), "status", mrgnet.StatusRequest{Game_key: "echo"}, &resp))
+		require.NotNil(t, resp.Game)
+		assert.Equal(t, "echo", resp.Game.Name)
+	})
+
+	t.Run("passes errors along", func(t *testing.T) {
+		boom := errors.New("boom")
+		rt := &mrgnet.RecordingTransport{
+			Respond: func(string, interface{}) (interface{}, error) {
+				return nil, boom
+			},
+		}
+		var resp mrgnet.StatusResponse
+		assert.ErrorIs(t, rt.Do(context.Background(), "status", mrgnet.StatusRequest{}, &resp), boom)
+	})
+}
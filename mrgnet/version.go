@@ -0,0 +1,127 @@
+package mrgnet
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Bump this whenever the requests, or the game state and execs they carry,
+// change in a way that older clients can't cope with.
+//
+// 2: UpdateGameRequest can carry deltas.
+// 3: UpdateGameRequest can carry checksums and desync reports.
+const ProtocolVersion = 3
+
+// The oldest protocol a server built from this tree will talk to.
+const MinProtocolVersion = 1
+
+// Identifies the client that sent a request. Every request type embeds one
+// and DoActionWithPolicy fills it in with ClientVersion().
+type Version struct {
+	Protocol int
+
+	// The gen.Version() of the client build. Game state and execs are gobs of
+	// types that change from build to build, so two players need matching
+	// builds to share a game. Empty if unknown.
+	Build string
+}
+
+func (v Version) String() string {
+	if v.Build == "" {
+		return fmt.Sprintf("protocol %d", v.Protocol)
+	}
+	return fmt.Sprintf("protocol %d, build %s", v.Protocol, v.Build)
+}
+
+// Lets the server get at the Version embedded in any request.
+type Versioned interface {
+	RequestVersion() Version
+}
+
+func (v Version) RequestVersion() Version {
+	return v
+}
+
+func (v *Version) setClientVersion(to Version) {
+	*v = to
+}
+
+type versionSetter interface {
+	setClientVersion(Version)
+}
+
+var (
+	buildMutex sync.Mutex
+	build      string
+)
+
+// Records the build of this client, i.e. gen.Version(), so that it can be
+// sent along with every request.
+func SetBuild(b string) {
+	buildMutex.Lock()
+	defer buildMutex.Unlock()
+	build = b
+}
+
+func ClientVersion() Version {
+	buildMutex.Lock()
+	defer buildMutex.Unlock()
+	return Version{Protocol: ProtocolVersion, Build: build}
+}
+
+// Returns a copy of 'input' carrying ClientVersion() if it's a request that
+// has a Version, otherwise 'input' itself.
+func withClientVersion(input interface{}) interface{} {
+	val := reflect.ValueOf(input)
+	if !val.IsValid() {
+		return input
+	}
+	isPointer := val.Kind() == reflect.Pointer
+	if isPointer {
+		if val.IsNil() {
+			return input
+		}
+		val = val.Elem()
+	}
+	cp := reflect.New(val.Type())
+	cp.Elem().Set(val)
+	req, ok := cp.Interface().(versionSetter)
+	if !ok {
+		return input
+	}
+	req.setClientVersion(ClientVersion())
+	if isPointer {
+		return cp.Interface()
+	}
+	return cp.Elem().Interface()
+}
+
+// Explains why a client at version 'client' can't talk to a server built
+// from this tree, or returns "" if it can.
+func CheckProtocol(client Version) string {
+	switch {
+	case client.Protocol < MinProtocolVersion:
+		return "Your copy of Haunts is too old for this server, please update it."
+	case client.Protocol > ProtocolVersion:
+		return "The server is running an older version of Haunts than you are."
+	}
+	return ""
+}
+
+// Explains why a client at version 'client' can't play a game that was
+// created by a client at version 'game', or returns "" if it can. Newer
+// clients can keep playing games started with any protocol back to
+// MinProtocolVersion, so bumping ProtocolVersion doesn't strand games that
+// are underway.
+func CheckGameVersion(game, client Version) string {
+	switch {
+	case client.Protocol < game.Protocol:
+		return "Your copy of Haunts is too old to play this game, please update it."
+	case game.Protocol < MinProtocolVersion:
+		return "This game was started with a version of Haunts that's too old to play it with yours."
+	case game.Build != "" && client.Build != "" && game.Build != client.Build:
+		return fmt.Sprintf("This game was started with a different version of Haunts (%s) than yours (%s).", game.Build, client.Build)
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package mrgnet_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/mrgnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestsCarryTheClientVersion(t *testing.T) {
+	rt := &mrgnet.RecordingTransport{}
+	givenTransport(t, rt)
+	mrgnet.SetBuild("c0ffee")
+	defer mrgnet.SetBuild("")
+
+	req := mrgnet.StatusRequest{Game_key: "a"}
+	err := mrgnet.DoActionWithPolicy(context.Background(), quickPolicy, "status", req, &mrgnet.StatusResponse{})
+	require.NoError(t, err)
+
+	calls := rt.Calls()
+	require.Len(t, calls, 1)
+	sent, ok := calls[0].Input.(mrgnet.StatusRequest)
+	require.True(t, ok)
+	assert.Equal(t, mrgnet.Version{Protocol: mrgnet.ProtocolVersion, Build: "c0ffee"}, sent.Version)
+	assert.Equal(t, mrgnet.GameKey("a"), sent.Game_key)
+
+	// The caller's request is left alone.
+	assert.Equal(t, mrgnet.Version{}, req.Version)
+}
+
+func TestCheckGameVersion(t *testing.T) {
+	at := func(protocol int, build string) mrgnet.Version {
+		return mrgnet.Version{Protocol: protocol, Build: build}
+	}
+	assert.Empty(t, mrgnet.CheckGameVersion(at(1, "abc"), at(1, "abc")))
+	assert.Empty(t, mrgnet.CheckGameVersion(at(1, ""), at(1, "abc")), "unknown builds are given the benefit of the doubt")
+	assert.Contains(t, mrgnet.CheckGameVersion(at(2, "abc"), at(1, "abc")), "too old")
+	assert.Empty(t, mrgnet.CheckGameVersion(at(mrgnet.MinProtocolVersion, "abc"), at(mrgnet.ProtocolVersion, "abc")), "newer clients can play older games")
+	assert.Contains(t, mrgnet.CheckGameVersion(at(mrgnet.MinProtocolVersion-1, "abc"), at(mrgnet.ProtocolVersion, "abc")), "too old to play it")
+	assert.Contains(t, mrgnet.CheckGameVersion(at(1, "abc"), at(1, "def")), "different version")
+}
@@ -0,0 +1,155 @@
+package headless_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/actions"
+	"github.com/MobRulesGames/haunts/game/ai"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/registry"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHeadless(t *testing.T) {
+	Convey("HeadlessSpecs", t, func() {
+		base.SetDatadir("../../data")
+		So(house.SetDatadir(base.GetDataDir()), ShouldBeNil)
+		game.SetHeadless()
+		registry.LoadAllRegistries()
+		actions.Init()
+		ai.Init()
+
+		script, err := filepath.Abs(filepath.Join("testdata", "skirmish.lua"))
+		So(err, ShouldBeNil)
+		scenario := game.Scenario{
+			Script:    script,
+			HouseName: "Lvl_01_Haunted_House",
+		}
+
+		Convey("a script that isn't there is an error", func() {
+			missing := game.Scenario{Script: filepath.Join("testdata", "missing.lua")}
+			hg, err := game.StartHeadlessGame(missing, nil, map[string]string{}, game.FirstChoicePrompter{})
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, fs.ErrNotExist), ShouldBeTrue)
+			So(hg, ShouldBeNil)
+		})
+
+		Convey("Ais can play both sides without a window", func() {
+			hg, err := game.StartHeadlessGame(scenario, nil, map[string]string{}, game.FirstChoicePrompter{})
+			So(err, ShouldBeNil)
+			defer hg.Close()
+
+			played := hg.StepUntil(16, 200000, func(g *game.Game) bool {
+				return g.Turn >= 4
+			})
+			So(played, ShouldBeTrue)
+
+			g := hg.Game()
+			So(g.Ents, ShouldNotBeEmpty)
+			So(g.Turn, ShouldBeGreaterThanOrEqualTo, 4)
+			So(hg.Tally().Actions, ShouldNotBeEmpty)
+		})
+
+		Convey("Lua Ai evaluations get traced", func() {
+			game.SetAiTracing(true)
+			defer game.SetAiTracing(base.IsDevel())
+			hg, err := game.StartHeadlessGame(scenario, nil, map[string]string{}, game.FirstChoicePrompter{})
+			So(err, ShouldBeNil)
+			defer hg.Close()
+
+			played := hg.StepUntil(16, 200000, func(g *game.Game) bool {
+				return g.Turn >= 2
+			})
+			So(played, ShouldBeTrue)
+
+			g := hg.Game()
+			So(g.AiTraces(nil), ShouldNotBeEmpty)
+			calls := map[string]bool{}
+			execs := 0
+			for _, ent := range g.Ents {
+				for _, trace := range g.AiTraces(ent) {
+					So(trace.Ent, ShouldEqual, ent.Id)
+					for _, call := range trace.Calls {
+						calls[call.Func] = true
+					}
+					execs += len(trace.Execs)
+				}
+			}
+			So(calls, ShouldNotBeEmpty)
+			So(execs, ShouldBeGreaterThan, 0)
+
+			_, err = json.Marshal(g.AiTraces(nil))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Ais that never finish thinking get stopped", func() {
+			data := map[string]string{
+				// Ai paths are relative to data/ais.
+				"intruder_ents": "../../test/headless/testdata/runaway.lua",
+			}
+			hg, err := game.StartHeadlessGame(scenario, nil, data, game.FirstChoicePrompter{})
+			So(err, ShouldBeNil)
+			defer hg.Close()
+
+			played := hg.StepUntil(16, 200000, func(g *game.Game) bool {
+				return g.Turn >= 4
+			})
+			So(played, ShouldBeTrue)
+
+			stopped := map[string]bool{}
+			for _, ae := range hg.Game().AiErrors() {
+				So(ae.Err, ShouldContainSubstring, "instructions")
+				stopped[ae.Name] = true
+			}
+			So(stopped["Teen"], ShouldBeTrue)
+			So(stopped["Occultist"], ShouldBeTrue)
+		})
+
+		Convey("hotseat games hand the machine over every turn", func() {
+			script, err := filepath.Abs(filepath.Join("testdata", "hotseat.lua"))
+			So(err, ShouldBeNil)
+			hg, err := game.StartHeadlessHotseatGame(game.Scenario{Script: script}, game.FirstChoicePrompter{})
+			So(err, ShouldBeNil)
+			defer hg.Close()
+
+			// The script ends the game if a hand-off goes wrong.
+			played := hg.StepUntil(16, 200000, func(g *game.Game) bool {
+				ended, _ := hg.Ended()
+				return ended || g.Turn >= 5
+			})
+			So(played, ShouldBeTrue)
+			ended, _ := hg.Ended()
+			So(ended, ShouldBeFalse)
+			So(hg.Game().Turn, ShouldBeGreaterThanOrEqualTo, 5)
+		})
+
+		Convey("the Go Ai can play both sides", func() {
+			data := map[string]string{
+				"intruders": "go:utility",
+				"denizens":  "go:utility",
+			}
+			hg, err := game.StartHeadlessGame(scenario, nil, data, game.FirstChoicePrompter{})
+			So(err, ShouldBeNil)
+			defer hg.Close()
+
+			played := hg.StepUntil(16, 200000, func(g *game.Game) bool {
+				ended, _ := hg.Ended()
+				return ended || g.Turn >= 6
+			})
+			So(played, ShouldBeTrue)
+
+			sides := map[game.Side]bool{}
+			for _, at := range hg.Tally().Actions {
+				sides[at.Side] = true
+			}
+			So(sides[game.SideExplorers], ShouldBeTrue)
+			So(sides[game.SideHaunt], ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,77 @@
+-- The first level played hotseat by Ais on both sides. Turns get handed over
+-- through Net the way the level scripts do it online, and the other side
+-- plays back what happened. If a hand-off doesn't go the way it should the
+-- script ends the game.
+
+function OnStartup()
+end
+
+function Init(data)
+	Script.LoadHouse("Lvl_01_Haunted_House")
+	Script.BindAi("denizen", "ch01/denizens.lua")
+	Script.BindAi("minions", "minions.lua")
+	Script.BindAi("intruder", "ch01/intruders.lua")
+end
+
+function intrudersSetup()
+	intruder_spawn = Script.GetSpawnPointsMatching("Intruders_Start")
+	for _, name in pairs({ "Teen", "Occultist" }) do
+		ent = Script.SpawnEntitySomewhereInSpawnPoints(name, intruder_spawn, false)
+		Script.BindAi(ent, "ch01/" .. name .. ".lua")
+	end
+end
+
+function denizensSetup()
+	master_spawn = Script.GetSpawnPointsMatching("Master_.*")
+	ent = Script.SpawnEntitySomewhereInSpawnPoints("Bosch", master_spawn, false)
+	Script.BindAi(ent, "ch01/Bosch.lua")
+end
+
+-- Ends the game unless 'ok', printing 'msg'.
+function check(ok, msg)
+	if not ok then
+		print("SCRIPT: " .. msg)
+		Script.EndGame()
+	end
+	return ok
+end
+
+function RoundStart(intruders, round)
+	side = "Denizens"
+	if intruders then
+		side = "Intruders"
+	end
+	if not check(Net.Side() == side, Net.Side() .. " have the machine on the " .. side .. " turn") then
+		return
+	end
+	store.execs = {}
+	if round == 1 then
+		if intruders then
+			intrudersSetup()
+		else
+			denizensSetup()
+		end
+		Script.EndPlayerInteraction()
+	end
+	Script.SetLosMode("intruders", "entities")
+	Script.SetLosMode("denizens", "entities")
+	Net.UpdateState(Script.SaveGameState())
+end
+
+function OnAction(intruders, round, exec)
+	store.execs[table.getn(store.execs) + 1] = exec
+end
+
+function RoundEnd(intruders, round)
+	made = table.getn(store.execs)
+	Net.UpdateExecs(Script.SaveGameState(), store.execs)
+	Net.Wait()
+	state, execs = Net.LatestStateAndExecs()
+	if not check(table.getn(execs) == made, "got " .. table.getn(execs) .. " execs back instead of " .. made) then
+		return
+	end
+	Script.LoadGameState(state)
+	for _, exec in ipairs(execs) do
+		Script.DoExec(exec)
+	end
+end
@@ -0,0 +1,7 @@
+-- An entity Ai that never finishes thinking, which the Ai watchdog has to
+-- stop.
+
+function Think()
+	while true do
+	end
+end
@@ -0,0 +1,61 @@
+-- A short game of the first level with Ais playing both sides, for running
+-- without anybody watching. data.intruders and data.denizens pick the Ais
+-- that play each side, otherwise the ch01 Ais do. data.intruder_ents picks
+-- the Ai of each intruder on its own.
+
+function OnStartup()
+end
+
+function Init(data)
+	store.ais = {
+		intruders = data.intruders,
+		denizens = data.denizens,
+		intruder_ents = data.intruder_ents,
+	}
+	Script.LoadHouse("Lvl_01_Haunted_House")
+	Script.BindAi("denizen", data.denizens or "ch01/denizens.lua")
+	Script.BindAi("minions", "minions.lua")
+	Script.BindAi("intruder", data.intruders or "ch01/intruders.lua")
+end
+
+function intrudersSetup()
+	intruder_spawn = Script.GetSpawnPointsMatching("Intruders_Start")
+	for _, name in pairs({ "Teen", "Occultist" }) do
+		ent = Script.SpawnEntitySomewhereInSpawnPoints(name, intruder_spawn, false)
+		Script.BindAi(ent, store.ais.intruder_ents or store.ais.intruders or ("ch01/" .. name .. ".lua"))
+	end
+end
+
+function denizensSetup()
+	master_spawn = Script.GetSpawnPointsMatching("Master_.*")
+	ent = Script.SpawnEntitySomewhereInSpawnPoints("Bosch", master_spawn, false)
+	Script.BindAi(ent, store.ais.denizens or "ch01/Bosch.lua")
+
+	-- Goes to the Prompter, since there's nobody to ask.
+	placed = Script.PlaceEntities("Servitors_Start1", { { "Lost Soul", 1 } }, 0, 2)
+	for _, ent in pairs(placed) do
+		Script.BindAi(ent, store.ais.denizens or "ch01/Lost Soul.lua")
+	end
+end
+
+function RoundStart(intruders, round)
+	if round == 1 then
+		if intruders then
+			intrudersSetup()
+		else
+			denizensSetup()
+		end
+		Script.SetLosMode("intruders", "entities")
+		Script.SetLosMode("denizens", "entities")
+		Script.EndPlayerInteraction()
+		return
+	end
+	Script.SetLosMode("intruders", "entities")
+	Script.SetLosMode("denizens", "entities")
+end
+
+function OnAction(intruders, round, exec)
+end
+
+function RoundEnd(intruders, round)
+end
@@ -0,0 +1,128 @@
+// Checks that replaying recorded execs gives the same results every time.
+//
+// Either give it a replay, in which case every turn of it is checked (or just
+// the one asked for with -turn):
+//
+//	check-determinism -data data -replay data/replays/Lvl01-20260101-120000.replay
+//
+// or a state as made by Script.SaveGameState along with the execs of a turn
+// as passed to Net.UpdateExecs, e.g. the Before and Execs of a turn from the
+// server's store:
+//
+//	check-determinism -data data -state before -execs execs
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/actions"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/registry"
+)
+
+func main() {
+	data := flag.String("data", "data", "game data directory")
+	replayPath := flag.String("replay", "", "replay file to check")
+	turn := flag.Int("turn", -1, "only check this turn of the replay, counting from 0")
+	statePath := flag.String("state", "", "file holding the state to start from")
+	execsPath := flag.String("execs", "", "file holding the execs to apply to -state")
+	flag.Parse()
+
+	if (*replayPath == "") == (*statePath == "" || *execsPath == "") {
+		fmt.Fprintf(os.Stderr, "need either -replay or both -state and -execs\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	checker, err := makeChecker(*data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't load game data: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *replayPath != "" {
+		err = checkReplay(checker, *replayPath, *turn)
+	} else {
+		err = checkTurn(checker, *statePath, *execsPath)
+	}
+	var div *game.Divergence
+	if errors.As(err, &div) {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Loads just enough of the game from 'datadir' to apply execs. Nothing is
+// ever actually rendered.
+func makeChecker(datadir string) (*game.DeterminismChecker, error) {
+	base.SetDatadir(datadir)
+	err := house.SetDatadir(datadir)
+	if err != nil {
+		return nil, err
+	}
+	sprites := game.SetHeadless()
+	registry.LoadAllRegistries()
+	actions.Init()
+
+	// Only the recorded execs get applied, the Ais never get a say.
+	game.SetAiMaker(func(path string, g *game.Game, ent *game.Entity, dst *game.Ai, kind game.AiKind) {})
+
+	return &game.DeterminismChecker{Sprites: sprites}, nil
+}
+
+func checkReplay(checker *game.DeterminismChecker, path string, only int) error {
+	replay, err := game.LoadReplay(path)
+	if err != nil {
+		return err
+	}
+	if only >= len(replay.Turns) {
+		return fmt.Errorf("the replay only has %d turns", len(replay.Turns))
+	}
+	for i, turn := range replay.Turns {
+		if only >= 0 && i != only {
+			continue
+		}
+		div, err := checker.Check(turn.Before, turn.Execs)
+		if err != nil {
+			return fmt.Errorf("turn %d: %w", i, err)
+		}
+		if div != nil {
+			return fmt.Errorf("turn %d (round %d): %w", i, turn.Round, div)
+		}
+		fmt.Printf("turn %d (round %d): %d execs, no divergence\n", i, turn.Round, len(turn.Execs))
+	}
+	return nil
+}
+
+func checkTurn(checker *game.DeterminismChecker, statePath, execsPath string) error {
+	state, err := os.ReadFile(statePath)
+	if err != nil {
+		return err
+	}
+	encoded, err := os.ReadFile(execsPath)
+	if err != nil {
+		return err
+	}
+	execs, err := game.DecodeTurnExecs(encoded)
+	if err != nil {
+		return fmt.Errorf("couldn't decode execs: %w", err)
+	}
+	div, err := checker.Check(state, execs)
+	if err != nil {
+		return err
+	}
+	if div != nil {
+		return div
+	}
+	fmt.Printf("%d execs, no divergence\n", len(execs))
+	return nil
+}
@@ -0,0 +1,93 @@
+// Converts game states between the base64 gob made by Script.SaveGameState
+// and a readable JSON form, so that states can be attached to bug reports,
+// looked over and edited, and then loaded back in.
+//
+//	convert-state -data data to-json state > state.json
+//	convert-state -data data to-gob state.json > state
+//
+// With no file, the state is read from stdin.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/actions"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/registry"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [-data dir] to-json|to-gob [file]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	data := flag.String("data", "data", "game data directory")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		usage()
+		os.Exit(2)
+	}
+	var convert func([]byte, game.SpriteLoader) ([]byte, error)
+	switch flag.Arg(0) {
+	case "to-json":
+		convert = game.GameStateToJSON
+	case "to-gob":
+		convert = func(in []byte, sprites game.SpriteLoader) ([]byte, error) {
+			state, err := game.GameStateFromJSON(in, sprites)
+			return []byte(state), err
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	var in []byte
+	var err error
+	if flag.NArg() == 2 {
+		in, err = os.ReadFile(flag.Arg(1))
+	} else {
+		in, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	sprites, err := loadData(*data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't load game data: %v\n", err)
+		os.Exit(1)
+	}
+	out, err := convert(in, sprites)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't convert the state: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
+
+// Loads just enough of the game from 'datadir' to decode states. Nothing is
+// ever actually rendered.
+func loadData(datadir string) (game.SpriteLoader, error) {
+	base.SetDatadir(datadir)
+	err := house.SetDatadir(datadir)
+	if err != nil {
+		return nil, err
+	}
+	sprites := game.SetHeadless()
+	registry.LoadAllRegistries()
+	actions.Init()
+
+	// Decoding a game makes its Ais, which we never want to run.
+	game.SetAiMaker(func(path string, g *game.Game, ent *game.Entity, dst *game.Ai, kind game.AiKind) {})
+
+	return sprites, nil
+}
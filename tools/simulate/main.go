@@ -0,0 +1,325 @@
+// Plays a scenario over and over with Ais on both sides, each game with its
+// own seed, and reports how it went: how often each side won, how many
+// rounds games lasted and how much damage each entity and each of their
+// actions did.
+//
+//	simulate -data data -script Lvl01.lua -house Lvl_01_Haunted_House -n 100 > lvl01.json
+//	simulate -data data -script Lvl01.lua -n 100 -format csv -out lvl01/
+//
+// Sides the script would have a person play are played by -denizens and
+// -intruders instead. As CSV, sides.csv, games.csv, entities.csv and
+// actions.csv are written to the -out directory.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MobRulesGames/haunts/base"
+	"github.com/MobRulesGames/haunts/game"
+	"github.com/MobRulesGames/haunts/game/actions"
+	"github.com/MobRulesGames/haunts/game/ai"
+	"github.com/MobRulesGames/haunts/house"
+	"github.com/MobRulesGames/haunts/registry"
+)
+
+// How much game time passes each frame, in milliseconds.
+const frameMs = 33
+
+func main() {
+	data := flag.String("data", "data", "game data directory")
+	script := flag.String("script", "", "level script to play, under data/scripts")
+	houseName := flag.String("house", "", "name of the house the script loads")
+	n := flag.Int("n", 10, "how many games to play")
+	seed := flag.Int64("seed", 1, "seed for the first game, each game after uses the next one")
+	rounds := flag.Int("rounds", 50, "call a game a draw if it's still going after this many rounds")
+	denizens := flag.String("denizens", "", "Ai to play the denizens with, under data/ais (default denizens.lua)")
+	intruders := flag.String("intruders", "", "Ai to play the intruders with, under data/ais (default intruders.lua)")
+	format := flag.String("format", "json", "json or csv")
+	out := flag.String("out", "", "file to write json to, or directory to write csv to (default stdout for json)")
+	flag.Parse()
+
+	if *script == "" || *n <= 0 || (*format != "json" && *format != "csv") || (*format == "csv" && *out == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := loadData(*data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't load game data: %v\n", err)
+		os.Exit(1)
+	}
+
+	prompter := game.FirstChoicePrompter{Denizens: *denizens, Intruders: *intruders}
+	var games []gameResult
+	for i := 0; i < *n; i++ {
+		scenario := game.Scenario{
+			Script:    *script,
+			HouseName: *houseName,
+			Seed:      *seed + int64(i),
+		}
+		res, err := play(scenario, prompter, *rounds)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "game with seed %d: %v\n", scenario.Seed, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "game with seed %d: %s after %d rounds\n", res.Seed, res.Winner, res.Rounds)
+		games = append(games, res)
+	}
+
+	report := makeReport(games)
+	if *format == "json" {
+		err = writeJson(report, *out)
+	} else {
+		err = writeCsv(report, *out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't write the report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Loads the game from 'datadir' along with the real Ais. Nothing is ever
+// actually rendered.
+func loadData(datadir string) error {
+	base.SetDatadir(datadir)
+	err := house.SetDatadir(datadir)
+	if err != nil {
+		return err
+	}
+	game.SetHeadless()
+	registry.LoadAllRegistries()
+	actions.Init()
+	ai.Init()
+	return nil
+}
+
+type gameResult struct {
+	Seed    int64
+	Winner  string
+	Rounds  int
+	Actions []game.ActionTally `json:"-"`
+}
+
+func play(scenario game.Scenario, prompter game.Prompter, rounds int) (gameResult, error) {
+	hg, err := game.StartHeadlessGame(scenario, nil, map[string]string{}, prompter)
+	if err != nil {
+		return gameResult{}, err
+	}
+	defer hg.Close()
+	// Games that have ground to a halt, e.g. waiting on a person, are drawn
+	// after an hour of game time without a new round.
+	const stallMs = 60 * 60 * 1000
+	stalled := 0
+	last_turn := -1
+	hg.StepUntil(frameMs, 2*rounds*stallMs/frameMs, func(g *game.Game) bool {
+		if ended, _ := hg.Ended(); ended {
+			return true
+		}
+		if g.Turn != last_turn {
+			last_turn = g.Turn
+			stalled = 0
+		}
+		stalled++
+		return (g.Turn+1)/2 > rounds || stalled*frameMs > stallMs
+	})
+
+	if hg.Game() == nil {
+		return gameResult{}, fmt.Errorf("%s never loaded a house", scenario.Script)
+	}
+	res := gameResult{
+		Seed:    scenario.Seed,
+		Winner:  "Draw",
+		Rounds:  (hg.Game().Turn + 1) / 2,
+		Actions: hg.Tally().Actions,
+	}
+	if ended, winner := hg.Ended(); ended {
+		res.Winner = sideName(winner)
+	}
+	return res, nil
+}
+
+func sideName(side game.Side) string {
+	switch side {
+	case game.SideHaunt:
+		return "Denizens"
+	case game.SideExplorers:
+		return "Intruders"
+	}
+	return strings.TrimPrefix(side.String(), "Side")
+}
+
+type sideStats struct {
+	Side     string
+	Wins     int
+	Win_rate float64
+}
+
+type entityStats struct {
+	Side            string
+	Ent             string
+	Actions         int
+	Damage          int
+	Friendly_damage int
+	Kills           int
+
+	// Averaged over all games, whether the entity was in them or not.
+	Damage_per_game float64
+}
+
+type actionStats struct {
+	Side            string
+	Ent             string
+	Action          string
+	Uses            int
+	Damage          int
+	Friendly_damage int
+	Kills           int
+	Damage_per_use  float64
+}
+
+type report struct {
+	Games          int
+	Average_rounds float64
+	Sides          []sideStats
+	Entities       []entityStats
+	Actions        []actionStats
+	Results        []gameResult
+}
+
+func makeReport(games []gameResult) report {
+	r := report{Games: len(games), Results: games}
+	wins := map[string]int{}
+	ents := map[[2]string]*entityStats{}
+	acts := map[[3]string]*actionStats{}
+	for _, res := range games {
+		wins[res.Winner]++
+		r.Average_rounds += float64(res.Rounds)
+		for _, at := range res.Actions {
+			side := sideName(at.Side)
+			es := ents[[2]string{side, at.Ent}]
+			if es == nil {
+				es = &entityStats{Side: side, Ent: at.Ent}
+				ents[[2]string{side, at.Ent}] = es
+			}
+			es.Actions++
+			es.Damage += at.Damage
+			es.Friendly_damage += at.Friendly_damage
+			es.Kills += at.Kills
+
+			as := acts[[3]string{side, at.Ent, at.Action}]
+			if as == nil {
+				as = &actionStats{Side: side, Ent: at.Ent, Action: at.Action}
+				acts[[3]string{side, at.Ent, at.Action}] = as
+			}
+			as.Uses++
+			as.Damage += at.Damage
+			as.Friendly_damage += at.Friendly_damage
+			as.Kills += at.Kills
+		}
+	}
+	r.Average_rounds /= float64(len(games))
+
+	for _, side := range []string{"Denizens", "Intruders", "Draw"} {
+		r.Sides = append(r.Sides, sideStats{
+			Side:     side,
+			Wins:     wins[side],
+			Win_rate: float64(wins[side]) / float64(len(games)),
+		})
+	}
+	for _, es := range ents {
+		es.Damage_per_game = float64(es.Damage) / float64(len(games))
+		r.Entities = append(r.Entities, *es)
+	}
+	sort.Slice(r.Entities, func(i, j int) bool {
+		a, b := r.Entities[i], r.Entities[j]
+		if a.Side != b.Side {
+			return a.Side < b.Side
+		}
+		return a.Ent < b.Ent
+	})
+	for _, as := range acts {
+		as.Damage_per_use = float64(as.Damage) / float64(as.Uses)
+		r.Actions = append(r.Actions, *as)
+	}
+	sort.Slice(r.Actions, func(i, j int) bool {
+		a, b := r.Actions[i], r.Actions[j]
+		if a.Side != b.Side {
+			return a.Side < b.Side
+		}
+		if a.Ent != b.Ent {
+			return a.Ent < b.Ent
+		}
+		return a.Action < b.Action
+	})
+	return r
+}
+
+func writeJson(r report, path string) error {
+	out := os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func writeCsv(r report, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	}
+	d := strconv.Itoa
+
+	sides := [][]string{{"side", "wins", "win_rate", "average_rounds"}}
+	for _, ss := range r.Sides {
+		sides = append(sides, []string{ss.Side, d(ss.Wins), f(ss.Win_rate), f(r.Average_rounds)})
+	}
+	games := [][]string{{"seed", "winner", "rounds"}}
+	for _, res := range r.Results {
+		games = append(games, []string{strconv.FormatInt(res.Seed, 10), res.Winner, d(res.Rounds)})
+	}
+	ents := [][]string{{"side", "entity", "actions", "damage", "friendly_damage", "kills", "damage_per_game"}}
+	for _, es := range r.Entities {
+		ents = append(ents, []string{es.Side, es.Ent, d(es.Actions), d(es.Damage), d(es.Friendly_damage), d(es.Kills), f(es.Damage_per_game)})
+	}
+	acts := [][]string{{"side", "entity", "action", "uses", "damage", "friendly_damage", "kills", "damage_per_use"}}
+	for _, as := range r.Actions {
+		acts = append(acts, []string{as.Side, as.Ent, as.Action, d(as.Uses), d(as.Damage), d(as.Friendly_damage), d(as.Kills), f(as.Damage_per_use)})
+	}
+
+	for name, rows := range map[string][][]string{
+		"sides.csv":    sides,
+		"games.csv":    games,
+		"entities.csv": ents,
+		"actions.csv":  acts,
+	} {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(file)
+		w.WriteAll(rows)
+		file.Close()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}